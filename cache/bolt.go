@@ -0,0 +1,161 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/bohdanch-w/go-tgupload/entities"
+)
+
+const (
+	// bucketPrefix avoids empty bucket name for legacy namespace.
+	bucketPrefix = "ns:"
+
+	// DefaultLockTimeout is the time Open waits for database used by another run.
+	DefaultLockTimeout = 10 * time.Second
+
+	// ErrCacheLocked is returned, if database is not released by another run within lock timeout.
+	ErrCacheLocked = entities.Error("cache database is used by another run")
+
+	errStopRange = entities.Error("stop range")
+)
+
+var _ Store = (*BoltStore)(nil)
+
+// OpenBoltStore opens embedded key-value database, creating it if needed.
+// Every namespace is a separate bucket, indexed by content hash, so lookups
+// don't require loading the whole cache.
+// Database is locked while it is open, so concurrent runs can't share it: if it is not
+// released within lockTimeout, ErrCacheLocked is returned.
+func OpenBoltStore(path string, lockTimeout time.Duration) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: lockTimeout}) // nolint: mnd
+	if errors.Is(err, bolt.ErrTimeout) {
+		return nil, fmt.Errorf("%w: %s, wait for it to finish or use another cache file", ErrCacheLocked, path)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("open cache database: %w", err)
+	}
+
+	return &BoltStore{db: db}, nil
+}
+
+type BoltStore struct {
+	db *bolt.DB
+}
+
+func (s *BoltStore) Get(key Key) (Entry, bool, error) {
+	var (
+		entry Entry
+		found bool
+	)
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketName(key.Namespace))
+		if bucket == nil {
+			return nil
+		}
+
+		data := bucket.Get(key.Hash[:])
+		if data == nil {
+			return nil
+		}
+
+		found = true
+
+		return json.Unmarshal(data, &entry)
+	})
+	if err != nil {
+		return entry, false, fmt.Errorf("get cache entry: %w", err)
+	}
+
+	return entry, found, nil
+}
+
+func (s *BoltStore) Put(key Key, entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("marshal cache entry: %w", err)
+	}
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(bucketName(key.Namespace))
+		if err != nil {
+			return err // nolint: wrapcheck
+		}
+
+		return bucket.Put(key.Hash[:], data)
+	})
+	if err != nil {
+		return fmt.Errorf("put cache entry: %w", err)
+	}
+
+	return nil
+}
+
+func (s *BoltStore) Delete(key Key) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketName(key.Namespace))
+		if bucket == nil {
+			return nil
+		}
+
+		if err := bucket.Delete(key.Hash[:]); err != nil {
+			return err // nolint: wrapcheck
+		}
+
+		if k, _ := bucket.Cursor().First(); k == nil {
+			return tx.DeleteBucket(bucketName(key.Namespace))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("delete cache entry: %w", err)
+	}
+
+	return nil
+}
+
+func (s *BoltStore) Range(fn func(key Key, entry Entry) bool) error {
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, bucket *bolt.Bucket) error {
+			namespace := string(name[len(bucketPrefix):])
+
+			return bucket.ForEach(func(k, v []byte) error {
+				key := Key{Namespace: namespace}
+				if copy(key.Hash[:], k) != len(key.Hash) {
+					return fmt.Errorf("%w: %x", errCacheInvalid, k)
+				}
+
+				var entry Entry
+				if err := json.Unmarshal(v, &entry); err != nil {
+					return fmt.Errorf("unmarshal entry %x: %w", k, err)
+				}
+
+				if !fn(key, entry) {
+					return errStopRange
+				}
+
+				return nil
+			})
+		})
+	})
+	if err != nil && !errors.Is(err, errStopRange) {
+		return fmt.Errorf("range cache entries: %w", err)
+	}
+
+	return nil
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close() // nolint: wrapcheck
+}
+
+func bucketName(namespace string) []byte {
+	return []byte(bucketPrefix + namespace)
+}
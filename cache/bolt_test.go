@@ -0,0 +1,119 @@
+package cache_test
+
+import (
+	"context"
+	"crypto/md5" // nolint: gosec
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bohdanch-w/go-tgupload/cache"
+	"github.com/bohdanch-w/go-tgupload/entities"
+
+	whlogger "github.com/bohdanch-w/wheel/logger"
+)
+
+func TestBoltStore(t *testing.T) {
+	store, err := cache.OpenBoltStore(filepath.Join(t.TempDir(), "cache.db"), cache.DefaultLockTimeout)
+	require.NoError(t, err)
+
+	defer store.Close()
+
+	first := cache.Key{Namespace: "s3", Hash: md5.Sum([]byte("first"))}      // nolint: gosec
+	second := cache.Key{Namespace: "", Hash: md5.Sum([]byte("second"))}      // nolint: gosec
+	missing := cache.Key{Namespace: "other", Hash: md5.Sum([]byte("first"))} // nolint: gosec
+
+	require.NoError(t, store.Put(first, cache.Entry{URL: "https://s3/first.png", Size: 5}))
+	require.NoError(t, store.Put(second, cache.Entry{URL: "https://old/second.png"}))
+
+	entry, ok, err := store.Get(first)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "https://s3/first.png", entry.URL)
+	require.EqualValues(t, 5, entry.Size)
+
+	_, ok, err = store.Get(missing)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	keys := map[cache.Key]string{}
+	require.NoError(t, store.Range(func(key cache.Key, entry cache.Entry) bool {
+		keys[key] = entry.URL
+
+		return true
+	}))
+	require.Equal(t, map[cache.Key]string{first: "https://s3/first.png", second: "https://old/second.png"}, keys)
+
+	require.NoError(t, store.Delete(first))
+	require.NoError(t, store.Delete(missing))
+
+	_, ok, err = store.Get(first)
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestBoltStoreLocked(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.db")
+
+	store, err := cache.OpenBoltStore(path, cache.DefaultLockTimeout)
+	require.NoError(t, err)
+
+	_, err = cache.OpenBoltStore(path, 100*time.Millisecond)
+	require.ErrorIs(t, err, cache.ErrCacheLocked, "database is used by one run at once")
+	require.ErrorContains(t, err, path)
+
+	require.NoError(t, store.Close())
+
+	store, err = cache.OpenBoltStore(path, 100*time.Millisecond)
+	require.NoError(t, err, "released database is opened")
+	require.NoError(t, store.Close())
+}
+
+func TestOpenDatabaseMigratesJSON(t *testing.T) {
+	var (
+		ctx = context.Background()
+		dir = t.TempDir()
+	)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cache.json"), []byte(legacyFile), 0o600))
+
+	cdn := &countingCDN{prefix: "https://new/"}
+	before := time.Now().UTC()
+
+	mediaCache, err := cache.Open(filepath.Join(dir, "cache.db"), cdn, whlogger.NewNullLogger(),
+		cache.WithNamespace("s3{bucket=a}", "s3"))
+	require.NoError(t, err)
+
+	res, err := mediaCache.Upload(ctx, entities.MediaFile{Name: "first.png", Path: "first.png", Data: []byte("first")})
+	require.NoError(t, err)
+	require.Equal(t, "https://s3/first.png", res.URL)
+
+	res, err = mediaCache.Upload(ctx, entities.MediaFile{Name: "fourth.png", Path: "fourth.png", Data: []byte("fourth")})
+	require.NoError(t, err)
+	require.Equal(t, "https://new/fourth.png", res.URL)
+	require.NoError(t, mediaCache.Close())
+
+	// reopened database doesn't import JSON again and keeps upload metadata
+	require.NoError(t, os.Remove(filepath.Join(dir, "cache.json")))
+
+	store, err := cache.OpenBoltStore(filepath.Join(dir, "cache.db"), cache.DefaultLockTimeout)
+	require.NoError(t, err)
+
+	defer store.Close()
+
+	entry, ok, err := store.Get(cache.Key{Namespace: "s3{bucket=a}", Hash: md5.Sum([]byte("fourth"))}) // nolint: gosec
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.EqualValues(t, len("fourth"), entry.Size)
+	require.Equal(t, "image/png", entry.ContentType)
+	require.False(t, entry.CreatedAt.Before(before))
+	require.Equal(t, entry.CreatedAt, entry.UsedAt)
+
+	migrated, ok, err := store.Get(cache.Key{Namespace: "s3{bucket=a}", Hash: md5.Sum([]byte("first"))}) // nolint: gosec
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.False(t, migrated.UsedAt.Before(before), "last use is updated on cache hit")
+}
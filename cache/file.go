@@ -0,0 +1,262 @@
+package cache
+
+import (
+	"crypto/md5" // nolint: gosec
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/bohdanch-w/go-tgupload/entities"
+	"github.com/bohdanch-w/go-tgupload/pkg/fsutil"
+)
+
+// fileVersion is the version of cache file format. Files without version hold
+// single namespace, keyed by content hash.
+const fileVersion = 2
+
+const dbExt = ".db"
+
+const (
+	errCacheInvalid       = entities.Error("invalid saved hash")
+	errUnsupportedVersion = entities.Error("unsupported cache file version")
+	errJournalInvalid     = entities.Error("invalid journal record")
+)
+
+type cacheFile struct {
+	Version    int                         `json:"version"`
+	Namespaces map[string]map[string]Entry `json:"namespaces"`
+}
+
+// LoadFile adds entries from JSON file to the cache. Missing file is not an error.
+// Journals of crashed processes, which changes were not saved to the file, are replayed
+// and compacted into the file.
+func (c *MediaCache) LoadFile(path string) error {
+	return c.load(path, false)
+}
+
+// load reads JSON file while it is locked and opens journal of the cache, if requested.
+// Journal is created under the lock, so that other process can't take it for crashed one.
+func (c *MediaCache) load(path string, withJournal bool) (err error) {
+	unlock, err := fsutil.Lock(path)
+	if err != nil {
+		return fmt.Errorf("lock cache file: %w", err)
+	}
+
+	defer func() {
+		if unlockErr := unlock(); unlockErr != nil && err == nil {
+			err = fmt.Errorf("unlock cache file: %w", unlockErr)
+		}
+	}()
+
+	if err := readFile(path, c.store.Put); err != nil {
+		return err
+	}
+
+	replayed, err := replayJournals(path, c.store)
+	if err != nil {
+		return err
+	}
+
+	if err := c.migrate(); err != nil {
+		return err
+	}
+
+	if len(replayed) > 0 {
+		// file is locked, so it contains nothing but loaded entries
+		if err := writeFile(path, c.store, nil); err != nil {
+			return fmt.Errorf("compact journal: %w", err)
+		}
+
+		c.resetChanges()
+
+		// journal emptied on close of other process may be already removed by it
+		for _, p := range replayed {
+			if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("compact journal: %w", err)
+			}
+		}
+	}
+
+	if withJournal {
+		if c.journal, err = openJournal(path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ImportFile adds entries of JSON file, which are missing in the cache or were uploaded later
+// than cached ones, and returns their number.
+func (c *MediaCache) ImportFile(path string) (int, error) {
+	var imported int
+
+	if _, err := os.Stat(path); err != nil {
+		return 0, fmt.Errorf("import file: %w", err)
+	}
+
+	err := readFile(path, func(key Key, entry Entry) error {
+		cached, ok, err := c.store.Get(key)
+		if err != nil {
+			return fmt.Errorf("get entry: %w", err)
+		}
+
+		if ok && !entry.CreatedAt.After(cached.CreatedAt) {
+			return nil
+		}
+
+		c.put(key, entry)
+		imported++
+
+		return nil
+	})
+
+	return imported, err
+}
+
+// readFile calls fn for every entry of JSON file. Missing file is not an error.
+func readFile(path string, fn func(key Key, entry Entry) error) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		return fmt.Errorf("read file: %w", err)
+	}
+
+	var file cacheFile
+
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("unmarshal cached data: %w", err)
+	}
+
+	if file.Version == 0 {
+		var legacy map[string]Entry
+
+		if err := json.Unmarshal(data, &legacy); err != nil {
+			return fmt.Errorf("unmarshal legacy cached data: %w", err)
+		}
+
+		file.Namespaces = map[string]map[string]Entry{legacyNamespace: legacy}
+	}
+
+	if file.Version > fileVersion {
+		return fmt.Errorf("%w: %d", errUnsupportedVersion, file.Version)
+	}
+
+	for namespace, entries := range file.Namespaces {
+		for k, entry := range entries {
+			hash, err := ParseHash(k)
+			if err != nil {
+				return err
+			}
+
+			if err := fn(Key{Namespace: namespace, Hash: hash}, entry); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// SaveFile writes changes made since the cache was loaded to JSON file. File is locked and
+// read again, so that entries saved by other processes meanwhile are kept. Entries changed
+// by both are taken from the cache.
+func (c *MediaCache) SaveFile(path string) (err error) {
+	unlock, err := fsutil.Lock(path)
+	if err != nil {
+		return fmt.Errorf("lock cache file: %w", err)
+	}
+
+	defer func() {
+		if unlockErr := unlock(); unlockErr != nil && err == nil {
+			err = fmt.Errorf("unlock cache file: %w", unlockErr)
+		}
+	}()
+
+	saved := NewMemoryStore()
+
+	if err := readFile(path, saved.Put); err != nil {
+		return err
+	}
+
+	c.changesMux.Lock()
+	defer c.changesMux.Unlock()
+
+	for key, entry := range c.changes {
+		if entry == nil {
+			saved.Delete(key) // nolint: errcheck
+		} else {
+			saved.Put(key, *entry) // nolint: errcheck
+		}
+	}
+
+	if err := writeFile(path, saved, nil); err != nil {
+		return err
+	}
+
+	clear(c.changes)
+
+	return nil
+}
+
+// ExportFile writes entries matched by the filter, or all if it is nil, to JSON file.
+func (c *MediaCache) ExportFile(path string, match func(key Key, entry Entry) bool) error {
+	return writeFile(path, c.store, match)
+}
+
+// writeFile atomically replaces JSON file with entries of the store matched by the filter.
+func writeFile(path string, store Store, match func(key Key, entry Entry) bool) error {
+	file := cacheFile{
+		Version:    fileVersion,
+		Namespaces: make(map[string]map[string]Entry),
+	}
+
+	err := store.Range(func(key Key, entry Entry) bool {
+		if match != nil && !match(key, entry) {
+			return true
+		}
+
+		entries, ok := file.Namespaces[key.Namespace]
+		if !ok {
+			entries = make(map[string]Entry)
+			file.Namespaces[key.Namespace] = entries
+		}
+
+		entries[key.HashString()] = entry
+
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("read entries: %w", err)
+	}
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal data: %w", err)
+	}
+
+	if err := fsutil.WriteFile(path, data, 0o600); err != nil { // nolint: mnd
+		return fmt.Errorf("write file: %w", err)
+	}
+
+	return nil
+}
+
+// ParseHash decodes hex encoded content hash of cache key.
+func ParseHash(key string) ([md5.Size]byte, error) {
+	decoded, err := hex.DecodeString(key)
+	if err != nil {
+		return [md5.Size]byte{}, fmt.Errorf("decode key %s: %w", key, err)
+	}
+
+	if length := len(decoded); length != md5.Size {
+		return [md5.Size]byte{}, fmt.Errorf("%w: hash size %d, expected %d", errCacheInvalid, length, md5.Size)
+	}
+
+	return [md5.Size]byte(decoded), nil
+}
@@ -0,0 +1,73 @@
+package cache_test
+
+import (
+	"crypto/md5" // nolint: gosec
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bohdanch-w/go-tgupload/cache"
+
+	whlogger "github.com/bohdanch-w/wheel/logger"
+)
+
+func TestExportImport(t *testing.T) {
+	var (
+		dir      = t.TempDir()
+		exported = filepath.Join(dir, "shared.json")
+		now      = time.Now().UTC()
+
+		first  = cache.Key{Namespace: "s3", Hash: md5.Sum([]byte("first"))}  // nolint: gosec
+		second = cache.Key{Namespace: "s3", Hash: md5.Sum([]byte("second"))} // nolint: gosec
+		other  = cache.Key{Namespace: "", Hash: md5.Sum([]byte("other"))}    // nolint: gosec
+	)
+
+	source := cache.NewMemoryStore()
+	require.NoError(t, source.Put(first, cache.Entry{URL: "https://s3/first-new.png", CreatedAt: now}))
+	require.NoError(t, source.Put(second, cache.Entry{URL: "https://s3/second.png", CreatedAt: now.Add(-time.Hour)}))
+	require.NoError(t, source.Put(other, cache.Entry{URL: "https://old/other.png"}))
+
+	teammate := cache.New(nil, whlogger.NewNullLogger(), cache.WithStore(source))
+	require.NoError(t, teammate.ExportFile(exported, func(key cache.Key, _ cache.Entry) bool {
+		return key.Namespace == "s3"
+	}))
+
+	target := cache.NewMemoryStore()
+	require.NoError(t, target.Put(first, cache.Entry{URL: "https://s3/first-old.png", CreatedAt: now.Add(-time.Hour)}))
+	require.NoError(t, target.Put(second, cache.Entry{URL: "https://s3/second-own.png", CreatedAt: now}))
+
+	mediaCache := cache.New(nil, whlogger.NewNullLogger(), cache.WithStore(target))
+
+	imported, err := mediaCache.ImportFile(exported)
+	require.NoError(t, err)
+	require.Equal(t, 1, imported)
+
+	_, err = mediaCache.ImportFile(filepath.Join(dir, "missing.json"))
+	require.Error(t, err)
+
+	require.NoError(t, mediaCache.Delete(second))
+
+	urls := map[cache.Key]string{}
+	require.NoError(t, mediaCache.Range(func(key cache.Key, entry cache.Entry) bool {
+		urls[key] = entry.URL
+
+		return true
+	}))
+	require.Equal(t, map[cache.Key]string{first: "https://s3/first-new.png"}, urls)
+}
+
+func TestParseHash(t *testing.T) {
+	key := cache.Key{Hash: md5.Sum([]byte("first"))} // nolint: gosec
+
+	hash, err := cache.ParseHash(key.HashString())
+	require.NoError(t, err)
+	require.Equal(t, key.Hash, hash)
+
+	_, err = cache.ParseHash("0123")
+	require.Error(t, err)
+
+	_, err = cache.ParseHash("not hex")
+	require.Error(t, err)
+}
@@ -0,0 +1,238 @@
+package cache
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bohdanch-w/go-tgupload/pkg/fsutil"
+)
+
+const (
+	journalExt = ".journal"
+
+	// journal is synced to disk after this many records or this period since the last sync,
+	// whichever comes first. Records are written to OS immediately, so only power loss
+	// may lose unsynced ones.
+	journalSyncBatch    = 32
+	journalSyncInterval = time.Second
+)
+
+type journalOp string
+
+const (
+	journalPut    journalOp = "put"
+	journalDelete journalOp = "delete"
+)
+
+// journalRecord is single change of the cache, stored as a line of JSON.
+type journalRecord struct {
+	Op        journalOp `json:"op"`
+	Namespace string    `json:"namespace"`
+	Hash      string    `json:"hash"`
+	Entry     *Entry    `json:"entry,omitempty"`
+}
+
+// journal is append-only log of cache changes made by single process since the cache file
+// was saved. Every process writes own journal next to the cache file and keeps it locked,
+// so that journals of crashed processes are told apart from ones in use.
+type journal struct {
+	file     *os.File
+	mux      sync.Mutex
+	pending  int
+	lastSync time.Time
+}
+
+// openJournal creates new locked journal of the cache file at the path.
+func openJournal(path string) (*journal, error) {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*"+journalExt)
+	if err != nil {
+		return nil, fmt.Errorf("create journal: %w", err)
+	}
+
+	if err := fsutil.LockFile(file); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+
+		return nil, fmt.Errorf("lock journal: %w", err)
+	}
+
+	return &journal{file: file, lastSync: time.Now()}, nil
+}
+
+func (j *journal) append(op journalOp, key Key, entry *Entry) error {
+	data, err := json.Marshal(journalRecord{
+		Op:        op,
+		Namespace: key.Namespace,
+		Hash:      key.HashString(),
+		Entry:     entry,
+	})
+	if err != nil {
+		return fmt.Errorf("marshal journal record: %w", err)
+	}
+
+	j.mux.Lock()
+	defer j.mux.Unlock()
+
+	if _, err := j.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("write journal: %w", err)
+	}
+
+	j.pending++
+
+	if j.pending >= journalSyncBatch || time.Since(j.lastSync) >= journalSyncInterval {
+		return j.sync()
+	}
+
+	return nil
+}
+
+func (j *journal) sync() error {
+	if err := j.file.Sync(); err != nil {
+		return fmt.Errorf("sync journal: %w", err)
+	}
+
+	j.pending, j.lastSync = 0, time.Now()
+
+	return nil
+}
+
+// Close removes the journal, as its changes are saved to cache file. Journal is emptied and removed
+// while still locked, so other process may only replay it, if it opened the journal before removal,
+// and finds nothing to apply then. Where open file can't be removed, e.g. on Windows, it is removed
+// after unlock, being already empty.
+func (j *journal) Close() error {
+	j.mux.Lock()
+	defer j.mux.Unlock()
+
+	if err := j.file.Truncate(0); err != nil {
+		j.file.Close()
+
+		return fmt.Errorf("truncate journal: %w", err)
+	}
+
+	removeErr := os.Remove(j.file.Name())
+
+	if err := j.file.Close(); err != nil {
+		return fmt.Errorf("close journal: %w", err)
+	}
+
+	if removeErr != nil {
+		if err := os.Remove(j.file.Name()); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("remove journal: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// journals returns paths of journals of the cache file at the path.
+func journals(path string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("list journals: %w", err)
+	}
+
+	var (
+		prefix = filepath.Base(path) + "."
+		paths  []string
+	)
+
+	for _, e := range entries {
+		if name := e.Name(); !e.IsDir() && strings.HasPrefix(name, prefix) && strings.HasSuffix(name, journalExt) {
+			paths = append(paths, filepath.Join(filepath.Dir(path), name))
+		}
+	}
+
+	return paths, nil
+}
+
+// replayJournals applies journals of crashed processes to the store and returns their paths.
+// Journals locked by running processes are skipped.
+func replayJournals(path string, store Store) ([]string, error) {
+	paths, err := journals(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var replayed []string
+
+	for _, p := range paths {
+		ok, err := replayJournal(p, store)
+		if err != nil {
+			return nil, fmt.Errorf("replay journal %s: %w", p, err)
+		}
+
+		if ok {
+			replayed = append(replayed, p)
+		}
+	}
+
+	return replayed, nil
+}
+
+// replayJournal applies records of the journal to the store, unless it is locked by other process,
+// and reports whether it was replayed. Incomplete last record, written during crash, is ignored.
+func replayJournal(path string, store Store) (bool, error) {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+
+		return false, fmt.Errorf("open journal: %w", err)
+	}
+	defer file.Close()
+
+	locked, err := fsutil.TryLockFile(file)
+	if err != nil || !locked {
+		return false, err // nolint: wrapcheck
+	}
+	defer fsutil.UnlockFile(file) // nolint: errcheck
+
+	reader := bufio.NewReader(file)
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// line without newline was not completely written
+			return true, nil
+		}
+
+		if err != nil {
+			return false, fmt.Errorf("read journal: %w", err)
+		}
+
+		var rec journalRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return false, fmt.Errorf("unmarshal journal record: %w", err)
+		}
+
+		hash, err := ParseHash(rec.Hash)
+		if err != nil {
+			return false, err
+		}
+
+		key := Key{Namespace: rec.Namespace, Hash: hash}
+
+		switch {
+		case rec.Op == journalPut && rec.Entry != nil:
+			err = store.Put(key, *rec.Entry)
+		case rec.Op == journalDelete:
+			err = store.Delete(key)
+		default:
+			err = fmt.Errorf("%w: %q", errJournalInvalid, rec.Op)
+		}
+
+		if err != nil {
+			return false, err
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package cache_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bohdanch-w/go-tgupload/cache"
+	"github.com/bohdanch-w/go-tgupload/entities"
+	"github.com/bohdanch-w/go-tgupload/internal/testproc"
+
+	whlogger "github.com/bohdanch-w/wheel/logger"
+)
+
+func TestJournalSurvivesCrash(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		path  = filepath.Join(t.TempDir(), "cache.json")
+		files = []entities.MediaFile{
+			{Name: "01.png", Path: "01.png", Data: []byte("01.png")},
+			{Name: "02.png", Path: "02.png", Data: []byte("02.png")},
+		}
+	)
+
+	// journal of running process is locked, so crash is simulated by separate process
+	testproc.Run(t, "crash", path, files[0].Name, files[1].Name)
+
+	_, err := os.Stat(path)
+	require.ErrorIs(t, err, os.ErrNotExist, "cache file is written only on close")
+
+	retry := &countingCDN{prefix: "https://retry/"}
+
+	resumed, err := cache.Open(path, retry, whlogger.NewNullLogger(), cache.WithNamespace("s3", "s3"))
+	require.NoError(t, err)
+
+	for _, media := range files {
+		res, err := resumed.Upload(ctx, media)
+		require.NoError(t, err)
+		require.Equal(t, "https://cdn/"+media.Name, res.URL)
+	}
+
+	require.Zero(t, retry.calls)
+
+	// journal is compacted into cache file on load
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	var saved struct {
+		Namespaces map[string]map[string]any `json:"namespaces"`
+	}
+
+	require.NoError(t, json.Unmarshal(data, &saved))
+	require.Len(t, saved.Namespaces["s3"], 2)
+
+	require.NoError(t, resumed.Close())
+
+	journals, err := filepath.Glob(path + ".*.journal")
+	require.NoError(t, err)
+	require.Empty(t, journals, "journal is removed on close")
+}
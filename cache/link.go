@@ -0,0 +1,55 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/bohdanch-w/go-tgupload/entities"
+)
+
+const (
+	// ErrDeadLink is returned by CheckLink, if URL is answered with status meaning the file is gone.
+	ErrDeadLink = entities.Error("dead link")
+	// ErrUnknownLink is returned by CheckLink, if URL is answered with other error status,
+	// e.g. rate limit or server error, which doesn't tell whether the file exists.
+	ErrUnknownLink = entities.Error("link state unknown")
+)
+
+// CheckLink sends HEAD request to the URL and returns ErrDeadLink, if it is answered with 403, 404 or 410.
+// Hosts not supporting HEAD are checked with GET. Other errors, including ErrUnknownLink,
+// mean the link state is unknown and the link shouldn't be dropped.
+func CheckLink(ctx context.Context, client *http.Client, url string) error {
+	status, err := linkStatus(ctx, client, http.MethodHead, url)
+	if err == nil && status == http.StatusMethodNotAllowed {
+		status, err = linkStatus(ctx, client, http.MethodGet, url)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case status == http.StatusForbidden, status == http.StatusNotFound, status == http.StatusGone:
+		return fmt.Errorf("%w: %d %s", ErrDeadLink, status, http.StatusText(status))
+	case status >= http.StatusBadRequest:
+		return fmt.Errorf("%w: %d %s", ErrUnknownLink, status, http.StatusText(status))
+	}
+
+	return nil
+}
+
+func linkStatus(ctx context.Context, client *http.Client, method, url string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, http.NoBody)
+	if err != nil {
+		return 0, fmt.Errorf("create request: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,49 @@
+package cache_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bohdanch-w/go-tgupload/cache"
+)
+
+func TestCheckLink(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status, err := strconv.Atoi(r.URL.Path[1:])
+		require.NoError(t, err)
+
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		status int
+		err    error
+	}{
+		{status: http.StatusOK},
+		{status: http.StatusForbidden, err: cache.ErrDeadLink},
+		{status: http.StatusNotFound, err: cache.ErrDeadLink},
+		{status: http.StatusGone, err: cache.ErrDeadLink},
+		{status: http.StatusTooManyRequests, err: cache.ErrUnknownLink},
+		{status: http.StatusInternalServerError, err: cache.ErrUnknownLink},
+		{status: http.StatusServiceUnavailable, err: cache.ErrUnknownLink},
+	}
+
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			err := cache.CheckLink(context.Background(), srv.Client(), srv.URL+"/"+strconv.Itoa(tt.status))
+			if tt.err == nil {
+				require.NoError(t, err)
+
+				return
+			}
+
+			require.ErrorIs(t, err, tt.err)
+		})
+	}
+}
@@ -3,131 +3,467 @@ package cache
 import (
 	"context"
 	"crypto/md5" // nolint: gosec
-	"encoding/hex"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/bohdanch-w/go-tgupload/entities"
+	"github.com/bohdanch-w/go-tgupload/pkg/utils"
 	"github.com/bohdanch-w/go-tgupload/services"
 
 	whlogger "github.com/bohdanch-w/wheel/logger"
 )
 
+// expiryMargin is the minimal remaining lifetime of cached link to be reused.
+const expiryMargin = time.Hour
+
+// revalidateTimeout limits single check of cached link.
+const revalidateTimeout = 30 * time.Second
+
+// legacyNamespace holds entries of unknown origin, e.g. migrated from old cache file.
+const legacyNamespace = ""
+
 var _ services.CDN = (*MediaCache)(nil)
 
-type MediaCache struct {
-	retriever services.CDN
-	logger    whlogger.Logger
+type Option func(*MediaCache)
+
+// WithNamespace separates cached entries by CDN identity, so that links uploaded to
+// other CDN or bucket are not reused. Legacy entries, which were uploaded with one of the given
+// CDN types or with unknown one, are moved to the namespace on load.
+func WithNamespace(namespace string, cdnTypes ...string) Option {
+	return func(c *MediaCache) {
+		c.namespace = namespace
+		c.cdnTypes = cdnTypes
+	}
+}
 
-	cache map[[md5.Size]byte]cachedMedia
-	mux   sync.RWMutex
+// WithStore sets storage of cached entries, in memory by default.
+func WithStore(store Store) Option {
+	return func(c *MediaCache) {
+		c.store = store
+	}
 }
 
-type cachedMedia struct {
-	Path string `json:"path"`
-	URL  string `json:"url"`
+// WithRevalidation makes cached links, which were not validated within ttl of CDN they are stored at,
+// checked before reuse. Dead links are uploaded again. Default client is used, if it is nil.
+func WithRevalidation(ttl TTL, client *http.Client) Option {
+	return func(c *MediaCache) {
+		if client == nil {
+			client = &http.Client{Timeout: revalidateTimeout}
+		}
+
+		c.ttl = ttl
+		c.client = client
+	}
+}
+
+type MediaCache struct {
+	retriever services.CDN
+	logger    whlogger.Logger
+	namespace string
+	cdnTypes  []string
+	store     Store
+	// ttl is the period cached link is trusted without validation, nil disables revalidation.
+	ttl    TTL
+	client *http.Client
+	// similar matches near-duplicate images, nil if disabled.
+	similar *similarIndex
+	// file is JSON file, which in-memory store is saved to on Close.
+	file string
+	// journal keeps changes made since the file was loaded, so that they survive a crash.
+	journal *journal
+	// changes are entries put, or deleted if nil, since the file was loaded or saved.
+	// Only they are written to the file, which may be changed by other processes meanwhile.
+	changes    map[Key]*Entry
+	changesMux sync.Mutex
 }
 
-func New(retriever services.CDN, logger whlogger.Logger) *MediaCache {
-	return &MediaCache{
+func New(retriever services.CDN, logger whlogger.Logger, opts ...Option) *MediaCache {
+	c := &MediaCache{
 		retriever: retriever,
 		logger:    logger,
-		cache:     make(map[[md5.Size]byte]cachedMedia),
+		store:     NewMemoryStore(),
+		changes:   make(map[Key]*Entry),
 	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
 }
 
-func (c *MediaCache) LoadFile(path string) error {
-	const errCacheInvalid = entities.Error("invalid saved hash")
+// Open creates cache persisted at the path. Files with ".db" extension are embedded database,
+// others are JSON files loaded in memory and saved back on Close.
+// New database imports JSON file with the same name, if any.
+func Open(path string, retriever services.CDN, logger whlogger.Logger, opts ...Option) (*MediaCache, error) {
+	if !IsDatabase(path) {
+		c := New(retriever, logger, opts...)
+		c.file = path
+
+		if err := c.load(path, true); err != nil {
+			return nil, err
+		}
 
-	data, err := os.ReadFile(path)
+		return c, nil
+	}
+
+	_, statErr := os.Stat(path)
+
+	store, err := OpenBoltStore(path, DefaultLockTimeout)
 	if err != nil {
-		if errors.Is(os.ErrNotExist, err) {
-			c.cache = make(map[[md5.Size]byte]cachedMedia) // nullify cache
+		return nil, err
+	}
 
-			return nil
-		}
+	c := New(retriever, logger, append(opts, WithStore(store))...)
+
+	if errors.Is(statErr, os.ErrNotExist) {
+		jsonPath := strings.TrimSuffix(path, filepath.Ext(path)) + ".json"
 
-		return fmt.Errorf("read file: %w", err)
+		err = c.LoadFile(jsonPath)
+	} else {
+		err = c.migrate()
 	}
 
-	var cache map[string]cachedMedia
+	if err != nil {
+		store.Close()
 
-	if err := json.Unmarshal(data, &cache); err != nil {
-		return fmt.Errorf("unmarshal cached data: %w", err)
+		return nil, fmt.Errorf("migrate cache: %w", err)
 	}
 
-	for key, value := range cache {
-		decoded, err := hex.DecodeString(key)
-		if err != nil {
-			return fmt.Errorf("decode key %s: %w", key, err)
-		}
+	return c, nil
+}
+
+// IsDatabase reports whether cache at the path is kept in embedded database.
+func IsDatabase(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), dbExt)
+}
 
-		if length := len(decoded); length != md5.Size {
-			return fmt.Errorf("%w: hash size %d, expected %d", errCacheInvalid, length, md5.Size)
+// Close saves JSON file cache, dropping its journal, and releases the store.
+func (c *MediaCache) Close() error {
+	if c.file != "" {
+		if err := c.SaveFile(c.file); err != nil {
+			return err
 		}
+	}
 
-		c.cache[*((*[md5.Size]byte)(decoded))] = value
+	if c.journal != nil {
+		if err := c.journal.Close(); err != nil {
+			return err
+		}
 	}
 
-	return nil
+	return c.store.Close() // nolint: wrapcheck
 }
 
-func (c *MediaCache) Upload(ctx context.Context, media entities.MediaFile) (string, error) {
-	hash := md5.Sum(media.Data) // nolint: gosec
+func (c *MediaCache) Upload(ctx context.Context, media entities.MediaFile) (entities.MediaFile, error) {
+	content, err := readContent(media)
+	if err != nil {
+		return media, err
+	}
+
+	key := Key{Namespace: c.namespace, Hash: content.hash}
 
-	if cached, ok := c.getHash(hash); ok {
+	cached, ok, err := c.store.Get(key)
+	if err != nil {
+		c.logger.WithError(err).Warnf("failed to read cache")
+	}
+
+	// expiring links are uploaded again shortly before expiry, so that page is not built from dead links
+	if ok && !cached.Expired(time.Now().Add(expiryMargin)) && c.revalidate(ctx, &cached) {
 		if media.Path != cached.Path {
 			c.logger.With("old", cached.Path).
 				With("new", media.Path).
 				Warnf("equal hash for different pathes")
 		}
 
-		return cached.URL, nil
+		// entries cached before similarity matching was enabled get their hashes on use
+		if cached.PHash == "" {
+			if hash, ok := c.perceptualHash(media); ok {
+				cached.PHash = hash.String()
+				c.similar.add(key, hash)
+			}
+		}
+
+		cached.UsedAt = time.Now().UTC()
+		c.put(key, cached)
+
+		return cached.apply(media), nil
+	}
+
+	hash, hashed := c.perceptualHash(media)
+	if hashed {
+		if similar, ok := c.reuseSimilar(ctx, key, hash, media, content); ok {
+			return similar, nil
+		}
 	}
 
-	url, err := c.retriever.Upload(ctx, media)
+	media, err = c.retriever.Upload(ctx, media)
 	if err == nil {
-		c.setHash(hash, media.Path, url)
+		entry := newEntry(media, content)
+
+		if hashed {
+			entry.PHash = hash.String()
+			c.similar.add(key, hash)
+		}
+
+		c.put(key, entry)
 	}
 
-	return url, err // nolint: wrapcheck
+	return media, err // nolint: wrapcheck
 }
 
-func (c *MediaCache) getHash(hash [16]byte) (cachedMedia, bool) {
-	c.mux.RLock()
-	defer c.mux.RUnlock()
+// revalidate checks cached link, if it was not validated within ttl of its CDN, and reports whether
+// it may be reused.
+// Links failed to check, e.g. due to network errors, are reused without updating validation time.
+func (c *MediaCache) revalidate(ctx context.Context, entry *Entry) bool {
+	now := time.Now().UTC()
+
+	if ttl := c.ttl.Of(entry.CDN); ttl <= 0 || entry.Validated().After(now.Add(-ttl)) {
+		return true
+	}
+
+	err := CheckLink(ctx, c.client, entry.URL)
+
+	switch {
+	case err == nil:
+		entry.ValidatedAt = now
+
+		return true
+	case errors.Is(err, ErrDeadLink):
+		c.logger.WithError(err).With("url", entry.URL).Infof("cached link is dead, uploading again")
+
+		return false
+	default:
+		c.logger.WithError(err).With("url", entry.URL).Warnf("failed to validate cached link")
+
+		return true
+	}
+}
+
+// Remove drops cached entries of all namespaces matched by the filter and returns them.
+func (c *MediaCache) Remove(match func(entities.MediaFile) bool) []entities.MediaFile {
+	var (
+		keys    []Key
+		removed []entities.MediaFile
+	)
+
+	err := c.store.Range(func(key Key, entry Entry) bool {
+		if media := entry.Media(); match(media) {
+			keys = append(keys, key)
+			removed = append(removed, media)
+		}
+
+		return true
+	})
+	if err != nil {
+		c.logger.WithError(err).Warnf("failed to read cache")
+	}
+
+	if err := c.Delete(keys...); err != nil {
+		c.logger.WithError(err).Warnf("failed to update cache")
+	}
 
-	media, ok := c.cache[hash]
+	return removed
+}
 
-	return media, ok
+// Range calls fn for every cached entry until it returns false. Fn must not modify the cache.
+func (c *MediaCache) Range(fn func(key Key, entry Entry) bool) error {
+	return c.store.Range(fn) // nolint: wrapcheck
 }
 
-func (c *MediaCache) setHash(hash [16]byte, path, url string) {
-	c.mux.Lock()
-	defer c.mux.Unlock()
-	c.cache[hash] = cachedMedia{
-		Path: path,
-		URL:  url,
+// Delete removes entries by their keys.
+func (c *MediaCache) Delete(keys ...Key) error {
+	for _, key := range keys {
+		if err := c.store.Delete(key); err != nil {
+			return err // nolint: wrapcheck
+		}
+
+		c.track(key, nil)
+
+		if c.journal != nil {
+			if err := c.journal.append(journalDelete, key, nil); err != nil {
+				c.logger.WithError(err).Warnf("failed to update cache journal")
+			}
+		}
 	}
+
+	return nil
 }
 
-func (c *MediaCache) SaveFile(path string) error {
-	cache := make(map[string]cachedMedia)
-	for key, value := range c.cache {
-		cache[hex.EncodeToString(key[:])] = value
+// migrate moves legacy entries, which could be uploaded by current CDN, into its namespace.
+func (c *MediaCache) migrate() error {
+	if c.namespace == legacyNamespace {
+		return nil
+	}
+
+	type legacyEntry struct {
+		key   Key
+		entry Entry
 	}
 
-	data, err := json.MarshalIndent(cache, "", "  ")
+	var legacy []legacyEntry
+
+	err := c.store.Range(func(key Key, entry Entry) bool {
+		if key.Namespace == legacyNamespace && (entry.CDN == "" || slices.Contains(c.cdnTypes, entry.CDN)) {
+			legacy = append(legacy, legacyEntry{key: key, entry: entry})
+		}
+
+		return true
+	})
 	if err != nil {
-		return fmt.Errorf("marshal data: %w", err)
+		return fmt.Errorf("migrate cache: %w", err)
 	}
 
-	if err := os.WriteFile(path, data, 0o600); err != nil { // nolint: gosec,mnd
-		return fmt.Errorf("write file: %w", err)
+	for _, l := range legacy {
+		key := Key{Namespace: c.namespace, Hash: l.key.Hash}
+
+		if _, ok, err := c.store.Get(key); err != nil {
+			return fmt.Errorf("migrate cache: %w", err)
+		} else if !ok {
+			if err := c.store.Put(key, l.entry); err != nil {
+				return fmt.Errorf("migrate cache: %w", err)
+			}
+
+			c.track(key, &l.entry)
+		}
+
+		if err := c.store.Delete(l.key); err != nil {
+			return fmt.Errorf("migrate cache: %w", err)
+		}
+
+		c.track(l.key, nil)
 	}
 
 	return nil
 }
+
+// Put adds or replaces entry.
+func (c *MediaCache) Put(key Key, entry Entry) error {
+	if err := c.store.Put(key, entry); err != nil {
+		return err // nolint: wrapcheck
+	}
+
+	c.track(key, &entry)
+
+	if c.journal != nil {
+		if err := c.journal.append(journalPut, key, &entry); err != nil {
+			c.logger.WithError(err).Warnf("failed to update cache journal")
+		}
+	}
+
+	return nil
+}
+
+// track records change to be written by SaveFile. Entry is nil for deleted ones.
+func (c *MediaCache) track(key Key, entry *Entry) {
+	c.changesMux.Lock()
+	defer c.changesMux.Unlock()
+
+	c.changes[key] = entry
+}
+
+func (c *MediaCache) resetChanges() {
+	c.changesMux.Lock()
+	defer c.changesMux.Unlock()
+
+	clear(c.changes)
+}
+
+func (c *MediaCache) put(key Key, entry Entry) {
+	if err := c.Put(key, entry); err != nil {
+		c.logger.WithError(err).Warnf("failed to update cache")
+	}
+}
+
+// mediaContent describes media content without keeping it in memory.
+type mediaContent struct {
+	hash [md5.Size]byte
+	size int64
+	// head is the beginning of content used for type detection.
+	head []byte
+}
+
+// readContent hashes media content, streaming it from disk if data isn't loaded.
+func readContent(media entities.MediaFile) (mediaContent, error) {
+	var res mediaContent
+
+	r, err := media.Open()
+	if err != nil {
+		return res, err // nolint: wrapcheck
+	}
+	defer r.Close()
+
+	h := md5.New() // nolint: gosec
+
+	res.size, res.head, err = utils.ReadDigest(r, h)
+	if err != nil {
+		return res, fmt.Errorf("read media: %w", err)
+	}
+
+	copy(res.hash[:], h.Sum(nil))
+
+	return res, nil
+}
+
+func newEntry(media entities.MediaFile, content mediaContent) Entry {
+	now := time.Now().UTC()
+
+	entry := Entry{
+		Path:         media.Path,
+		URL:          media.URL,
+		CDN:          media.CDN,
+		DeleteHandle: media.DeleteHandle,
+		ExpiresAt:    media.ExpiresAt,
+		Size:         content.size,
+		ContentType:  utils.ContentType(media.Name, content.head),
+		CreatedAt:    now,
+		UsedAt:       now,
+		ValidatedAt:  now,
+	}
+
+	for _, mirror := range media.Mirrors {
+		entry.Mirrors = append(entry.Mirrors, Mirror(mirror))
+	}
+
+	return entry
+}
+
+// Media returns cached upload of the file at entry path.
+func (e Entry) Media() entities.MediaFile {
+	return e.apply(entities.MediaFile{Name: filepath.Base(e.Path), Path: e.Path})
+}
+
+func (e Entry) apply(media entities.MediaFile) entities.MediaFile {
+	media.URL = e.URL
+	media.CDN = e.CDN
+	media.DeleteHandle = e.DeleteHandle
+	media.ExpiresAt = e.ExpiresAt
+	media.Mirrors = nil
+
+	for _, mirror := range e.Mirrors {
+		media.Mirrors = append(media.Mirrors, entities.Mirror(mirror))
+	}
+
+	return media
+}
+
+// Validated returns time link was last known alive. It is zero for entries of old caches.
+func (e Entry) Validated() time.Time {
+	if e.ValidatedAt.IsZero() {
+		return e.CreatedAt
+	}
+
+	return e.ValidatedAt
+}
+
+// Expired reports whether entry link is not valid at given time anymore.
+func (e Entry) Expired(at time.Time) bool {
+	return !e.ExpiresAt.IsZero() && e.ExpiresAt.Before(at)
+}
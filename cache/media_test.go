@@ -0,0 +1,329 @@
+package cache_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5" // nolint: gosec
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bohdanch-w/go-tgupload/cache"
+	"github.com/bohdanch-w/go-tgupload/entities"
+	"github.com/bohdanch-w/go-tgupload/pkg/phash"
+
+	whlogger "github.com/bohdanch-w/wheel/logger"
+)
+
+type countingCDN struct {
+	prefix string
+	calls  int
+}
+
+func (c *countingCDN) Upload(_ context.Context, media entities.MediaFile) (entities.MediaFile, error) {
+	c.calls++
+	media.URL = c.prefix + media.Name
+
+	return media, nil
+}
+
+// legacyFile is the cache format without namespaces, keyed by md5 of content.
+const legacyFile = `{
+  "8b04d5e3775d298e78455efc5ca404d5": {"path": "first.png", "url": "https://s3/first.png", "cdn": "s3"},
+  "a9f0e61a137d86aa9db53465e0801612": {"path": "second.png", "url": "https://postimg/second.png", "cdn": "post-image"},
+  "0d3d8d3f4a2a5b6c8e1f0a9b8c7d6e5f": {"path": "third.png", "url": "https://old/third.png"}
+}`
+
+func TestMediaCacheNamespaces(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		path  = filepath.Join(t.TempDir(), "cache.json")
+		media = entities.MediaFile{Name: "first.png", Path: "first.png", Data: []byte("first")}
+	)
+
+	s3CDN := &countingCDN{prefix: "https://s3/"}
+	s3Cache := cache.New(s3CDN, whlogger.NewNullLogger(), cache.WithNamespace("s3{bucket=a}", "s3"))
+
+	require.NoError(t, s3Cache.LoadFile(path))
+
+	res, err := s3Cache.Upload(ctx, media)
+	require.NoError(t, err)
+	require.Equal(t, "https://s3/first.png", res.URL)
+	require.NoError(t, s3Cache.SaveFile(path))
+
+	otherCDN := &countingCDN{prefix: "https://other/"}
+	otherCache := cache.New(otherCDN, whlogger.NewNullLogger(), cache.WithNamespace("s3{bucket=b}", "s3"))
+
+	require.NoError(t, otherCache.LoadFile(path))
+
+	res, err = otherCache.Upload(ctx, media)
+	require.NoError(t, err)
+	require.Equal(t, "https://other/first.png", res.URL)
+	require.Equal(t, 1, otherCDN.calls)
+	require.NoError(t, otherCache.SaveFile(path))
+
+	// both namespaces are kept
+	s3Cache = cache.New(s3CDN, whlogger.NewNullLogger(), cache.WithNamespace("s3{bucket=a}", "s3"))
+	require.NoError(t, s3Cache.LoadFile(path))
+
+	res, err = s3Cache.Upload(ctx, media)
+	require.NoError(t, err)
+	require.Equal(t, "https://s3/first.png", res.URL)
+	require.Equal(t, 1, s3CDN.calls)
+}
+
+func TestMediaCacheMigration(t *testing.T) {
+	var (
+		ctx  = context.Background()
+		path = filepath.Join(t.TempDir(), "cache.json")
+	)
+
+	require.NoError(t, os.WriteFile(path, []byte(legacyFile), 0o600))
+
+	cdn := &countingCDN{prefix: "https://new/"}
+	mediaCache := cache.New(cdn, whlogger.NewNullLogger(), cache.WithNamespace("s3{bucket=a}", "s3"))
+
+	require.NoError(t, mediaCache.LoadFile(path))
+
+	// entry uploaded by the same CDN type is migrated
+	res, err := mediaCache.Upload(ctx, entities.MediaFile{Name: "first.png", Path: "first.png", Data: []byte("first")})
+	require.NoError(t, err)
+	require.Equal(t, "https://s3/first.png", res.URL)
+
+	// entry of other CDN is not reused
+	res, err = mediaCache.Upload(ctx, entities.MediaFile{Name: "second.png", Path: "second.png", Data: []byte("second")})
+	require.NoError(t, err)
+	require.Equal(t, "https://new/second.png", res.URL)
+	require.Equal(t, 1, cdn.calls)
+
+	require.NoError(t, mediaCache.SaveFile(path))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	var saved struct {
+		Version    int                                  `json:"version"`
+		Namespaces map[string]map[string]map[string]any `json:"namespaces"`
+	}
+
+	require.NoError(t, json.Unmarshal(data, &saved))
+	require.Equal(t, 2, saved.Version)
+	require.Len(t, saved.Namespaces["s3{bucket=a}"], 3)
+	require.Len(t, saved.Namespaces[""], 1, "entry of other CDN stays in legacy namespace")
+}
+
+func TestMediaCacheRevalidation(t *testing.T) {
+	var (
+		ctx      = context.Background()
+		now      = time.Now().UTC()
+		requests atomic.Int32
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/alive/"):
+		case strings.HasPrefix(r.URL.Path, "/get-only/") && r.Method == http.MethodGet:
+		case strings.HasPrefix(r.URL.Path, "/get-only/"):
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		case strings.HasPrefix(r.URL.Path, "/limited/"):
+			w.WriteHeader(http.StatusTooManyRequests)
+		case strings.HasPrefix(r.URL.Path, "/unavailable/"):
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	var (
+		alive       = cache.Key{Hash: md5.Sum([]byte("alive"))}       // nolint: gosec
+		getOnly     = cache.Key{Hash: md5.Sum([]byte("get-only"))}    // nolint: gosec
+		dead        = cache.Key{Hash: md5.Sum([]byte("dead"))}        // nolint: gosec
+		fresh       = cache.Key{Hash: md5.Sum([]byte("fresh"))}       // nolint: gosec
+		limited     = cache.Key{Hash: md5.Sum([]byte("limited"))}     // nolint: gosec
+		unavailable = cache.Key{Hash: md5.Sum([]byte("unavailable"))} // nolint: gosec
+		store       = cache.NewMemoryStore()
+		stale       = now.Add(-2 * time.Hour)
+		uploader    = &countingCDN{prefix: srv.URL + "/alive/new-"}
+	)
+
+	require.NoError(t, store.Put(alive, cache.Entry{URL: srv.URL + "/alive/alive.png", ValidatedAt: stale}))
+	require.NoError(t, store.Put(getOnly, cache.Entry{URL: srv.URL + "/get-only/get-only.png", ValidatedAt: stale}))
+	require.NoError(t, store.Put(dead, cache.Entry{URL: srv.URL + "/dead.png", CreatedAt: stale}))
+	require.NoError(t, store.Put(fresh, cache.Entry{URL: srv.URL + "/fresh.png", ValidatedAt: now}))
+	require.NoError(t, store.Put(limited, cache.Entry{URL: srv.URL + "/limited/limited.png", ValidatedAt: stale}))
+	require.NoError(t, store.Put(unavailable, cache.Entry{
+		URL: srv.URL + "/unavailable/unavailable.png", ValidatedAt: stale,
+	}))
+
+	mediaCache := cache.New(uploader, whlogger.NewNullLogger(),
+		cache.WithStore(store), cache.WithRevalidation(cache.TTL{"": time.Hour}, srv.Client()))
+
+	upload := func(name string) string {
+		res, err := mediaCache.Upload(ctx, entities.MediaFile{Name: name + ".png", Path: name + ".png", Data: []byte(name)})
+		require.NoError(t, err)
+
+		return res.URL
+	}
+
+	require.Equal(t, srv.URL+"/alive/alive.png", upload("alive"))
+	require.Equal(t, srv.URL+"/get-only/get-only.png", upload("get-only"))
+	require.Equal(t, srv.URL+"/alive/new-dead.png", upload("dead"))
+	require.Equal(t, 1, uploader.calls)
+	require.EqualValues(t, 4, requests.Load())
+
+	// rate limits and server errors don't prove the link is dead, it is reused and checked next time
+	require.Equal(t, srv.URL+"/limited/limited.png", upload("limited"))
+	require.Equal(t, srv.URL+"/unavailable/unavailable.png", upload("unavailable"))
+	require.Equal(t, 1, uploader.calls)
+	require.EqualValues(t, 6, requests.Load())
+
+	// recently validated links are reused without requests
+	require.Equal(t, srv.URL+"/fresh.png", upload("fresh"))
+	require.Equal(t, srv.URL+"/alive/alive.png", upload("alive"))
+	require.Equal(t, srv.URL+"/alive/new-dead.png", upload("dead"))
+	require.EqualValues(t, 6, requests.Load())
+
+	for _, key := range []cache.Key{limited, unavailable} {
+		entry, ok, err := store.Get(key)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, stale, entry.ValidatedAt, entry.URL)
+	}
+
+	for _, key := range []cache.Key{alive, getOnly, dead} {
+		entry, ok, err := store.Get(key)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.False(t, entry.ValidatedAt.Before(now), entry.URL)
+	}
+}
+
+func TestMediaCacheRevalidationPerCDN(t *testing.T) {
+	var requests atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	var (
+		store    = cache.NewMemoryStore()
+		stale    = time.Now().UTC().Add(-2 * time.Hour)
+		rotten   = cache.Key{Hash: md5.Sum([]byte("rotten"))} // nolint: gosec
+		kept     = cache.Key{Hash: md5.Sum([]byte("kept"))}   // nolint: gosec
+		uploader = &countingCDN{prefix: "https://new/"}
+	)
+
+	require.NoError(t, store.Put(rotten, cache.Entry{URL: srv.URL + "/rotten.png", CDN: "post-image", ValidatedAt: stale}))
+	require.NoError(t, store.Put(kept, cache.Entry{URL: srv.URL + "/kept.png", CDN: "s3", ValidatedAt: stale}))
+
+	mediaCache := cache.New(uploader, whlogger.NewNullLogger(),
+		cache.WithStore(store), cache.WithRevalidation(cache.TTL{"post-image": time.Hour}, srv.Client()))
+
+	upload := func(name string) string {
+		res, err := mediaCache.Upload(context.Background(),
+			entities.MediaFile{Name: name + ".png", Path: name + ".png", Data: []byte(name)})
+		require.NoError(t, err)
+
+		return res.URL
+	}
+
+	require.Equal(t, "https://new/rotten.png", upload("rotten"))
+	require.Equal(t, srv.URL+"/kept.png", upload("kept"), "links of CDN without ttl are not checked")
+	require.EqualValues(t, 1, requests.Load())
+}
+
+// testImage returns PNG and low quality JPEG encodings of generated image.
+func testImage(t *testing.T, seed int) ([]byte, []byte) {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, 300, 400))
+
+	for y := range 400 {
+		for x := range 300 {
+			v := uint8((x*255/300 + y*seed*255/400) % 256) // nolint: gosec
+			img.Set(x, y, color.RGBA{R: v, G: 255 - v, B: v / 2, A: 255})
+		}
+	}
+
+	var pngBuf, jpegBuf bytes.Buffer
+
+	require.NoError(t, png.Encode(&pngBuf, img))
+	require.NoError(t, jpeg.Encode(&jpegBuf, img, &jpeg.Options{Quality: 40}))
+
+	return pngBuf.Bytes(), jpegBuf.Bytes()
+}
+
+func TestMediaCacheSimilarity(t *testing.T) {
+	var (
+		ctx               = context.Background()
+		original, resaved = testImage(t, 1)
+		_, other          = testImage(t, 3)
+	)
+
+	upload := func(mediaCache *cache.MediaCache, name string, data []byte) string {
+		res, err := mediaCache.Upload(ctx, entities.MediaFile{Name: name, Path: name, Data: data})
+		require.NoError(t, err)
+
+		return res.URL
+	}
+
+	t.Run("warn", func(t *testing.T) {
+		cdn := &countingCDN{prefix: "https://cdn/"}
+		mediaCache := cache.New(cdn, whlogger.NewNullLogger(), cache.WithSimilarity(phash.DefaultDistance, false))
+
+		require.Equal(t, "https://cdn/01.png", upload(mediaCache, "01.png", original))
+		require.Equal(t, "https://cdn/01.jpg", upload(mediaCache, "01.jpg", resaved))
+		require.Equal(t, 2, cdn.calls)
+	})
+
+	t.Run("reuse", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "cache.json")
+		cdn := &countingCDN{prefix: "https://cdn/"}
+
+		mediaCache := cache.New(cdn, whlogger.NewNullLogger())
+		require.Equal(t, "https://cdn/01.png", upload(mediaCache, "01.png", original))
+		require.NoError(t, mediaCache.SaveFile(path))
+
+		// entries cached before similarity matching get hashes on use
+		mediaCache = cache.New(cdn, whlogger.NewNullLogger(), cache.WithSimilarity(phash.DefaultDistance, true))
+		require.NoError(t, mediaCache.LoadFile(path))
+		require.Equal(t, "https://cdn/01.png", upload(mediaCache, "01.png", original))
+		require.NoError(t, mediaCache.SaveFile(path))
+
+		mediaCache = cache.New(cdn, whlogger.NewNullLogger(), cache.WithSimilarity(phash.DefaultDistance, true))
+		require.NoError(t, mediaCache.LoadFile(path))
+		require.Equal(t, "https://cdn/01.png", upload(mediaCache, "01.jpg", resaved))
+		require.Equal(t, "https://cdn/02.jpg", upload(mediaCache, "02.jpg", other))
+		require.Equal(t, 2, cdn.calls)
+
+		paths := map[string]string{}
+		require.NoError(t, mediaCache.Range(func(_ cache.Key, entry cache.Entry) bool {
+			require.NotEmpty(t, entry.PHash, entry.Path)
+			paths[entry.Path] = entry.URL
+
+			return true
+		}))
+		require.Equal(t, map[string]string{
+			"01.png": "https://cdn/01.png",
+			"01.jpg": "https://cdn/01.png",
+			"02.jpg": "https://cdn/02.jpg",
+		}, paths)
+	})
+}
@@ -0,0 +1,156 @@
+package cache_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bohdanch-w/go-tgupload/cache"
+	"github.com/bohdanch-w/go-tgupload/entities"
+	"github.com/bohdanch-w/go-tgupload/internal/testproc"
+
+	whlogger "github.com/bohdanch-w/wheel/logger"
+)
+
+// TestHelperProcess is not a real test, but the entry point of processes started by testproc.
+func TestHelperProcess(t *testing.T) {
+	testproc.Main(t, map[string]testproc.Helper{
+		"upload":   uploadHelper,
+		"crash":    crashHelper,
+		"sessions": sessionsHelper,
+	})
+}
+
+func openHelperCache(path string) (*cache.MediaCache, error) {
+	return cache.Open(path, &countingCDN{prefix: "https://cdn/"}, whlogger.NewNullLogger(),
+		cache.WithNamespace("s3", "s3"))
+}
+
+// uploadHelper uploads files to the cache: upload <path> <name> <count>.
+func uploadHelper(args []string) error {
+	mediaCache, err := openHelperCache(args[0])
+	if err != nil {
+		return err
+	}
+
+	count, err := strconv.Atoi(args[2])
+	if err != nil {
+		return err
+	}
+
+	for i := range count {
+		name := fmt.Sprintf("%s-%02d.png", args[1], i)
+
+		_, err := mediaCache.Upload(context.Background(), entities.MediaFile{Name: name, Path: name, Data: []byte(name)})
+		if err != nil {
+			return err
+		}
+	}
+
+	return mediaCache.Close()
+}
+
+// sessionsHelper uploads each file in separate cache session: sessions <path> <name> <count>.
+func sessionsHelper(args []string) error {
+	count, err := strconv.Atoi(args[2])
+	if err != nil {
+		return err
+	}
+
+	for i := range count {
+		if err := uploadHelper([]string{args[0], fmt.Sprintf("%s-%02d", args[1], i), "1"}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// crashHelper uploads files and exits without closing the cache in the middle
+// of writing next journal record: crash <path> <name>...
+func crashHelper(args []string) error {
+	path := args[0]
+
+	mediaCache, err := openHelperCache(path)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range args[1:] {
+		_, err := mediaCache.Upload(context.Background(), entities.MediaFile{Name: name, Path: name, Data: []byte(name)})
+		if err != nil {
+			return err
+		}
+	}
+
+	journals, err := filepath.Glob(path + ".*.journal")
+	if err != nil || len(journals) != 1 {
+		return fmt.Errorf("find journal: %v %w", journals, err)
+	}
+
+	f, err := os.OpenFile(journals[0], os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.WriteString(`{"op":"put","namesp`)
+
+	return err
+}
+
+func TestConcurrentProcesses(t *testing.T) {
+	testConcurrentProcesses(t, "upload")
+}
+
+// TestConcurrentSessions checks that journals closed by one process while replayed by other are not lost.
+func TestConcurrentSessions(t *testing.T) {
+	testConcurrentProcesses(t, "sessions")
+}
+
+func testConcurrentProcesses(t *testing.T, helper string) {
+	t.Helper()
+
+	const (
+		processes = 4
+		files     = 25
+	)
+
+	path := filepath.Join(t.TempDir(), "cache.json")
+
+	cmds := make([]*exec.Cmd, processes)
+	outputs := make([]bytes.Buffer, processes)
+
+	for i := range cmds {
+		cmds[i] = testproc.Command(helper, path, "process"+strconv.Itoa(i), strconv.Itoa(files))
+		cmds[i].Stdout = &outputs[i]
+		cmds[i].Stderr = &outputs[i]
+
+		require.NoError(t, cmds[i].Start())
+	}
+
+	for i, cmd := range cmds {
+		require.NoError(t, cmd.Wait(), outputs[i].String())
+	}
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	var saved struct {
+		Namespaces map[string]map[string]any `json:"namespaces"`
+	}
+
+	require.NoError(t, json.Unmarshal(data, &saved))
+	require.Len(t, saved.Namespaces["s3"], processes*files, "entries of all processes are merged")
+
+	journals, err := filepath.Glob(path + ".*.journal")
+	require.NoError(t, err)
+	require.Empty(t, journals)
+}
@@ -0,0 +1,156 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/bohdanch-w/go-tgupload/entities"
+	"github.com/bohdanch-w/go-tgupload/pkg/phash"
+	"github.com/bohdanch-w/go-tgupload/pkg/utils"
+)
+
+// WithSimilarity makes images, which are not identical to cached ones, matched by perceptual hash
+// within the Hamming distance, e.g. copies of the same page saved with other JPEG settings.
+// Near-duplicates are reused if reuse is set, otherwise they are only reported.
+func WithSimilarity(distance int, reuse bool) Option {
+	return func(c *MediaCache) {
+		c.similar = &similarIndex{
+			distance: distance,
+			reuse:    reuse,
+			hashes:   make(map[Key]phash.Hash),
+		}
+	}
+}
+
+// similarIndex keeps perceptual hashes of cached images of the namespace.
+// It is loaded from the store on first use.
+type similarIndex struct {
+	distance int
+	reuse    bool
+
+	load   sync.Once
+	mux    sync.Mutex
+	hashes map[Key]phash.Hash
+}
+
+func (s *similarIndex) add(key Key, hash phash.Hash) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.hashes[key] = hash
+}
+
+// nearest returns key of the most similar image within the distance, other than the given one.
+func (s *similarIndex) nearest(key Key, hash phash.Hash) (Key, int, bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	var (
+		found    Key
+		distance = s.distance + 1
+	)
+
+	for k, h := range s.hashes {
+		if d := hash.Distance(h); k != key && d < distance {
+			found, distance = k, d
+		}
+	}
+
+	return found, distance, distance <= s.distance
+}
+
+func (c *MediaCache) loadSimilar() {
+	c.similar.load.Do(func() {
+		err := c.store.Range(func(key Key, entry Entry) bool {
+			if key.Namespace != c.namespace || entry.PHash == "" {
+				return true
+			}
+
+			if hash, err := phash.Parse(entry.PHash); err == nil {
+				c.similar.add(key, hash)
+			}
+
+			return true
+		})
+		if err != nil {
+			c.logger.WithError(err).Warnf("failed to read perceptual hashes of cache")
+		}
+	})
+}
+
+// perceptualHash returns hash of the image, if similarity matching is enabled and it can be decoded.
+func (c *MediaCache) perceptualHash(media entities.MediaFile) (phash.Hash, bool) {
+	if c.similar == nil {
+		return 0, false
+	}
+
+	data, err := media.Content()
+	if err != nil {
+		c.logger.WithError(err).With("path", media.Path).Warnf("failed to read image")
+
+		return 0, false
+	}
+
+	hash, err := phash.Compute(data)
+	if err != nil {
+		c.logger.WithError(err).With("path", media.Path).Debugf("perceptual hash is not computed")
+
+		return 0, false
+	}
+
+	return hash, true
+}
+
+// reuseSimilar reports cached near-duplicate of the image and returns its upload, if reuse is enabled.
+// Reused link is saved for the image as well, so that next time it is matched exactly.
+func (c *MediaCache) reuseSimilar(
+	ctx context.Context,
+	key Key,
+	hash phash.Hash,
+	media entities.MediaFile,
+	content mediaContent,
+) (entities.MediaFile, bool) {
+	c.loadSimilar()
+
+	similarKey, distance, ok := c.similar.nearest(key, hash)
+	if !ok {
+		return media, false
+	}
+
+	similar, ok, err := c.store.Get(similarKey)
+	if err != nil || !ok {
+		return media, false
+	}
+
+	logger := c.logger.With("path", media.Path).With("similar", similar.Path).With("distance", distance)
+
+	if !c.similar.reuse {
+		logger.Warnf("image is near-duplicate of uploaded one")
+
+		return media, false
+	}
+
+	if similar.Expired(time.Now().Add(expiryMargin)) || !c.revalidate(ctx, &similar) {
+		return media, false
+	}
+
+	logger.Warnf("reusing upload of near-duplicate image")
+
+	now := time.Now().UTC()
+
+	similar.UsedAt = now
+	c.put(similarKey, similar)
+
+	entry := similar
+	entry.Path = media.Path
+	entry.Size = content.size
+	entry.ContentType = utils.ContentType(media.Name, content.head)
+	entry.PHash = hash.String()
+	entry.CreatedAt = now
+
+	c.put(key, entry)
+	c.similar.add(key, hash)
+
+	return similar.apply(media), true
+}
@@ -0,0 +1,111 @@
+package cache
+
+import (
+	"crypto/md5" // nolint: gosec
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// Key identifies cached upload by CDN namespace and md5 hash of content.
+type Key struct {
+	Namespace string
+	Hash      [md5.Size]byte
+}
+
+// HashString returns hex encoded content hash.
+func (k Key) HashString() string {
+	return hex.EncodeToString(k.Hash[:])
+}
+
+// Entry is cached upload with its metadata.
+type Entry struct {
+	Path         string    `json:"path"`
+	URL          string    `json:"url"`
+	CDN          string    `json:"cdn,omitempty"`
+	DeleteHandle string    `json:"delete_handle,omitempty"`
+	ExpiresAt    time.Time `json:"expires_at,omitzero"`
+	Mirrors      []Mirror  `json:"mirrors,omitempty"`
+	Size         int64     `json:"size,omitempty"`
+	ContentType  string    `json:"content_type,omitempty"`
+	CreatedAt    time.Time `json:"created_at,omitzero"`
+	UsedAt       time.Time `json:"used_at,omitzero"`
+	ValidatedAt  time.Time `json:"validated_at,omitzero"`
+	// PHash is perceptual hash of the image, if similarity matching was enabled on upload.
+	PHash string `json:"phash,omitempty"`
+}
+
+type Mirror struct {
+	CDN          string    `json:"cdn"`
+	URL          string    `json:"url"`
+	DeleteHandle string    `json:"delete_handle,omitempty"`
+	ExpiresAt    time.Time `json:"expires_at,omitzero"`
+}
+
+// Store keeps cached entries. Implementations are safe for concurrent use.
+type Store interface {
+	Get(key Key) (Entry, bool, error)
+	Put(key Key, entry Entry) error
+	Delete(key Key) error
+	// Range calls fn for every entry until it returns false. Fn must not modify the store.
+	Range(fn func(key Key, entry Entry) bool) error
+	Close() error
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore creates store, which keeps entries in memory only.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries: make(map[Key]Entry),
+	}
+}
+
+type MemoryStore struct {
+	entries map[Key]Entry
+	mux     sync.RWMutex
+}
+
+func (s *MemoryStore) Get(key Key) (Entry, bool, error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	entry, ok := s.entries[key]
+
+	return entry, ok, nil
+}
+
+func (s *MemoryStore) Put(key Key, entry Entry) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.entries[key] = entry
+
+	return nil
+}
+
+func (s *MemoryStore) Delete(key Key) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	delete(s.entries, key)
+
+	return nil
+}
+
+func (s *MemoryStore) Range(fn func(key Key, entry Entry) bool) error {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	for key, entry := range s.entries {
+		if !fn(key, entry) {
+			break
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
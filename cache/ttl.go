@@ -0,0 +1,52 @@
+package cache
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bohdanch-w/go-tgupload/entities"
+)
+
+const errInvalidTTL = entities.Error("invalid cache ttl")
+
+// TTL is the period cached links are trusted without validation, keyed by CDN type the link
+// is stored at, since hosts remove files differently. Empty key sets the period of other types.
+// Zero period disables validation.
+type TTL map[string]time.Duration
+
+// Of returns the period of links stored at CDN of the type.
+func (t TTL) Of(cdn string) time.Duration {
+	if d, ok := t[cdn]; ok {
+		return d
+	}
+
+	return t[""]
+}
+
+// ParseTTL parses comma separated periods of CDN types, e.g. "post-image=168h,s3=24h".
+// Period without type, e.g. "168h", applies to other types.
+func ParseTTL(s string) (TTL, error) {
+	ttl := make(TTL)
+
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		cdn, value, ok := strings.Cut(item, "=")
+		if !ok {
+			cdn, value = "", item
+		}
+
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("%w: %q", errInvalidTTL, item)
+		}
+
+		ttl[strings.TrimSpace(cdn)] = d
+	}
+
+	return ttl, nil
+}
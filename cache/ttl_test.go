@@ -0,0 +1,28 @@
+package cache_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bohdanch-w/go-tgupload/cache"
+)
+
+func TestParseTTL(t *testing.T) {
+	ttl, err := cache.ParseTTL("post-image=168h, s3=24h")
+	require.NoError(t, err)
+	require.Equal(t, 168*time.Hour, ttl.Of("post-image"))
+	require.Equal(t, 24*time.Hour, ttl.Of("s3"))
+	require.Zero(t, ttl.Of("azblob"), "other types are not validated")
+
+	ttl, err = cache.ParseTTL("72h,post-image=168h")
+	require.NoError(t, err)
+	require.Equal(t, 168*time.Hour, ttl.Of("post-image"))
+	require.Equal(t, 72*time.Hour, ttl.Of("azblob"))
+
+	for _, invalid := range []string{"week", "s3=", "s3=-1h"} {
+		_, err := cache.ParseTTL(invalid)
+		require.Error(t, err, invalid)
+	}
+}
@@ -0,0 +1,193 @@
+package cache
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/bohdanch-w/go-tgupload/cache"
+
+	whlogger "github.com/bohdanch-w/wheel/logger"
+)
+
+const (
+	Name = "cache"
+
+	logLevelFlag  = "loglevel"
+	cacheFlag     = "cache"
+	dryRunFlag    = "dry-run"
+	namespaceFlag = "namespace"
+	pathFlag      = "path"
+	urlFlag       = "url"
+	sinceFlag     = "since"
+	untilFlag     = "until"
+
+	logLevelDefault = "INFO"
+	dateLayout      = "2006-01-02"
+	// legacyNamespace is shown for entries of old cache files without CDN configuration.
+	legacyNamespace = "(legacy)"
+)
+
+func NewCMD(logger whlogger.Logger) *cli.Command {
+	return &cli.Command{
+		Name:  Name,
+		Usage: "inspect and maintain upload cache",
+		Subcommands: []*cli.Command{
+			newStatsCMD(logger),
+			newLsCMD(logger),
+			newPruneCMD(logger),
+			newVerifyCMD(logger),
+			newExportCMD(logger),
+			newImportCMD(logger),
+			newRmCMD(logger),
+		},
+	}
+}
+
+// commonFlags are flags of every subcommand, followed by the given ones.
+func commonFlags(flags ...cli.Flag) []cli.Flag {
+	return append([]cli.Flag{
+		&cli.StringFlag{
+			Name:  logLevelFlag,
+			Usage: "level of logging for application",
+			Value: logLevelDefault,
+		},
+		&cli.StringFlag{
+			Name:     cacheFlag,
+			Usage:    "path to cache, the same as used with post and upload",
+			Required: true,
+		},
+	}, flags...)
+}
+
+// filterFlags select entries by their namespace, path, URL and upload date.
+func filterFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  namespaceFlag,
+			Usage: "only entries of CDN configuration, as shown by stats",
+		},
+		&cli.StringFlag{
+			Name:  pathFlag,
+			Usage: "only entries with local path matching the glob pattern or containing the value",
+		},
+		&cli.StringFlag{
+			Name:  urlFlag,
+			Usage: "only entries with URL containing the value",
+		},
+		&cli.TimestampFlag{
+			Name:   sinceFlag,
+			Usage:  "only entries uploaded at or after the date, e.g. 2024-01-31",
+			Layout: dateLayout,
+		},
+		&cli.TimestampFlag{
+			Name:   untilFlag,
+			Usage:  "only entries uploaded before the date",
+			Layout: dateLayout,
+		},
+	}
+}
+
+// openCache opens cache from the command flags. Unless create is set, it must exist.
+func openCache(ctx *cli.Context, logger whlogger.Logger, create bool) (*cache.MediaCache, whlogger.Logger, error) {
+	var logLevel whlogger.LogLevel
+	if err := logLevel.UnmarshalText([]byte(ctx.String(logLevelFlag))); err != nil {
+		return nil, nil, fmt.Errorf("parse loglevel: %w", err)
+	}
+
+	logger = logger.WithLevel(logLevel)
+	path := ctx.String(cacheFlag)
+
+	if _, err := os.Stat(path); err != nil && !create {
+		return nil, nil, fmt.Errorf("open cache: %w", err)
+	}
+
+	mediaCache, err := cache.Open(path, nil, logger)
+	if err != nil {
+		return nil, nil, fmt.Errorf("open cache: %w", err)
+	}
+
+	return mediaCache, logger, nil
+}
+
+// closeCache saves changes of the cache, which failure is the command error.
+func closeCache(mediaCache *cache.MediaCache, err *error) {
+	if closeErr := mediaCache.Close(); closeErr != nil && *err == nil {
+		*err = fmt.Errorf("save cache: %w", closeErr)
+	}
+}
+
+// entryFilter builds filter from filterFlags values.
+func entryFilter(ctx *cli.Context) func(key cache.Key, entry cache.Entry) bool {
+	var (
+		namespace    = ctx.String(namespaceFlag)
+		hasNamespace = ctx.IsSet(namespaceFlag)
+		path         = ctx.String(pathFlag)
+		url          = ctx.String(urlFlag)
+		since        = ctx.Timestamp(sinceFlag)
+		until        = ctx.Timestamp(untilFlag)
+	)
+
+	return func(key cache.Key, entry cache.Entry) bool {
+		switch {
+		case hasNamespace && namespace != displayNamespace(key.Namespace):
+			return false
+		case path != "" && !matchPath(path, entry.Path):
+			return false
+		case url != "" && !strings.Contains(entry.URL, url):
+			return false
+		case since != nil && entry.CreatedAt.Before(*since):
+			return false
+		case until != nil && !entry.CreatedAt.Before(*until):
+			return false
+		}
+
+		return true
+	}
+}
+
+func matchPath(pattern, path string) bool {
+	if ok, err := filepath.Match(pattern, path); err == nil && ok {
+		return true
+	}
+
+	return strings.Contains(path, pattern)
+}
+
+func displayNamespace(namespace string) string {
+	if namespace == "" {
+		return legacyNamespace
+	}
+
+	return namespace
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+
+	return t.Local().Format(time.DateTime)
+}
+
+// keysOf returns keys of entries matched by the filter.
+func keysOf(mediaCache *cache.MediaCache, match func(key cache.Key, entry cache.Entry) bool) ([]cache.Key, error) {
+	var keys []cache.Key
+
+	err := mediaCache.Range(func(key cache.Key, entry cache.Entry) bool {
+		if match(key, entry) {
+			keys = append(keys, key)
+		}
+
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read cache: %w", err)
+	}
+
+	return keys, nil
+}
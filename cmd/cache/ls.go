@@ -0,0 +1,56 @@
+package cache
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/bohdanch-w/go-tgupload/cache"
+	"github.com/bohdanch-w/go-tgupload/pkg/utils"
+
+	whlogger "github.com/bohdanch-w/wheel/logger"
+)
+
+const lsName = "ls"
+
+func newLsCMD(logger whlogger.Logger) *cli.Command {
+	return &cli.Command{
+		Name:   lsName,
+		Usage:  "list cached entries",
+		Flags:  commonFlags(filterFlags()...),
+		Action: lsCmd{logger: logger}.run,
+	}
+}
+
+type lsCmd struct {
+	logger whlogger.Logger
+}
+
+func (cmd lsCmd) run(ctx *cli.Context) (err error) {
+	mediaCache, _, err := openCache(ctx, cmd.logger, false)
+	if err != nil {
+		return err
+	}
+	defer closeCache(mediaCache, &err)
+
+	match := entryFilter(ctx)
+
+	err = mediaCache.Range(func(key cache.Key, entry cache.Entry) bool {
+		if !match(key, entry) {
+			return true
+		}
+
+		fmt.Printf( // nolint: forbidigo
+			"%s  %s  %8s  %s  %s\n  %s\n",
+			key.HashString(), formatTime(entry.CreatedAt), utils.FormatSize(entry.Size),
+			displayNamespace(key.Namespace), entry.Path, entry.URL,
+		)
+
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("read cache: %w", err)
+	}
+
+	return nil
+}
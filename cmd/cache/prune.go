@@ -0,0 +1,130 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/bohdanch-w/go-tgupload/cache"
+	"github.com/bohdanch-w/go-tgupload/entities"
+
+	whlogger "github.com/bohdanch-w/wheel/logger"
+)
+
+const (
+	pruneName     = "prune"
+	olderThanFlag = "older-than"
+	missingFlag   = "missing"
+)
+
+func newPruneCMD(logger whlogger.Logger) *cli.Command {
+	return &cli.Command{
+		Name:  pruneName,
+		Usage: "remove cache entries, uploaded files are kept on CDN",
+		Flags: commonFlags(
+			&cli.DurationFlag{
+				Name:  olderThanFlag,
+				Usage: "remove entries not used within the period, e.g. 720h",
+			},
+			&cli.BoolFlag{
+				Name:  missingFlag,
+				Usage: "remove entries, which local file no longer exists",
+			},
+			&cli.StringFlag{
+				Name:  namespaceFlag,
+				Usage: "remove entries of CDN configuration, as shown by stats",
+			},
+			&cli.BoolFlag{
+				Name:  dryRunFlag,
+				Usage: "only list entries to remove",
+			},
+		),
+		Action: pruneCmd{logger: logger}.run,
+	}
+}
+
+type pruneCmd struct {
+	logger whlogger.Logger
+}
+
+func (cmd pruneCmd) run(ctx *cli.Context) (err error) {
+	if !ctx.IsSet(olderThanFlag) && !ctx.Bool(missingFlag) && !ctx.IsSet(namespaceFlag) {
+		return entities.Error("no prune criteria specified")
+	}
+
+	mediaCache, _, err := openCache(ctx, cmd.logger, false)
+	if err != nil {
+		return err
+	}
+	defer closeCache(mediaCache, &err)
+
+	dryRun := ctx.Bool(dryRunFlag)
+	match := pruneFilter(ctx, time.Now())
+
+	keys, err := keysOf(mediaCache, func(key cache.Key, entry cache.Entry) bool {
+		if !match(key, entry) {
+			return false
+		}
+
+		if dryRun {
+			fmt.Println(key.HashString(), entry.Path) // nolint: forbidigo
+		}
+
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	action := "removed"
+	if dryRun {
+		action = "to remove"
+	} else if err := mediaCache.Delete(keys...); err != nil {
+		return fmt.Errorf("remove entries: %w", err)
+	}
+
+	fmt.Printf("%s %d entries\n", action, len(keys)) // nolint: forbidigo
+
+	return nil
+}
+
+// pruneFilter matches entries meeting all specified criteria.
+func pruneFilter(ctx *cli.Context, now time.Time) func(key cache.Key, entry cache.Entry) bool {
+	var (
+		olderThan    = ctx.Duration(olderThanFlag)
+		hasOlderThan = ctx.IsSet(olderThanFlag)
+		missing      = ctx.Bool(missingFlag)
+		namespace    = ctx.String(namespaceFlag)
+		hasNamespace = ctx.IsSet(namespaceFlag)
+	)
+
+	return func(key cache.Key, entry cache.Entry) bool {
+		if hasNamespace && namespace != displayNamespace(key.Namespace) {
+			return false
+		}
+
+		if hasOlderThan && !lastUsed(entry).Before(now.Add(-olderThan)) {
+			return false
+		}
+
+		if missing {
+			if _, err := os.Stat(entry.Path); !errors.Is(err, os.ErrNotExist) {
+				return false
+			}
+		}
+
+		return true
+	}
+}
+
+// lastUsed returns time of the last cache hit or upload. It is zero for entries of old caches.
+func lastUsed(entry cache.Entry) time.Time {
+	if entry.UsedAt.IsZero() {
+		return entry.CreatedAt
+	}
+
+	return entry.UsedAt
+}
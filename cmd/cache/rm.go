@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"crypto/md5" // nolint: gosec
+	"fmt"
+	"path/filepath"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/bohdanch-w/go-tgupload/cache"
+	"github.com/bohdanch-w/go-tgupload/entities"
+
+	whlogger "github.com/bohdanch-w/wheel/logger"
+)
+
+const (
+	rmName = "rm"
+
+	errNoEntries = entities.Error("no cache entries matched")
+)
+
+func newRmCMD(logger whlogger.Logger) *cli.Command {
+	return &cli.Command{
+		Name:      rmName,
+		Usage:     "remove cache entries by local file path or content hash, uploaded files are kept on CDN",
+		ArgsUsage: "<path|hash>...",
+		Flags:     commonFlags(),
+		Action:    rmCmd{logger: logger}.run,
+	}
+}
+
+type rmCmd struct {
+	logger whlogger.Logger
+}
+
+func (cmd rmCmd) run(ctx *cli.Context) (err error) {
+	targets := ctx.Args().Slice()
+	if len(targets) == 0 {
+		return entities.Error("no entries specified")
+	}
+
+	mediaCache, _, err := openCache(ctx, cmd.logger, false)
+	if err != nil {
+		return err
+	}
+	defer closeCache(mediaCache, &err)
+
+	keys, err := keysOf(mediaCache, newMatcher(targets))
+	if err != nil {
+		return err
+	}
+
+	if len(keys) == 0 {
+		return errNoEntries
+	}
+
+	if err := mediaCache.Delete(keys...); err != nil {
+		return fmt.Errorf("remove entries: %w", err)
+	}
+
+	fmt.Printf("removed %d entries\n", len(keys)) // nolint: forbidigo
+
+	return nil
+}
+
+// newMatcher matches entries by content hash or local file path.
+func newMatcher(targets []string) func(key cache.Key, entry cache.Entry) bool {
+	var (
+		hashes = make(map[[md5.Size]byte]bool)
+		paths  = make(map[string]bool)
+	)
+
+	for _, target := range targets {
+		if hash, err := cache.ParseHash(target); err == nil {
+			hashes[hash] = true
+
+			continue
+		}
+
+		if abs, err := filepath.Abs(target); err == nil {
+			paths[abs] = true
+		}
+	}
+
+	return func(key cache.Key, entry cache.Entry) bool {
+		if hashes[key.Hash] {
+			return true
+		}
+
+		abs, err := filepath.Abs(entry.Path)
+
+		return err == nil && paths[abs]
+	}
+}
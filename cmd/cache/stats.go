@@ -0,0 +1,109 @@
+package cache
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/bohdanch-w/go-tgupload/cache"
+	"github.com/bohdanch-w/go-tgupload/pkg/utils"
+
+	whlogger "github.com/bohdanch-w/wheel/logger"
+)
+
+const statsName = "stats"
+
+func newStatsCMD(logger whlogger.Logger) *cli.Command {
+	return &cli.Command{
+		Name:   statsName,
+		Usage:  "show number of cached entries and size of uploaded files per CDN configuration",
+		Flags:  commonFlags(),
+		Action: statsCmd{logger: logger}.run,
+	}
+}
+
+type statsCmd struct {
+	logger whlogger.Logger
+}
+
+type namespaceStats struct {
+	entries int
+	size    int64
+	oldest  time.Time
+	newest  time.Time
+}
+
+func (cmd statsCmd) run(ctx *cli.Context) (err error) {
+	mediaCache, _, err := openCache(ctx, cmd.logger, false)
+	if err != nil {
+		return err
+	}
+	defer closeCache(mediaCache, &err)
+
+	var (
+		stats = make(map[string]*namespaceStats)
+		total namespaceStats
+	)
+
+	err = mediaCache.Range(func(key cache.Key, entry cache.Entry) bool {
+		ns, ok := stats[key.Namespace]
+		if !ok {
+			ns = &namespaceStats{}
+			stats[key.Namespace] = ns
+		}
+
+		ns.add(entry)
+		total.add(entry)
+
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("read cache: %w", err)
+	}
+
+	namespaces := make([]string, 0, len(stats))
+	for ns := range stats {
+		namespaces = append(namespaces, ns)
+	}
+
+	slices.Sort(namespaces)
+
+	for _, ns := range namespaces {
+		s := stats[ns]
+
+		fmt.Println(displayNamespace(ns)) // nolint: forbidigo
+		fmt.Printf(                       // nolint: forbidigo
+			"  %d entries, %s, uploaded %s .. %s\n",
+			s.entries, utils.FormatSize(s.size), formatTime(s.oldest), formatTime(s.newest),
+		)
+	}
+
+	fmt.Printf( // nolint: forbidigo
+		"total: %d entries in %d namespaces, %s uploaded\n",
+		total.entries, len(stats), utils.FormatSize(total.size),
+	)
+
+	if info, statErr := os.Stat(ctx.String(cacheFlag)); statErr == nil {
+		fmt.Printf("cache file: %s\n", utils.FormatSize(info.Size())) // nolint: forbidigo
+	}
+
+	return nil
+}
+
+func (s *namespaceStats) add(entry cache.Entry) {
+	s.entries++
+	s.size += entry.Size
+
+	if created := entry.CreatedAt; !created.IsZero() {
+		if s.oldest.IsZero() || created.Before(s.oldest) {
+			s.oldest = created
+		}
+
+		if created.After(s.newest) {
+			s.newest = created
+		}
+	}
+}
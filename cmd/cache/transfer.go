@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/bohdanch-w/go-tgupload/entities"
+
+	whlogger "github.com/bohdanch-w/wheel/logger"
+)
+
+const (
+	exportName = "export"
+	importName = "import"
+)
+
+func newExportCMD(logger whlogger.Logger) *cli.Command {
+	return &cli.Command{
+		Name:      exportName,
+		Usage:     "write cached entries to JSON file, e.g. to share uploads with teammates",
+		ArgsUsage: "<file>",
+		Flags:     commonFlags(filterFlags()...),
+		Action:    exportCmd{logger: logger}.run,
+	}
+}
+
+type exportCmd struct {
+	logger whlogger.Logger
+}
+
+func (cmd exportCmd) run(ctx *cli.Context) (err error) {
+	if ctx.NArg() != 1 {
+		return entities.Error("expected single output file")
+	}
+
+	mediaCache, _, err := openCache(ctx, cmd.logger, false)
+	if err != nil {
+		return err
+	}
+	defer closeCache(mediaCache, &err)
+
+	if err := mediaCache.ExportFile(ctx.Args().First(), entryFilter(ctx)); err != nil {
+		return fmt.Errorf("export cache: %w", err)
+	}
+
+	return nil
+}
+
+func newImportCMD(logger whlogger.Logger) *cli.Command {
+	return &cli.Command{
+		Name: importName,
+		Usage: "add entries of exported JSON file to the cache. Existing entries are replaced " +
+			"only by ones uploaded later",
+		ArgsUsage: "<file>",
+		Flags:     commonFlags(),
+		Action:    importCmd{logger: logger}.run,
+	}
+}
+
+type importCmd struct {
+	logger whlogger.Logger
+}
+
+func (cmd importCmd) run(ctx *cli.Context) (err error) {
+	if ctx.NArg() != 1 {
+		return entities.Error("expected single input file")
+	}
+
+	mediaCache, _, err := openCache(ctx, cmd.logger, true)
+	if err != nil {
+		return err
+	}
+	defer closeCache(mediaCache, &err)
+
+	imported, err := mediaCache.ImportFile(ctx.Args().First())
+	if err != nil {
+		return fmt.Errorf("import cache: %w", err)
+	}
+
+	fmt.Printf("imported %d entries\n", imported) // nolint: forbidigo
+
+	return nil
+}
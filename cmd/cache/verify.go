@@ -0,0 +1,177 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"golang.org/x/sync/semaphore"
+
+	"github.com/bohdanch-w/go-tgupload/cache"
+
+	whlogger "github.com/bohdanch-w/wheel/logger"
+)
+
+const (
+	verifyName   = "verify"
+	parallelFlag = "parallel"
+
+	parallelDefault      = 8
+	verifyRequestTimeout = 30 * time.Second
+)
+
+func newVerifyCMD(logger whlogger.Logger) *cli.Command {
+	return &cli.Command{
+		Name: verifyName,
+		Usage: "check that cached URLs are still served and remove dead or expired entries, " +
+			"so files are uploaded again",
+		Flags: commonFlags(append(
+			filterFlags(),
+			&cli.UintFlag{
+				Name:  parallelFlag,
+				Usage: "number of concurrent requests",
+				Value: parallelDefault,
+			},
+			&cli.BoolFlag{
+				Name:  dryRunFlag,
+				Usage: "only report dead entries",
+			},
+		)...),
+		Action: verifyCmd{logger: logger}.run,
+	}
+}
+
+type verifyCmd struct {
+	logger whlogger.Logger
+}
+
+func (cmd verifyCmd) run(ctx *cli.Context) (err error) {
+	mediaCache, logger, err := openCache(ctx, cmd.logger, false)
+	if err != nil {
+		return err
+	}
+	defer closeCache(mediaCache, &err)
+
+	var (
+		match   = entryFilter(ctx)
+		keys    []cache.Key
+		entries = make(map[cache.Key]cache.Entry)
+	)
+
+	err = mediaCache.Range(func(key cache.Key, entry cache.Entry) bool {
+		if match(key, entry) {
+			keys = append(keys, key)
+			entries[key] = entry
+		}
+
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("read cache: %w", err)
+	}
+
+	v := verifier{
+		logger:   logger,
+		client:   &http.Client{Timeout: verifyRequestTimeout},
+		parallel: max(ctx.Uint(parallelFlag), 1),
+	}
+
+	dead, alive, unknown := v.check(ctx.Context, keys, entries)
+
+	if ctx.Bool(dryRunFlag) {
+		fmt.Printf("dead %d, unknown %d of %d entries\n", len(dead), len(unknown), len(keys)) // nolint: forbidigo
+
+		return ctx.Context.Err()
+	}
+
+	// validated entries are not checked again by upload within cache ttl
+	for _, key := range alive {
+		entry := entries[key]
+		entry.ValidatedAt = time.Now().UTC()
+
+		if err := mediaCache.Put(key, entry); err != nil {
+			return fmt.Errorf("update entries: %w", err)
+		}
+	}
+
+	if err := mediaCache.Delete(dead...); err != nil {
+		return fmt.Errorf("remove entries: %w", err)
+	}
+
+	fmt.Printf("removed %d, kept unknown %d of %d entries\n", len(dead), len(unknown), len(keys)) // nolint: forbidigo
+
+	return ctx.Context.Err()
+}
+
+type verifier struct {
+	logger   whlogger.Logger
+	client   *http.Client
+	parallel uint
+}
+
+// check checks entries concurrently and returns keys of dead ones, which link is expired
+// or answered with cache.ErrDeadLink, of alive ones and of unknown ones, which failed to check,
+// e.g. due to network errors, rate limits or server errors.
+func (v verifier) check(
+	ctx context.Context,
+	keys []cache.Key,
+	entries map[cache.Key]cache.Entry,
+) ([]cache.Key, []cache.Key, []cache.Key) {
+	var (
+		sem     = semaphore.NewWeighted(int64(v.parallel))
+		wg      sync.WaitGroup
+		mux     sync.Mutex
+		dead    []cache.Key
+		alive   []cache.Key
+		unknown []cache.Key
+		now     = time.Now()
+	)
+
+	for _, key := range keys {
+		if err := sem.Acquire(ctx, 1); err != nil {
+			break
+		}
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			defer sem.Release(1)
+
+			entry := entries[key]
+
+			var err error = cache.ErrDeadLink
+			if !entry.Expired(now) {
+				err = cache.CheckLink(ctx, v.client, entry.URL)
+			}
+
+			switch {
+			case err == nil:
+				mux.Lock()
+				alive = append(alive, key)
+				mux.Unlock()
+			case errors.Is(err, cache.ErrDeadLink):
+				fmt.Println("dead", key.HashString(), entry.Path, entry.URL) // nolint: forbidigo
+
+				mux.Lock()
+				dead = append(dead, key)
+				mux.Unlock()
+			default:
+				fmt.Println("unknown", key.HashString(), entry.Path, entry.URL) // nolint: forbidigo
+				v.logger.WithError(err).With("url", entry.URL).Warnf("failed to check cached entry")
+
+				mux.Lock()
+				unknown = append(unknown, key)
+				mux.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return dead, alive, unknown
+}
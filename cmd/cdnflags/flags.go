@@ -0,0 +1,49 @@
+package cdnflags
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/bohdanch-w/go-tgupload/registry"
+)
+
+// Usage returns help text for the flag which selects cdn.
+func Usage() string {
+	return fmt.Sprintf(
+		"override preffered cdn. Supported values are ['%s']. Comma separated list sets fallback order",
+		strings.Join(registry.Names(), "', '"),
+	)
+}
+
+// Flags returns command line flags for options of all registered CDN backends.
+func Flags() []cli.Flag {
+	opts := registry.Options()
+	flags := make([]cli.Flag, 0, len(opts))
+
+	for _, opt := range opts {
+		flags = append(flags, &cli.StringFlag{
+			Name:    opt.FlagName(),
+			Usage:   opt.Usage,
+			Aliases: opt.Aliases,
+			EnvVars: opt.EnvVars,
+			Hidden:  opt.Hidden,
+		})
+	}
+
+	return flags
+}
+
+// Values returns set values of flags created by Flags, keyed by config key.
+func Values(ctx *cli.Context) map[string]string {
+	values := make(map[string]string)
+
+	for _, opt := range registry.Options() {
+		if v := ctx.String(opt.FlagName()); v != "" {
+			values[opt.Key] = v
+		}
+	}
+
+	return values
+}
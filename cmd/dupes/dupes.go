@@ -0,0 +1,122 @@
+package dupes
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/bohdanch-w/go-tgupload/entities"
+	"github.com/bohdanch-w/go-tgupload/pkg/phash"
+	"github.com/bohdanch-w/go-tgupload/usecases"
+
+	whlogger "github.com/bohdanch-w/wheel/logger"
+)
+
+const (
+	Name = "dupes"
+
+	logLevelFlag = "loglevel"
+	distanceFlag = "distance"
+	parallelFlag = "parallel"
+
+	logLevelDefault = "INFO"
+	parallelDefault = 8
+)
+
+func NewCMD(logger whlogger.Logger) *cli.Command {
+	return &cli.Command{
+		Name: Name,
+		Usage: "report near-duplicate images inside or across gallery directories, " +
+			"e.g. the same page saved with other JPEG quality",
+		ArgsUsage: "<dir>...",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  logLevelFlag,
+				Usage: "level of logging for application",
+				Value: logLevelDefault,
+			},
+			&cli.IntFlag{
+				Name:  distanceFlag,
+				Usage: "maximal Hamming distance of perceptual hashes of similar images, out of 64",
+				Value: phash.DefaultDistance,
+			},
+			&cli.UintFlag{
+				Name:    parallelFlag,
+				Aliases: []string{"p"},
+				Usage:   "number of images hashed concurrently",
+				Value:   parallelDefault,
+			},
+		},
+		Action: dupesCmd{logger: logger}.run,
+	}
+}
+
+type dupesCmd struct {
+	logger whlogger.Logger
+}
+
+func (cmd dupesCmd) run(ctx *cli.Context) error {
+	dirs := ctx.Args().Slice()
+	if len(dirs) == 0 {
+		return entities.Error("no directories specified")
+	}
+
+	var logLevel whlogger.LogLevel
+	if err := logLevel.UnmarshalText([]byte(ctx.String(logLevelFlag))); err != nil {
+		return fmt.Errorf("parse loglevel: %w", err)
+	}
+
+	logger := cmd.logger.WithLevel(logLevel)
+
+	paths, err := listImages(dirs)
+	if err != nil {
+		return err
+	}
+
+	groups, err := usecases.FindSimilarImages(ctx.Context, logger, paths, ctx.Int(distanceFlag), ctx.Uint(parallelFlag))
+	if err != nil {
+		return fmt.Errorf("find similar images: %w", err)
+	}
+
+	for _, group := range groups {
+		fmt.Printf("%d similar images:\n", len(group)) // nolint: forbidigo
+
+		for i, img := range group {
+			if i == 0 {
+				fmt.Println("  " + img.Path) // nolint: forbidigo
+			} else {
+				fmt.Printf("  %s (distance %d)\n", img.Path, img.Distance) // nolint: forbidigo
+			}
+		}
+	}
+
+	fmt.Printf("found %d groups of similar images among %d files\n", len(groups), len(paths)) // nolint: forbidigo
+
+	return nil
+}
+
+// listImages returns images of the directories and their subdirectories.
+func listImages(dirs []string) ([]string, error) {
+	var paths []string
+
+	for _, dir := range dirs {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if !d.IsDir() && usecases.IsImage(d.Name()) {
+				paths = append(paths, path)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("list images of %s: %w", dir, err)
+		}
+	}
+
+	return paths, nil
+}
@@ -7,8 +7,11 @@ import (
 	"github.com/urfave/cli/v2"
 
 	accountcmd "github.com/bohdanch-w/go-tgupload/cmd/account"
+	cachecmd "github.com/bohdanch-w/go-tgupload/cmd/cache"
 	configcmd "github.com/bohdanch-w/go-tgupload/cmd/config"
+	dupescmd "github.com/bohdanch-w/go-tgupload/cmd/dupes"
 	postcmd "github.com/bohdanch-w/go-tgupload/cmd/post"
+	s3cmd "github.com/bohdanch-w/go-tgupload/cmd/s3"
 	uploadcmd "github.com/bohdanch-w/go-tgupload/cmd/upload"
 	versioncmd "github.com/bohdanch-w/go-tgupload/cmd/version"
 
@@ -32,6 +35,9 @@ func application(logger whlogger.Logger) *cli.App {
 			accountcmd.NewCMD(),
 			postcmd.NewCMD(logger),
 			uploadcmd.NewCMD(logger),
+			s3cmd.NewCMD(logger),
+			cachecmd.NewCMD(logger),
+			dupescmd.NewCMD(logger),
 		},
 		DefaultCommand: versioncmd.Name,
 	}
@@ -11,14 +11,21 @@ import (
 	"github.com/sqweek/dialog"
 
 	"github.com/bohdanch-w/go-tgupload/entities"
+	"github.com/bohdanch-w/go-tgupload/history"
 	"github.com/bohdanch-w/go-tgupload/pkg/utils"
 	"github.com/bohdanch-w/go-tgupload/services"
 	"github.com/bohdanch-w/go-tgupload/usecases"
+
+	whlogger "github.com/bohdanch-w/wheel/logger"
 )
 
 type poster struct {
-	uploader *usecases.CDNUploader
-	tgAPI    services.TelegraphAPI
+	logger     whlogger.Logger
+	uploader   *usecases.CDNUploader
+	tgAPI      services.TelegraphAPI
+	history    string
+	profile    string
+	identities map[string]string
 }
 
 func (p *poster) post(ctx context.Context, dir, title string, noDialog, autoOpen bool) error {
@@ -37,6 +44,10 @@ func (p *poster) post(ctx context.Context, dir, title string, noDialog, autoOpen
 		}
 	}
 
+	if err := p.uploader.CreateAlbum(pCtx, title); err != nil {
+		p.logger.WithError(err).Warnf("failed to create album, images are uploaded without it")
+	}
+
 	images, err = p.uploader.Upload(pCtx, images...)
 	if err != nil {
 		return fmt.Errorf("upload images: %w", err)
@@ -54,6 +65,15 @@ func (p *poster) post(ctx context.Context, dir, title string, noDialog, autoOpen
 		return fmt.Errorf("create page: %w", err)
 	}
 
+	rec := history.NewRecord(p.profile, images)
+	rec.Title = title
+	rec.PageURL = pageURL
+	rec.Identities = p.identities
+
+	if err := history.Append(p.history, rec); err != nil {
+		p.logger.WithError(err).Warnf("failed to save history")
+	}
+
 	if err := generateOutput(pageURL, autoOpen, noDialog); err != nil {
 		return fmt.Errorf("generate output: %w", err)
 	}
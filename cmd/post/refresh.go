@@ -0,0 +1,161 @@
+package post
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/urfave/cli/v2"
+
+	"github.com/bohdanch-w/go-tgupload/cmd/cdnflags"
+	"github.com/bohdanch-w/go-tgupload/cmd/tgapi"
+	"github.com/bohdanch-w/go-tgupload/config"
+	"github.com/bohdanch-w/go-tgupload/history"
+	"github.com/bohdanch-w/go-tgupload/services"
+	"github.com/bohdanch-w/go-tgupload/usecases"
+
+	whlogger "github.com/bohdanch-w/wheel/logger"
+)
+
+const (
+	refreshName = "refresh"
+	withinFlag  = "within"
+
+	withinDefault = 24 * time.Hour
+)
+
+func newRefreshCMD(logger whlogger.Logger) *cli.Command {
+	return &cli.Command{
+		Name:      refreshName,
+		Usage:     "renew expiring links (e.g. S3 presigned) of posted articles and edit the pages",
+		ArgsUsage: "[page-url...]",
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{
+				Name:  logLevelFlag,
+				Usage: "level of logging for application",
+				Value: logLevelDefault,
+			},
+			&cli.DurationFlag{
+				Name:  withinFlag,
+				Usage: "refresh links, which expire within this period",
+				Value: withinDefault,
+			},
+		}, cdnflags.Flags()...),
+		Action: refreshCmd{logger: logger}.run,
+	}
+}
+
+type refreshCmd struct {
+	logger whlogger.Logger
+}
+
+func (cmd refreshCmd) run(ctx *cli.Context) error {
+	var logLevel whlogger.LogLevel
+	if err := logLevel.UnmarshalText([]byte(ctx.String(logLevelFlag))); err != nil {
+		return fmt.Errorf("parse loglevel: %w", err)
+	}
+
+	globalCfg, err := config.ReadConfig(ctx.String("profile"))
+	if err != nil {
+		return fmt.Errorf("retrieve global config: %w", err)
+	}
+
+	tg, err := tgapi.Login(globalCfg)
+	if err != nil {
+		return err
+	}
+
+	var cdnOpts usecases.CDNOptions
+
+	cdnOpts.Values = cdnflags.Values(ctx)
+
+	r := refresher{
+		logger:    cmd.logger.WithLevel(logLevel),
+		refresher: usecases.NewLinkRefresher(globalCfg, cdnOpts),
+		tgAPI:     tg,
+		history:   history.DefaultLocation(globalCfg.Location),
+	}
+	defer r.refresher.Close()
+
+	return r.refresh(ctx.Context, ctx.Args().Slice(), time.Now().Add(ctx.Duration(withinFlag)))
+}
+
+type refresher struct {
+	logger    whlogger.Logger
+	refresher *usecases.LinkRefresher
+	tgAPI     services.TelegraphAPI
+	history   string
+}
+
+// refresh renews links of matched posted records and edits their pages. History is locked meanwhile,
+// so that records appended by concurrent runs are not lost.
+func (r *refresher) refresh(ctx context.Context, pages []string, before time.Time) error {
+	var mErr *multierror.Error
+
+	err := history.Update(r.history, func(records []history.Record) []history.Record {
+		for i, rec := range records {
+			if rec.PageURL == "" || (len(pages) != 0 && !slices.Contains(pages, rec.PageURL)) {
+				continue
+			}
+
+			refreshed, changed, err := r.refreshRecord(ctx, rec, before)
+			if err != nil {
+				mErr = multierror.Append(mErr, fmt.Errorf("%s: %w", rec.PageURL, err))
+			}
+
+			if !changed {
+				continue
+			}
+
+			urls := make([]string, 0, len(refreshed.Files))
+			for _, file := range refreshed.Files {
+				urls = append(urls, file.URL)
+			}
+
+			if err := r.tgAPI.EditPage(ctx, rec.PageURL, generatePage(rec.Title, urls)); err != nil {
+				mErr = multierror.Append(mErr, fmt.Errorf("%s: %w", rec.PageURL, err))
+
+				continue
+			}
+
+			records[i] = refreshed
+
+			fmt.Println("refreshed", rec.PageURL) // nolint: forbidigo
+		}
+
+		return records
+	})
+	if err != nil {
+		mErr = multierror.Append(mErr, fmt.Errorf("update history: %w", err))
+	}
+
+	return mErr.ErrorOrNil()
+}
+
+func (r *refresher) refreshRecord(
+	ctx context.Context,
+	rec history.Record,
+	before time.Time,
+) (history.Record, bool, error) {
+	var (
+		mErr     *multierror.Error
+		changed  bool
+		refFiles = make([]history.File, 0, len(rec.Files))
+	)
+
+	for _, file := range rec.Files {
+		media, ok, err := r.refresher.Refresh(ctx, file.ToMedia(), rec.Identities, before)
+		if err != nil {
+			mErr = multierror.Append(mErr, err)
+		}
+
+		changed = changed || ok
+		refFiles = append(refFiles, history.NewFile(media))
+	}
+
+	rec.Files = refFiles
+
+	return rec, changed, mErr.ErrorOrNil()
+}
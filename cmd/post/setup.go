@@ -2,14 +2,17 @@ package post
 
 import (
 	"fmt"
+	"io"
 	"os"
 
 	"github.com/sqweek/dialog"
 	"github.com/urfave/cli/v2"
 
+	"github.com/bohdanch-w/go-tgupload/cmd/cdnflags"
+	"github.com/bohdanch-w/go-tgupload/cmd/tgapi"
 	"github.com/bohdanch-w/go-tgupload/config"
-	"github.com/bohdanch-w/go-tgupload/entities"
-	"github.com/bohdanch-w/go-tgupload/integrations/telegraph"
+	"github.com/bohdanch-w/go-tgupload/history"
+	"github.com/bohdanch-w/go-tgupload/pkg/phash"
 	"github.com/bohdanch-w/go-tgupload/usecases"
 
 	wherr "github.com/bohdanch-w/wheel/errors"
@@ -17,23 +20,19 @@ import (
 )
 
 const (
-	Name         = "post"
-	logLevelFlag = "loglevel"
-	cacheFlag    = "cache"
-	noDialogFlag = "no-dialog"
-	parallelFlag = "parallel"
-	cdnFlag      = "cdn"
-	titleFlag    = "title"
-	browserFlag  = "browser"
-
-	postImageAPIKeyFlag    = "post-img-key"
-	awsKeyIDFlag           = "aws-key-id"
-	awsSecretAccessKeyFlag = "aws-secret-access-key"
-	awsRegionFlag          = "aws-region"
-	awsEndpointFlag        = "aws-endpoint"
-	awsS3BucketFlag        = "aws-s3-bucket"
-	awsS3LocationFlag      = "aws-s3-location"
-	awsS3PublicURLFlag     = "aws-s3-public-url"
+	Name                = "post"
+	logLevelFlag        = "loglevel"
+	cacheFlag           = "cache"
+	cacheTTLFlag        = "cache-ttl"
+	similarFlag         = "similar"
+	similarDistanceFlag = "similar-distance"
+	noDialogFlag        = "no-dialog"
+	parallelFlag        = "parallel"
+	cdnFlag             = "cdn"
+	mirrorFlag          = "mirror"
+	verifyFlag          = "verify"
+	titleFlag           = "title"
+	browserFlag         = "browser"
 
 	logLevelDefault = "INFO"
 	parallelDefault = 8
@@ -43,7 +42,7 @@ func NewCMD(logger whlogger.Logger) *cli.Command { // nolint: funlen
 	return &cli.Command{
 		Name:  Name,
 		Usage: "post telegraph article from image gallery",
-		Flags: []cli.Flag{
+		Flags: append([]cli.Flag{
 			&cli.StringFlag{
 				Name:  logLevelFlag,
 				Usage: "level of logging for application",
@@ -53,6 +52,20 @@ func NewCMD(logger whlogger.Logger) *cli.Command { // nolint: funlen
 				Name:  cacheFlag,
 				Usage: "path to saved cache. If specified will use caching for CDN uploads",
 			},
+			&cli.StringFlag{
+				Name: cacheTTLFlag,
+				Usage: "check cached links not validated within the period of their CDN before reuse, " +
+					"e.g. 'post-image=168h,s3=24h' or '168h' for all. Overrides cache-ttl config",
+			},
+			&cli.StringFlag{
+				Name:  similarFlag,
+				Usage: "match images similar to cached ones, e.g. re-saved with other JPEG quality: 'warn' or 'reuse' their links",
+			},
+			&cli.IntFlag{
+				Name:  similarDistanceFlag,
+				Usage: "maximal Hamming distance of perceptual hashes of similar images, out of 64. Required to reuse links",
+				Value: phash.DefaultDistance,
+			},
 			&cli.BoolFlag{
 				Name:    noDialogFlag,
 				Usage:   "don't prompt window for user input",
@@ -66,7 +79,15 @@ func NewCMD(logger whlogger.Logger) *cli.Command { // nolint: funlen
 			},
 			&cli.StringFlag{
 				Name:  cdnFlag,
-				Usage: "override preffered cdn. Supported values are ['post-image', 's3']",
+				Usage: cdnflags.Usage(),
+			},
+			&cli.StringFlag{
+				Name:  mirrorFlag,
+				Usage: "comma separated list of cdns to additionally copy images to. Overrides mirror-cdn config",
+			},
+			&cli.BoolFlag{
+				Name:  verifyFlag,
+				Usage: "download every uploaded image back and check it is served correctly before creating the page",
 			},
 			&cli.BoolFlag{
 				Name:    browserFlag,
@@ -78,92 +99,33 @@ func NewCMD(logger whlogger.Logger) *cli.Command { // nolint: funlen
 				Usage:   "specify the title of the article. If empty, then you will be prompted later.",
 				Aliases: []string{"t"},
 			},
-			&cli.StringFlag{
-				Name:  postImageAPIKeyFlag,
-				Usage: "API key for post-image CDN",
-				EnvVars: []string{
-					"POST_IMAGE_API_KEY",
-				},
-			},
-			&cli.StringFlag{
-				Name:   awsKeyIDFlag,
-				Hidden: true,
-				EnvVars: []string{
-					"AWS_KEY_ID",
-				},
-			},
-			&cli.StringFlag{
-				Name:   awsSecretAccessKeyFlag,
-				Hidden: true,
-				EnvVars: []string{
-					"AWS_SECRET_ACCESS_KEY",
-				},
-			},
-			&cli.StringFlag{
-				Name:   awsRegionFlag,
-				Hidden: true,
-				EnvVars: []string{
-					"AWS_REGION",
-				},
-			},
-			&cli.StringFlag{
-				Name:   awsEndpointFlag,
-				Hidden: true,
-				EnvVars: []string{
-					"AWS_ENDPOINT",
-				},
-			},
-			&cli.StringFlag{
-				Name:    awsS3BucketFlag,
-				Usage:   "name of the bucket for S3 CDN",
-				Aliases: []string{"bucket"},
-				EnvVars: []string{
-					"AWS_S3_BUCKET",
-				},
-			},
-			&cli.StringFlag{
-				Name:    awsS3LocationFlag,
-				Usage:   "location in the bucket for S3 CDN",
-				Aliases: []string{"location"},
-				EnvVars: []string{
-					"AWS_S3_LOCATION",
-				},
-			},
-			&cli.StringFlag{
-				Name:    awsS3PublicURLFlag,
-				Usage:   "prefix for formed URL for S3 CDN",
-				Aliases: []string{"public-url"},
-				EnvVars: []string{
-					"AWS_S3_PUBLIC_URL",
-				},
-			},
-		},
-		Action: postCmd{logger: logger}.run,
+		}, cdnflags.Flags()...),
+		Action:      postCmd{logger: logger}.run,
+		Subcommands: []*cli.Command{newRefreshCMD(logger)},
 	}
 }
 
 type postCmd struct {
-	logger    whlogger.Logger
-	logLevel  whlogger.LogLevel
-	cache     string
-	cdn       string
-	directory string
-	title     string
-
-	postImageAPIKey    string
-	awsKeyID           string
-	awsSecretAccessKey string
-	awsRegion          string
-	awsEndpoint        string
-	awsS3Bucket        string
-	awsS3Location      string
-	awsS3PublicURL     string
+	logger      whlogger.Logger
+	logLevel    whlogger.LogLevel
+	cache       string
+	cacheTTL    string
+	similar     string
+	similarDist int
+	cdn         string
+	mirrors     string
+	directory   string
+	title       string
+	parallel    uint
+
+	cdnValues map[string]string
 
 	noDialog bool
 	autoOpen bool
+	verify   bool
 }
 
-func (cmd postCmd) run(ctx *cli.Context) error {
+func (cmd postCmd) run(ctx *cli.Context) (err error) {
 	if err := cmd.getConfig(ctx); err != nil {
 		return fmt.Errorf("get config: %w", err)
 	}
@@ -175,42 +137,50 @@ func (cmd postCmd) run(ctx *cli.Context) error {
 		return fmt.Errorf("retrieve global config: %w", err)
 	}
 
-	acc := globalCfg.Account()
-	if !globalCfg.Exists() || !acc.Configured() || acc.AccessToken == "" {
-		return wherr.Error("account is not configured")
-	}
-
-	tg, err := telegraph.New(entities.Account{
-		AuthorName:      acc.AuthorName,
-		AuthorShortName: acc.AuthorShortName,
-		AuthorURL:       acc.AuthorURL,
-		AccessToken:     acc.AccessToken,
-	})
+	tg, err := tgapi.Login(globalCfg)
 	if err != nil {
-		return fmt.Errorf("login: %w", err)
+		return err
 	}
 
 	var cdnOpts usecases.CDNOptions
 
-	cdnOpts.S3.KeyID = cmd.awsKeyID
-	cdnOpts.S3.SecretAccessKey = cmd.awsSecretAccessKey
-	cdnOpts.S3.Region = cmd.awsRegion
-	cdnOpts.S3.Endpoint = cmd.awsEndpoint
-	cdnOpts.S3.Bucket = cmd.awsS3Bucket
-	cdnOpts.S3.Location = cmd.awsS3Location
-	cdnOpts.S3.PublicURL = cmd.awsS3PublicURL
-	cdnOpts.PostImage.APIKey = cmd.postImageAPIKey
+	cdnOpts.Values = cmd.cdnValues
+	cdnOpts.Mirrors = cmd.mirrors
+	cdnOpts.Parallel = cmd.parallel
+	cdnOpts.Verify = cmd.verify
 	cdnOpts.Cache.Enable = cmd.cache != ""
 	cdnOpts.Cache.FilePath = cmd.cache
+	cdnOpts.Cache.TTL = cmd.cacheTTL
+	cdnOpts.Cache.Similar = cmd.similar
+	cdnOpts.Cache.SimilarDistance = cmd.similarDist
 
-	cdn, err := usecases.NewCDN(ctx.Context, cmd.cdn, globalCfg, cdnOpts)
+	cdn, err := usecases.NewCDN(ctx.Context, logger, cmd.cdn, globalCfg, cdnOpts)
 	if err != nil {
 		return fmt.Errorf("open cdn connection: %w", err)
 	}
 
+	// closing cached CDN saves the cache, so its failure is reported even if upload failed
+	if closer, ok := cdn.(io.Closer); ok {
+		defer func() {
+			closeErr := closer.Close()
+
+			switch {
+			case closeErr == nil:
+			case err == nil:
+				err = fmt.Errorf("close cdn: %w", closeErr)
+			default:
+				logger.WithError(closeErr).Errorf("failed to close cdn")
+			}
+		}()
+	}
+
 	up := poster{
-		uploader: usecases.NewCDNUploader(logger, cdn, 0),
-		tgAPI:    tg,
+		logger:     logger,
+		uploader:   usecases.NewCDNUploader(logger, cdn, cmd.parallel),
+		tgAPI:      tg,
+		history:    history.DefaultLocation(globalCfg.Location),
+		profile:    globalCfg.Profile,
+		identities: usecases.CDNIdentities(cmd.cdn, globalCfg, cdnOpts),
 	}
 
 	if err := up.post(ctx.Context, cmd.directory, cmd.title, cmd.noDialog, cmd.autoOpen); err != nil {
@@ -227,19 +197,23 @@ func (cmd postCmd) run(ctx *cli.Context) error {
 func (cmd *postCmd) getConfig(ctx *cli.Context) error {
 	cmd.directory = ctx.Args().First()
 	cmd.cache = ctx.String(cacheFlag)
+	cmd.cacheTTL = ctx.String(cacheTTLFlag)
+	cmd.similar = ctx.String(similarFlag)
+	cmd.similarDist = -1
+
+	// links are reused only for explicitly chosen distance
+	if ctx.IsSet(similarDistanceFlag) {
+		cmd.similarDist = max(ctx.Int(similarDistanceFlag), 0)
+	}
 	cmd.title = ctx.String(titleFlag)
 	cmd.noDialog = ctx.Bool(noDialogFlag)
 	cmd.autoOpen = ctx.Bool(browserFlag)
 	cmd.cdn = ctx.String(cdnFlag)
+	cmd.mirrors = ctx.String(mirrorFlag)
+	cmd.verify = ctx.Bool(verifyFlag)
+	cmd.parallel = ctx.Uint(parallelFlag)
 
-	cmd.postImageAPIKey = ctx.String(postImageAPIKeyFlag)
-	cmd.awsKeyID = ctx.String(awsKeyIDFlag)
-	cmd.awsSecretAccessKey = ctx.String(awsSecretAccessKeyFlag)
-	cmd.awsRegion = ctx.String(awsRegionFlag)
-	cmd.awsEndpoint = ctx.String(awsEndpointFlag)
-	cmd.awsS3Bucket = ctx.String(awsS3BucketFlag)
-	cmd.awsS3Location = ctx.String(awsS3LocationFlag)
-	cmd.awsS3PublicURL = ctx.String(awsS3PublicURLFlag)
+	cmd.cdnValues = cdnflags.Values(ctx)
 
 	var logLevel whlogger.LogLevel
 	if err := logLevel.UnmarshalText([]byte(ctx.String(logLevelFlag))); err != nil {
@@ -0,0 +1,138 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/bohdanch-w/go-tgupload/cmd/cdnflags"
+	"github.com/bohdanch-w/go-tgupload/cmd/tgapi"
+	"github.com/bohdanch-w/go-tgupload/config"
+	"github.com/bohdanch-w/go-tgupload/history"
+	"github.com/bohdanch-w/go-tgupload/pkg/utils"
+	"github.com/bohdanch-w/go-tgupload/services"
+	s3storage "github.com/bohdanch-w/go-tgupload/storage/s3"
+	"github.com/bohdanch-w/go-tgupload/usecases"
+
+	whlogger "github.com/bohdanch-w/wheel/logger"
+)
+
+const (
+	gcName     = "gc"
+	dryRunFlag = "dry-run"
+	minAgeFlag = "min-age"
+
+	minAgeDefault = 24 * time.Hour
+)
+
+func newGCCMD(logger whlogger.Logger) *cli.Command {
+	return &cli.Command{
+		Name: gcName,
+		Usage: "delete objects under configured location, which are referenced neither by " +
+			"pages of telegra.ph account nor by upload history",
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{
+				Name:  logLevelFlag,
+				Usage: "level of logging for application",
+				Value: logLevelDefault,
+			},
+			&cli.BoolFlag{
+				Name:  dryRunFlag,
+				Usage: "only report unreferenced objects",
+			},
+			&cli.DurationFlag{
+				Name:  minAgeFlag,
+				Usage: "keep objects stored within this period, e.g. of posts being uploaded right now",
+				Value: minAgeDefault,
+			},
+		}, cdnflags.Flags()...),
+		Action: gcCmd{logger: logger}.run,
+	}
+}
+
+type gcCmd struct {
+	logger whlogger.Logger
+}
+
+func (cmd gcCmd) run(ctx *cli.Context) error {
+	var logLevel whlogger.LogLevel
+	if err := logLevel.UnmarshalText([]byte(ctx.String(logLevelFlag))); err != nil {
+		return fmt.Errorf("parse loglevel: %w", err)
+	}
+
+	globalCfg, err := config.ReadConfig(ctx.String("profile"))
+	if err != nil {
+		return fmt.Errorf("retrieve global config: %w", err)
+	}
+
+	tg, err := tgapi.Login(globalCfg)
+	if err != nil {
+		return err
+	}
+
+	var cdnOpts usecases.CDNOptions
+
+	cdnOpts.Values = cdnflags.Values(ctx)
+
+	c := collector{
+		logger:    cmd.logger.WithLevel(logLevel),
+		collector: usecases.NewGarbageCollector(globalCfg, cdnOpts),
+		tgAPI:     tg,
+		history:   history.DefaultLocation(globalCfg.Location),
+	}
+	defer c.collector.Close()
+
+	return c.collect(ctx.Context, usecases.GCOptions{
+		MinAge: ctx.Duration(minAgeFlag),
+		DryRun: ctx.Bool(dryRunFlag),
+	})
+}
+
+type collector struct {
+	logger    whlogger.Logger
+	collector *usecases.GarbageCollector
+	tgAPI     services.TelegraphAPI
+	history   string
+}
+
+func (c *collector) collect(ctx context.Context, opts usecases.GCOptions) error {
+	refs := usecases.NewReferences()
+
+	records, err := history.Read(c.history)
+	if err != nil {
+		return fmt.Errorf("read history: %w", err)
+	}
+
+	for _, rec := range records {
+		for _, file := range rec.Files {
+			refs.AddMedia(file.ToMedia())
+		}
+	}
+
+	c.logger.Infof("scanning pages of telegra.ph account")
+
+	// objects referenced only by pages, e.g. uploaded before history existed, must survive
+	if err := refs.AddAccountPages(ctx, c.tgAPI); err != nil {
+		return fmt.Errorf("collect page references: %w", err)
+	}
+
+	report, err := c.collector.Collect(ctx, s3storage.Name, refs, opts)
+
+	action := "removed"
+	if opts.DryRun {
+		action = "unreferenced"
+	}
+
+	for _, obj := range report.Garbage {
+		fmt.Println(action, obj.Handle, utils.FormatSize(obj.Size)) // nolint: forbidigo
+	}
+
+	fmt.Printf( // nolint: forbidigo
+		"%s %d of %d objects, %s\n",
+		action, len(report.Garbage), report.Scanned, utils.FormatSize(report.Bytes),
+	)
+
+	return err
+}
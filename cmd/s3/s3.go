@@ -0,0 +1,24 @@
+package s3
+
+import (
+	"github.com/urfave/cli/v2"
+
+	whlogger "github.com/bohdanch-w/wheel/logger"
+)
+
+const (
+	Name = "s3"
+
+	logLevelFlag    = "loglevel"
+	logLevelDefault = "INFO"
+)
+
+func NewCMD(logger whlogger.Logger) *cli.Command {
+	return &cli.Command{
+		Name:  Name,
+		Usage: "maintain S3 CDN storage",
+		Subcommands: []*cli.Command{
+			newGCCMD(logger),
+		},
+	}
+}
@@ -0,0 +1,32 @@
+// Package tgapi connects commands to telegra.ph with the configured account.
+package tgapi
+
+import (
+	"fmt"
+
+	"github.com/bohdanch-w/go-tgupload/config"
+	"github.com/bohdanch-w/go-tgupload/entities"
+	"github.com/bohdanch-w/go-tgupload/integrations/telegraph"
+
+	wherr "github.com/bohdanch-w/wheel/errors"
+)
+
+// Login returns telegra.ph API authorized with account of the config.
+func Login(globalCfg config.Config) (*telegraph.API, error) {
+	acc := globalCfg.Account()
+	if !globalCfg.Exists() || !acc.Configured() || acc.AccessToken == "" {
+		return nil, wherr.Error("account is not configured")
+	}
+
+	tg, err := telegraph.New(entities.Account{
+		AuthorName:      acc.AuthorName,
+		AuthorShortName: acc.AuthorShortName,
+		AuthorURL:       acc.AuthorURL,
+		AccessToken:     acc.AccessToken,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("login: %w", err)
+	}
+
+	return tg, nil
+}
@@ -0,0 +1,149 @@
+package upload
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/bohdanch-w/go-tgupload/cache"
+	"github.com/bohdanch-w/go-tgupload/cmd/cdnflags"
+	"github.com/bohdanch-w/go-tgupload/config"
+	"github.com/bohdanch-w/go-tgupload/entities"
+	"github.com/bohdanch-w/go-tgupload/history"
+	"github.com/bohdanch-w/go-tgupload/usecases"
+
+	whlogger "github.com/bohdanch-w/wheel/logger"
+)
+
+const (
+	rmName = "rm"
+)
+
+func newRmCMD(logger whlogger.Logger) *cli.Command {
+	return &cli.Command{
+		Name:      rmName,
+		Usage:     "delete uploaded files from CDNs, including mirrors",
+		ArgsUsage: "<url|path>...",
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{
+				Name:  logLevelFlag,
+				Usage: "level of logging for application",
+			},
+			&cli.StringFlag{
+				Name:  cacheFlag,
+				Usage: "path to saved cache. If specified removed files are dropped from it as well",
+			},
+		}, cdnflags.Flags()...),
+		Action: rmCMD{logger: logger}.run,
+	}
+}
+
+type rmCMD struct {
+	logger whlogger.Logger
+}
+
+func (cmd rmCMD) run(ctx *cli.Context) error {
+	targets := ctx.Args().Slice()
+	if len(targets) == 0 {
+		return entities.Error("no files specified")
+	}
+
+	var logLevel whlogger.LogLevel
+	if err := logLevel.UnmarshalText([]byte(ctx.String(logLevelFlag))); err != nil {
+		return fmt.Errorf("parse loglevel: %w", err)
+	}
+
+	logger := cmd.logger.WithLevel(logLevel)
+
+	globalCfg, err := config.ReadConfig(ctx.String("profile"))
+	if err != nil {
+		return fmt.Errorf("retrieve global config: %w", err)
+	}
+
+	var cdnOpts usecases.CDNOptions
+
+	cdnOpts.Values = cdnflags.Values(ctx)
+
+	rm := remover{
+		logger:  logger,
+		cdn:     usecases.NewCDNRemover(globalCfg, cdnOpts),
+		history: history.DefaultLocation(globalCfg.Location),
+		cache:   ctx.String(cacheFlag),
+		match:   newMatcher(targets),
+	}
+	defer rm.cdn.Close()
+
+	return rm.remove(ctx.Context)
+}
+
+type remover struct {
+	logger  whlogger.Logger
+	cdn     *usecases.CDNRemover
+	history string
+	cache   string
+	match   func(entities.MediaFile) bool
+}
+
+func (r *remover) remove(ctx context.Context) (err error) {
+	var mediaCache *cache.MediaCache
+
+	if r.cache != "" {
+		if _, statErr := os.Stat(r.cache); statErr == nil {
+			mediaCache, err = cache.Open(r.cache, nil, r.logger)
+			if err != nil {
+				return fmt.Errorf("open cache: %w", err)
+			}
+
+			defer func() {
+				if closeErr := mediaCache.Close(); closeErr != nil && err == nil {
+					err = fmt.Errorf("save cache: %w", closeErr)
+				}
+			}()
+		}
+	}
+
+	report, err := r.cdn.RemoveUploads(ctx, r.history, mediaCache, r.match)
+
+	for _, media := range report.Removed {
+		fmt.Println("removed", media.URL) // nolint: forbidigo
+	}
+
+	for _, url := range report.Kept {
+		fmt.Println("kept", url, "(still used by other uploads)") // nolint: forbidigo
+	}
+
+	return err // nolint: wrapcheck
+}
+
+// newMatcher matches media by its url, any of mirror urls or local file path.
+func newMatcher(targets []string) func(entities.MediaFile) bool {
+	return func(media entities.MediaFile) bool {
+		for _, target := range targets {
+			if target == media.URL || samePath(target, media.Path) {
+				return true
+			}
+
+			for _, mirror := range media.Mirrors {
+				if target == mirror.URL {
+					return true
+				}
+			}
+		}
+
+		return false
+	}
+}
+
+func samePath(a, b string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+
+	return errA == nil && errB == nil && absA == absB
+}
@@ -2,32 +2,33 @@ package upload
 
 import (
 	"fmt"
+	"io"
 
 	"github.com/urfave/cli/v2"
 
 	whlogger "github.com/bohdanch-w/wheel/logger"
 
+	"github.com/bohdanch-w/go-tgupload/cmd/cdnflags"
 	"github.com/bohdanch-w/go-tgupload/config"
 	"github.com/bohdanch-w/go-tgupload/entities"
+	"github.com/bohdanch-w/go-tgupload/history"
+	"github.com/bohdanch-w/go-tgupload/pkg/phash"
 	"github.com/bohdanch-w/go-tgupload/usecases"
 )
 
 const (
-	Name         = "upload"
-	logLevelFlag = "loglevel"
-	outputFlag   = "output"
-	plainFlag    = "plain"
-	parallelFlag = "parallel"
-	cdnFlag      = "cdn"
-
-	postImageAPIKeyFlag    = "post-img-key"
-	awsKeyIDFlag           = "aws-key-id"
-	awsSecretAccessKeyFlag = "aws-secret-access-key"
-	awsRegionFlag          = "aws-region"
-	awsEndpointFlag        = "aws-endpoint"
-	awsS3BucketFlag        = "aws-s3-bucket"
-	awsS3LocationFlag      = "aws-s3-location"
-	awsS3PublicURLFlag     = "aws-s3-public-url"
+	Name                = "upload"
+	logLevelFlag        = "loglevel"
+	outputFlag          = "output"
+	plainFlag           = "plain"
+	parallelFlag        = "parallel"
+	cdnFlag             = "cdn"
+	mirrorFlag          = "mirror"
+	verifyFlag          = "verify"
+	cacheFlag           = "cache"
+	cacheTTLFlag        = "cache-ttl"
+	similarFlag         = "similar"
+	similarDistanceFlag = "similar-distance"
 
 	defaultParallel = 8
 )
@@ -36,7 +37,7 @@ func NewCMD(logger whlogger.Logger) *cli.Command { // nolint: funlen
 	return &cli.Command{
 		Name:  Name,
 		Usage: "upload file to CDN",
-		Flags: []cli.Flag{
+		Flags: append([]cli.Flag{
 			&cli.StringFlag{
 				Name:  logLevelFlag,
 				Usage: "level of logging for application",
@@ -58,69 +59,37 @@ func NewCMD(logger whlogger.Logger) *cli.Command { // nolint: funlen
 			},
 			&cli.StringFlag{
 				Name:  cdnFlag,
-				Usage: "override preffered cdn. Supported values are ['post-image', 's3']",
+				Usage: cdnflags.Usage(),
 			},
 			&cli.StringFlag{
-				Name:  postImageAPIKeyFlag,
-				Usage: "API key for post-image CDN",
-				EnvVars: []string{
-					"POST_IMAGE_API_KEY",
-				},
+				Name:  mirrorFlag,
+				Usage: "comma separated list of cdns to additionally copy files to. Overrides mirror-cdn config",
 			},
-			&cli.StringFlag{
-				Name:   awsKeyIDFlag,
-				Hidden: true,
-				EnvVars: []string{
-					"AWS_KEY_ID",
-				},
-			},
-			&cli.StringFlag{
-				Name:   awsSecretAccessKeyFlag,
-				Hidden: true,
-				EnvVars: []string{
-					"AWS_SECRET_ACCESS_KEY",
-				},
-			},
-			&cli.StringFlag{
-				Name:   awsRegionFlag,
-				Hidden: true,
-				EnvVars: []string{
-					"AWS_REGION",
-				},
+			&cli.BoolFlag{
+				Name:  verifyFlag,
+				Usage: "download every uploaded file back and check it is served correctly",
 			},
 			&cli.StringFlag{
-				Name:   awsEndpointFlag,
-				Hidden: true,
-				EnvVars: []string{
-					"AWS_ENDPOINT",
-				},
+				Name:  cacheFlag,
+				Usage: "path to saved cache. If specified files uploaded before are not uploaded again",
 			},
 			&cli.StringFlag{
-				Name:    awsS3BucketFlag,
-				Usage:   "name of the bucket for S3 CDN",
-				Aliases: []string{"bucket"},
-				EnvVars: []string{
-					"AWS_S3_BUCKET",
-				},
+				Name: cacheTTLFlag,
+				Usage: "check cached links not validated within the period of their CDN before reuse, " +
+					"e.g. 'post-image=168h,s3=24h' or '168h' for all. Overrides cache-ttl config",
 			},
 			&cli.StringFlag{
-				Name:    awsS3LocationFlag,
-				Usage:   "location in the bucket for S3 CDN",
-				Aliases: []string{"location"},
-				EnvVars: []string{
-					"AWS_S3_LOCATION",
-				},
+				Name:  similarFlag,
+				Usage: "match images similar to cached ones, e.g. re-saved with other JPEG quality: 'warn' or 'reuse' their links",
 			},
-			&cli.StringFlag{
-				Name:    awsS3PublicURLFlag,
-				Usage:   "prefix for formed URL for S3 CDN",
-				Aliases: []string{"public-url"},
-				EnvVars: []string{
-					"AWS_S3_PUBLIC_URL",
-				},
+			&cli.IntFlag{
+				Name:  similarDistanceFlag,
+				Usage: "maximal Hamming distance of perceptual hashes of similar images, out of 64. Required to reuse links",
+				Value: phash.DefaultDistance,
 			},
-		},
-		Action: uploadCMD{logger: logger}.run,
+		}, cdnflags.Flags()...),
+		Action:      uploadCMD{logger: logger}.run,
+		Subcommands: []*cli.Command{newRmCMD(logger)},
 	}
 }
 
@@ -133,18 +102,17 @@ type uploadCMD struct {
 	plainOutput bool
 	parallel    uint
 	cdn         string
-
-	postImageAPIKey    string
-	awsKeyID           string
-	awsSecretAccessKey string
-	awsRegion          string
-	awsEndpoint        string
-	awsS3Bucket        string
-	awsS3Location      string
-	awsS3PublicURL     string
+	mirrors     string
+	verify      bool
+	cache       string
+	cacheTTL    string
+	similar     string
+	similarDist int
+
+	cdnValues map[string]string
 }
 
-func (cmd uploadCMD) run(ctx *cli.Context) error {
+func (cmd uploadCMD) run(ctx *cli.Context) (err error) {
 	if err := cmd.getConfig(ctx); err != nil {
 		return fmt.Errorf("get config: %w", err)
 	}
@@ -158,24 +126,43 @@ func (cmd uploadCMD) run(ctx *cli.Context) error {
 
 	var cdnOpts usecases.CDNOptions
 
-	cdnOpts.S3.KeyID = cmd.awsKeyID
-	cdnOpts.S3.SecretAccessKey = cmd.awsSecretAccessKey
-	cdnOpts.S3.Region = cmd.awsRegion
-	cdnOpts.S3.Endpoint = cmd.awsEndpoint
-	cdnOpts.S3.Bucket = cmd.awsS3Bucket
-	cdnOpts.S3.Location = cmd.awsS3Location
-	cdnOpts.S3.PublicURL = cmd.awsS3PublicURL
-	cdnOpts.PostImage.APIKey = cmd.postImageAPIKey
-
-	cdn, err := usecases.NewCDN(ctx.Context, cmd.cdn, globalCfg, cdnOpts)
+	cdnOpts.Values = cmd.cdnValues
+	cdnOpts.Mirrors = cmd.mirrors
+	cdnOpts.Parallel = cmd.parallel
+	cdnOpts.Verify = cmd.verify
+	cdnOpts.Cache.Enable = cmd.cache != ""
+	cdnOpts.Cache.FilePath = cmd.cache
+	cdnOpts.Cache.TTL = cmd.cacheTTL
+	cdnOpts.Cache.Similar = cmd.similar
+	cdnOpts.Cache.SimilarDistance = cmd.similarDist
+
+	cdn, err := usecases.NewCDN(ctx.Context, logger, cmd.cdn, globalCfg, cdnOpts)
 	if err != nil {
 		return fmt.Errorf("open cdn connection: %w", err)
 	}
 
+	// closing cached CDN saves the cache, so its failure is reported even if upload failed
+	if closer, ok := cdn.(io.Closer); ok {
+		defer func() {
+			closeErr := closer.Close()
+
+			switch {
+			case closeErr == nil:
+			case err == nil:
+				err = fmt.Errorf("close cdn: %w", closeErr)
+			default:
+				logger.WithError(closeErr).Errorf("failed to close cdn")
+			}
+		}()
+	}
+
 	up := uploader{
-		logger:   logger,
-		cdn:      cdn,
-		parallel: cmd.parallel,
+		logger:     logger,
+		cdn:        cdn,
+		parallel:   cmd.parallel,
+		history:    history.DefaultLocation(globalCfg.Location),
+		profile:    globalCfg.Profile,
+		identities: usecases.CDNIdentities(cmd.cdn, globalCfg, cdnOpts),
 	}
 
 	if err := up.upload(ctx.Context, cmd.files, cmd.output, cmd.plainOutput); err != nil {
@@ -201,15 +188,19 @@ func (cmd *uploadCMD) getConfig(ctx *cli.Context) error {
 	cmd.plainOutput = ctx.Bool(plainFlag)
 	cmd.parallel = ctx.Uint(parallelFlag)
 	cmd.cdn = ctx.String(cdnFlag)
+	cmd.mirrors = ctx.String(mirrorFlag)
+	cmd.verify = ctx.Bool(verifyFlag)
+	cmd.cache = ctx.String(cacheFlag)
+	cmd.cacheTTL = ctx.String(cacheTTLFlag)
+	cmd.similar = ctx.String(similarFlag)
+	cmd.similarDist = -1
+
+	// links are reused only for explicitly chosen distance
+	if ctx.IsSet(similarDistanceFlag) {
+		cmd.similarDist = max(ctx.Int(similarDistanceFlag), 0)
+	}
 
-	cmd.postImageAPIKey = ctx.String(postImageAPIKeyFlag)
-	cmd.awsKeyID = ctx.String(awsKeyIDFlag)
-	cmd.awsSecretAccessKey = ctx.String(awsSecretAccessKeyFlag)
-	cmd.awsRegion = ctx.String(awsRegionFlag)
-	cmd.awsEndpoint = ctx.String(awsEndpointFlag)
-	cmd.awsS3Bucket = ctx.String(awsS3BucketFlag)
-	cmd.awsS3Location = ctx.String(awsS3LocationFlag)
-	cmd.awsS3PublicURL = ctx.String(awsS3PublicURLFlag)
+	cmd.cdnValues = cdnflags.Values(ctx)
 
 	return nil
 }
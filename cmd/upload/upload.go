@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 
 	"github.com/bohdanch-w/go-tgupload/entities"
+	"github.com/bohdanch-w/go-tgupload/history"
 	"github.com/bohdanch-w/go-tgupload/services"
 	"github.com/bohdanch-w/go-tgupload/usecases"
 
@@ -16,9 +17,12 @@ import (
 )
 
 type uploader struct {
-	logger   whlogger.Logger
-	cdn      services.CDN
-	parallel uint
+	logger     whlogger.Logger
+	cdn        services.CDN
+	parallel   uint
+	history    string
+	profile    string
+	identities map[string]string
 }
 
 func (p *uploader) upload(ctx context.Context, filePathes []string, output string, plainOutput bool) error {
@@ -37,6 +41,13 @@ func (p *uploader) upload(ctx context.Context, filePathes []string, output strin
 		return fmt.Errorf("upload images: %w", err)
 	}
 
+	rec := history.NewRecord(p.profile, files)
+	rec.Identities = p.identities
+
+	if err := history.Append(p.history, rec); err != nil {
+		p.logger.WithError(err).Warnf("failed to save history")
+	}
+
 	return generateOutput(files, output, plainOutput)
 }
 
@@ -100,19 +111,7 @@ func generateOutput(files []entities.MediaFile, path string, plain bool) error {
 			}
 		}
 	} else {
-		type outFormat struct {
-			Path string `json:"path"`
-			URL  string `json:"url"`
-		}
-
-		data := make([]outFormat, 0, len(files))
-
-		for _, file := range files {
-			data = append(data, outFormat{
-				Path: file.Path,
-				URL:  file.URL,
-			})
-		}
+		data := history.NewRecord("", files).Files
 
 		enc := json.NewEncoder(w)
 		enc.SetIndent("", "  ")
@@ -10,6 +10,9 @@ type Config struct {
 	Location string
 	Profile  string
 	values   map[string]string
+	// changed are keys set since config was read. Only they are written by StoreConfig,
+	// so that changes of other processes made meanwhile are kept.
+	changed map[string]struct{}
 }
 
 func (cfg *Config) Set(key, value string) {
@@ -17,7 +20,12 @@ func (cfg *Config) Set(key, value string) {
 		cfg.values = make(map[string]string)
 	}
 
+	if cfg.changed == nil {
+		cfg.changed = make(map[string]struct{})
+	}
+
 	cfg.values[key] = value
+	cfg.changed[key] = struct{}{}
 }
 
 func (cfg *Config) GetOK(key string) (string, bool) {
@@ -57,8 +65,8 @@ func (cfg *Config) Account() entities.Account {
 }
 
 func (cfg *Config) SetAccount(acc entities.Account) {
-	cfg.values[TgAuthorName] = acc.AuthorName
-	cfg.values[TgAuthorShortName] = acc.AuthorShortName
-	cfg.values[TgAuthorURL] = acc.AuthorURL
-	cfg.values[TgAccessToken] = acc.AccessToken
+	cfg.Set(TgAuthorName, acc.AuthorName)
+	cfg.Set(TgAuthorShortName, acc.AuthorShortName)
+	cfg.Set(TgAuthorURL, acc.AuthorURL)
+	cfg.Set(TgAccessToken, acc.AccessToken)
 }
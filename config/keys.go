@@ -1,26 +1,21 @@
 package config
 
+import "github.com/bohdanch-w/go-tgupload/registry"
+
 const (
-	TgAuthorName       = "tg-author-name"
-	TgAuthorShortName  = "tg-author-short-name"
-	TgAuthorURL        = "tg-author-url"
-	TgAccessToken      = "tg-access-token"
-	PreferredCDN       = "preferred-cdn"
-	PostimgAPIKey      = "postimg-api-key"
-	AWSKeyID           = "aws-key-id"
-	AWSSecretAccessKey = "aws-secret-access-key"
-	AWSRegion          = "aws-region"
-	AWSEndpoint        = "aws-endpoint"
-	AWSS3Bucket        = "aws-s3-bucket"
-	AWSS3Location      = "aws-s3-location"
-	AWSS3PublicURL     = "aws-s3-public-url"
+	TgAuthorName      = "tg-author-name"
+	TgAuthorShortName = "tg-author-short-name"
+	TgAuthorURL       = "tg-author-url"
+	TgAccessToken     = "tg-access-token"
+	PreferredCDN      = "preferred-cdn"
+	CDNTimeout        = "cdn-timeout"
+	MirrorCDN         = "mirror-cdn"
+	CacheTTL          = "cache-ttl"
 )
 
+// SensitiveKeys returns keys, values of which should be masked, including ones of CDN backends.
 func SensitiveKeys() []string {
-	return []string{
+	return append([]string{
 		TgAccessToken,
-		PostimgAPIKey,
-		AWSKeyID,
-		AWSSecretAccessKey,
-	}
+	}, registry.SensitiveKeys()...)
 }
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,6 +10,8 @@ import (
 	"path/filepath"
 	"slices"
 
+	"github.com/bohdanch-w/go-tgupload/pkg/fsutil"
+
 	"github.com/bohdanch-w/wheel/collections"
 	orderedset "github.com/bohdanch-w/wheel/ds/ordered-set"
 	wherr "github.com/bohdanch-w/wheel/errors"
@@ -120,43 +123,62 @@ func readRawConfig(path string) (storedConfig, error) {
 	return config, nil
 }
 
-func StoreConfig(cfg Config) error {
+// StoreConfig writes keys set in the profile to config file. File is locked while it is updated,
+// so concurrent changes of other keys or profiles are not lost.
+func StoreConfig(cfg Config) (err error) {
 	if cfg.Location == "" || cfg.Profile == "" {
 		return wherr.Error("config not initialized")
 	}
 
-	config, err := readRawConfig(cfg.Location)
+	if err := os.MkdirAll(filepath.Dir(cfg.Location), 0o777); err != nil { // nolint: mnd
+		return fmt.Errorf("create config directory: %w", err)
+	}
+
+	unlock, err := fsutil.Lock(cfg.Location)
 	if err != nil {
-		if !errors.Is(err, os.ErrNotExist) {
-			return err
-		}
+		return fmt.Errorf("lock config file: %w", err)
+	}
 
-		if err := os.MkdirAll(filepath.Dir(cfg.Location), 0o777); err != nil { // nolint: mnd
-			return fmt.Errorf("create config directory: %w", err)
+	defer func() {
+		if unlockErr := unlock(); unlockErr != nil && err == nil {
+			err = fmt.Errorf("unlock config file: %w", unlockErr)
 		}
+	}()
+
+	config, err := readRawConfig(cfg.Location)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
 	}
 
 	if config.Profiles == nil {
 		config.Profiles = make(map[string]map[string]string)
 	}
 
-	config.Profiles[cfg.Profile] = cfg.values
+	values := config.Profiles[cfg.Profile]
+	if values == nil {
+		values = make(map[string]string)
+		config.Profiles[cfg.Profile] = values
+	}
+
+	for key := range cfg.changed {
+		values[key] = cfg.values[key]
+	}
 
 	return storeRawConfig(config, cfg.Location)
 }
 
 func storeRawConfig(config storedConfig, path string) error {
-	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0o600) // nolint: mnd
-	if err != nil {
-		return fmt.Errorf("open config file: %w", err)
-	}
-	defer f.Close()
+	var buf bytes.Buffer
 
-	enc := json.NewEncoder(f)
+	enc := json.NewEncoder(&buf)
 	enc.SetIndent("", "  ")
 	enc.SetEscapeHTML(false)
 
 	if err := enc.Encode(config); err != nil {
+		return fmt.Errorf("failed to encode config content: %w", err)
+	}
+
+	if err := fsutil.WriteFile(path, buf.Bytes(), 0o600); err != nil { // nolint: mnd
 		return fmt.Errorf("failed to write config content: %w", err)
 	}
 
@@ -0,0 +1,80 @@
+package config_test
+
+import (
+	"bytes"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bohdanch-w/go-tgupload/config"
+	"github.com/bohdanch-w/go-tgupload/internal/testproc"
+)
+
+// TestHelperProcess is not a real test, but the entry point of processes started by testproc.
+func TestHelperProcess(t *testing.T) {
+	testproc.Main(t, map[string]testproc.Helper{"set": setHelper})
+}
+
+// setHelper sets config key: set <path> <key> <value>.
+func setHelper(args []string) error {
+	cfg, err := config.ReadConfig("", config.WithConfigLocation(args[0]))
+	if err != nil {
+		return err
+	}
+
+	cfg.Set(args[1], args[2])
+
+	return config.StoreConfig(cfg)
+}
+
+func TestStoreConfigConcurrentProcesses(t *testing.T) {
+	const processes = 8
+
+	path := filepath.Join(t.TempDir(), "gotg", "config.json")
+
+	cmds := make([]*exec.Cmd, processes)
+	outputs := make([]bytes.Buffer, processes)
+
+	for i := range cmds {
+		cmds[i] = testproc.Command("set", path, "key-"+strconv.Itoa(i), "value")
+		cmds[i].Stdout = &outputs[i]
+		cmds[i].Stderr = &outputs[i]
+
+		require.NoError(t, cmds[i].Start())
+	}
+
+	for i, cmd := range cmds {
+		require.NoError(t, cmd.Wait(), outputs[i].String())
+	}
+
+	cfg, err := config.ReadConfig("", config.WithConfigLocation(path))
+	require.NoError(t, err)
+	require.Len(t, cfg.Values(), processes, "keys of all processes are kept")
+
+	tmp, err := filepath.Glob(filepath.Join(filepath.Dir(path), "*.tmp"))
+	require.NoError(t, err)
+	require.Empty(t, tmp)
+}
+
+func TestStoreConfigShorterContent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+
+	cfg, err := config.ReadConfig("", config.WithConfigLocation(path))
+	require.NoError(t, err)
+
+	cfg.Set(config.PreferredCDN, "post-image,s3,azblob")
+	require.NoError(t, config.StoreConfig(cfg))
+
+	cfg, err = config.ReadConfig("", config.WithConfigLocation(path))
+	require.NoError(t, err)
+
+	cfg.Set(config.PreferredCDN, "s3")
+	require.NoError(t, config.StoreConfig(cfg))
+
+	cfg, err = config.ReadConfig("", config.WithConfigLocation(path))
+	require.NoError(t, err, "previous content is not left after shorter one")
+	require.Equal(t, "s3", cfg.Get(config.PreferredCDN))
+}
@@ -1,8 +1,74 @@
 package entities
 
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
 type MediaFile struct {
 	Name string
 	Path string
-	Data []byte
-	URL  string
+	// Data is content of the file, if it is loaded. Otherwise content is read from Path on demand.
+	Data         []byte
+	URL          string
+	CDN          string
+	DeleteHandle string
+	Mirrors      []Mirror
+	// Index is the position of the file in uploaded batch, starting from 1. Zero if unknown.
+	Index int
+	// ExpiresAt is set for links valid for a limited time, e.g. presigned.
+	ExpiresAt time.Time
+}
+
+// Open returns reader of media content: loaded data or the file at Path.
+func (m MediaFile) Open() (io.ReadSeekCloser, error) {
+	if m.Data != nil || m.Path == "" {
+		return nopCloser{bytes.NewReader(m.Data)}, nil
+	}
+
+	f, err := os.Open(m.Path)
+	if err != nil {
+		return nil, fmt.Errorf("open media: %w", err)
+	}
+
+	return f, nil
+}
+
+// Content returns media content, reading the file at Path if data isn't loaded.
+func (m MediaFile) Content() ([]byte, error) {
+	if m.Data != nil || m.Path == "" {
+		return m.Data, nil
+	}
+
+	data, err := os.ReadFile(m.Path)
+	if err != nil {
+		return nil, fmt.Errorf("read media: %w", err)
+	}
+
+	return data, nil
+}
+
+type nopCloser struct {
+	io.ReadSeeker
+}
+
+func (nopCloser) Close() error { return nil }
+
+type Mirror struct {
+	CDN          string
+	URL          string
+	DeleteHandle string
+	ExpiresAt    time.Time
+}
+
+// StoredObject is a file kept by CDN, regardless of whether it is still referenced.
+type StoredObject struct {
+	// Handle identifies object for deletion, same as MediaFile.DeleteHandle.
+	Handle     string
+	URL        string
+	Size       int64
+	ModifiedAt time.Time
 }
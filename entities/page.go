@@ -1,6 +1,8 @@
 package entities
 
 type Page struct {
+	// URL is set for published pages.
+	URL         string
 	Title       string
 	Description string
 	Content     []Node
@@ -0,0 +1,213 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bohdanch-w/go-tgupload/entities"
+	"github.com/bohdanch-w/go-tgupload/pkg/fsutil"
+)
+
+const fileName = "history.jsonl"
+
+// Record describes single command run: uploaded files and, for posts, resulting page.
+type Record struct {
+	Time    time.Time `json:"time"`
+	Profile string    `json:"profile,omitempty"`
+	Title   string    `json:"title,omitempty"`
+	PageURL string    `json:"page_url,omitempty"`
+	Files   []File    `json:"files"`
+	// Identities describe where files were stored, keyed by cdn type, see registry.Identity.
+	Identities map[string]string `json:"identities,omitempty"`
+}
+
+type File struct {
+	Path         string    `json:"path"`
+	URL          string    `json:"url"`
+	CDN          string    `json:"cdn,omitempty"`
+	DeleteHandle string    `json:"delete_handle,omitempty"`
+	ExpiresAt    time.Time `json:"expires_at,omitzero"`
+	Mirrors      []Mirror  `json:"mirrors,omitempty"`
+}
+
+type Mirror struct {
+	CDN          string    `json:"cdn"`
+	URL          string    `json:"url"`
+	DeleteHandle string    `json:"delete_handle,omitempty"`
+	ExpiresAt    time.Time `json:"expires_at,omitzero"`
+}
+
+// DefaultLocation returns history file location next to the config file.
+func DefaultLocation(configLocation string) string {
+	return filepath.Join(filepath.Dir(configLocation), fileName)
+}
+
+func NewRecord(profile string, files []entities.MediaFile) Record {
+	rec := Record{
+		Time:    time.Now().UTC(),
+		Profile: profile,
+		Files:   make([]File, 0, len(files)),
+	}
+
+	for _, media := range files {
+		rec.Files = append(rec.Files, NewFile(media))
+	}
+
+	return rec
+}
+
+func NewFile(media entities.MediaFile) File {
+	file := File{
+		Path:         media.Path,
+		URL:          media.URL,
+		CDN:          media.CDN,
+		DeleteHandle: media.DeleteHandle,
+		ExpiresAt:    media.ExpiresAt,
+	}
+
+	for _, mirror := range media.Mirrors {
+		file.Mirrors = append(file.Mirrors, Mirror(mirror))
+	}
+
+	return file
+}
+
+// Append adds record to the end of history file, creating it if needed.
+func Append(path string, rec Record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("marshal record: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil { // nolint: mnd
+		return fmt.Errorf("create history directory: %w", err)
+	}
+
+	return locked(path, func() error {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600) // nolint: mnd
+		if err != nil {
+			return fmt.Errorf("open history file: %w", err)
+		}
+		defer f.Close()
+
+		if _, err := f.Write(append(data, '\n')); err != nil {
+			return fmt.Errorf("write record: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// Read returns all records from history file. Missing file means empty history.
+func Read(path string) ([]Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("open history file: %w", err)
+	}
+	defer f.Close()
+
+	var records []Record
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64<<20) // nolint: mnd
+
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var rec Record
+
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return records, fmt.Errorf("parse record at line %d: %w", line, err)
+		}
+
+		records = append(records, rec)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return records, fmt.Errorf("read history file: %w", err)
+	}
+
+	return records, nil
+}
+
+// Write replaces history file content with given records.
+func Write(path string, records []Record) error {
+	return locked(path, func() error { return write(path, records) })
+}
+
+// Update replaces records of history file with the ones returned by fn. File is locked
+// meanwhile, so that records appended concurrently are not lost.
+func Update(path string, fn func([]Record) []Record) error {
+	return locked(path, func() error {
+		records, err := Read(path)
+		if err != nil {
+			return err
+		}
+
+		return write(path, fn(records))
+	})
+}
+
+// locked runs fn holding lock of history file.
+func locked(path string, fn func() error) (err error) {
+	unlock, err := fsutil.Lock(path)
+	if err != nil {
+		return fmt.Errorf("lock history file: %w", err)
+	}
+
+	defer func() {
+		if unlockErr := unlock(); unlockErr != nil && err == nil {
+			err = fmt.Errorf("unlock history file: %w", unlockErr)
+		}
+	}()
+
+	return fn()
+}
+
+func write(path string, records []Record) error {
+	buf := make([]byte, 0, len(records)*512) // nolint: mnd
+
+	for _, rec := range records {
+		data, err := json.Marshal(rec)
+		if err != nil {
+			return fmt.Errorf("marshal record: %w", err)
+		}
+
+		buf = append(append(buf, data...), '\n')
+	}
+
+	if err := fsutil.WriteFile(path, buf, 0o600); err != nil { // nolint: mnd
+		return fmt.Errorf("write history file: %w", err)
+	}
+
+	return nil
+}
+
+// ToMedia converts history file back to the uploaded media.
+func (f File) ToMedia() entities.MediaFile {
+	media := entities.MediaFile{
+		Name:         filepath.Base(f.Path),
+		Path:         f.Path,
+		URL:          f.URL,
+		CDN:          f.CDN,
+		DeleteHandle: f.DeleteHandle,
+		ExpiresAt:    f.ExpiresAt,
+	}
+
+	for _, mirror := range f.Mirrors {
+		media.Mirrors = append(media.Mirrors, entities.Mirror(mirror))
+	}
+
+	return media
+}
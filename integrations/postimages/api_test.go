@@ -0,0 +1,65 @@
+package postimages_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/bohdanch-w/go-tgupload/entities"
+	"github.com/bohdanch-w/go-tgupload/integrations/postimages"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIUploadToGallery(t *testing.T) {
+	var uploadGallery string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		require.Equal(t, "key", r.PostForm.Get("key"))
+
+		switch r.URL.Path {
+		case "/1/gallery":
+			require.Equal(t, "My title", r.PostForm.Get("name"))
+			writeFile(t, w, "testdata/gallery.xml")
+		case "/1/upload":
+			uploadGallery = r.PostForm.Get("gallery")
+			writeFile(t, w, "testdata/resp.xml")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	api := postimages.NewAPI("key", "", postimages.WithHTTPClient(srv.Client()), postimages.WithEndpoint(srv.URL+"/1/"))
+
+	require.NoError(t, api.CreateAlbum(context.Background(), "My title"))
+	require.Equal(t, "g4Lr7Yq", api.Gallery())
+
+	media, err := api.Upload(context.Background(), entities.MediaFile{Name: "02.png", Data: []byte("image data")})
+	require.NoError(t, err)
+	require.Equal(t, "g4Lr7Yq", uploadGallery)
+	require.Equal(t, "https://i.postimg.cc/KY92bYbL/02.png", media.URL)
+	require.Equal(t, "https://postimg.cc/delete/0h4sywYB/952e55ab", media.DeleteHandle)
+}
+
+func TestAPIUploadHTTPError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	api := postimages.NewAPI("key", "", postimages.WithHTTPClient(srv.Client()), postimages.WithEndpoint(srv.URL))
+
+	_, err := api.Upload(context.Background(), entities.MediaFile{Name: "02.png", Data: []byte("image data")})
+	require.ErrorIs(t, err, postimages.ErrUnavailable)
+}
+
+func writeFile(t *testing.T, w http.ResponseWriter, path string) {
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	w.Header().Set("Content-Type", "text/xml")
+	w.Write(data)
+}
@@ -0,0 +1,63 @@
+package postimages
+
+import (
+	"context"
+
+	"github.com/bohdanch-w/go-tgupload/registry"
+	"github.com/bohdanch-w/go-tgupload/services"
+
+	wherr "github.com/bohdanch-w/wheel/errors"
+)
+
+const (
+	Name = "post-image"
+
+	APIKey    = "postimg-api-key"
+	GalleryID = "postimg-gallery"
+	Endpoint  = "postimg-endpoint"
+)
+
+func init() { // nolint: gochecknoinits
+	registry.Register(registry.Backend{
+		Name: Name,
+		Options: []registry.Option{
+			{
+				Key:       APIKey,
+				Flag:      "post-img-key",
+				Usage:     "API key for post-image CDN",
+				EnvVars:   []string{"POST_IMAGE_API_KEY"},
+				Sensitive: true,
+				Identity:  true,
+			},
+			{
+				Key:     GalleryID,
+				Flag:    "post-img-gallery",
+				Usage:   "id of existing gallery to upload images into for post-image CDN. Posts create own gallery",
+				EnvVars: []string{"POST_IMAGE_GALLERY"},
+			},
+			{
+				Key:      Endpoint,
+				Usage:    "API endpoint for post-image CDN",
+				EnvVars:  []string{"POST_IMAGE_ENDPOINT"},
+				Hidden:   true,
+				Identity: true,
+			},
+		},
+		New: newCDN,
+	})
+}
+
+func newCDN(_ context.Context, params registry.Params) (services.CDN, error) {
+	apiKey := params.Get(APIKey)
+	if apiKey == "" {
+		return nil, wherr.Error("post-image: no api key provided")
+	}
+
+	var opts []Option
+
+	if endpoint := params.Get(Endpoint); endpoint != "" {
+		opts = append(opts, WithEndpoint(endpoint))
+	}
+
+	return NewAPI(apiKey, params.Get(GalleryID), opts...), nil
+}
@@ -0,0 +1,172 @@
+package postimages
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bohdanch-w/go-tgupload/entities"
+)
+
+const (
+	// ErrUploadFailed is returned when API reports unsuccessful upload.
+	ErrUploadFailed = entities.Error("postimages: upload failed")
+	// ErrBadRequest is returned for 4xx responses, retry will not help.
+	ErrBadRequest = entities.Error("postimages: request rejected")
+	// ErrUnavailable is returned for 5xx responses.
+	ErrUnavailable = entities.Error("postimages: service unavailable")
+	// ErrNoLink is returned when successful response has no hotlink.
+	ErrNoLink = entities.Error("postimages: no hotlink in response")
+	// ErrNoGallery is returned when successful gallery response has no id.
+	ErrNoGallery = entities.Error("postimages: no gallery in response")
+)
+
+// APIError holds failure details returned by API. It wraps one of the typed errors above.
+type APIError struct {
+	Status  int
+	Code    string
+	Message string
+
+	kind error
+}
+
+func (e *APIError) Error() string {
+	var sb strings.Builder
+
+	sb.WriteString(e.kind.Error())
+
+	if e.Status != 0 {
+		fmt.Fprintf(&sb, ": status %d", e.Status)
+	}
+
+	if e.Code != "" {
+		fmt.Fprintf(&sb, ": code %s", e.Code)
+	}
+
+	if e.Message != "" {
+		sb.WriteString(": " + e.Message)
+	}
+
+	return sb.String()
+}
+
+func (e *APIError) Unwrap() error {
+	return e.kind
+}
+
+// Result is successful upload response.
+type Result struct {
+	Image Image
+	Links Links
+}
+
+type Image struct {
+	Name   string `xml:"name"`
+	Type   string `xml:"type"`
+	Width  int    `xml:"width"`
+	Height int    `xml:"height"`
+	Size   int64  `xml:"size"`
+}
+
+type Links struct {
+	// Page is the viewer page of the image.
+	Page      string `xml:"page"`
+	Edit      string `xml:"edit"`
+	Delete    string `xml:"delete"`
+	Thumbnail string `xml:"thumbnail"`
+	// Hotlink is the direct link to the image.
+	Hotlink string `xml:"hotlink"`
+}
+
+// ParseResponse parses API response body, mapping reported failures to typed errors.
+func ParseResponse(data []byte) (Result, error) {
+	return parseResponse(http.StatusOK, data)
+}
+
+func parseResponse(httpStatus int, data []byte) (Result, error) {
+	var resp response
+
+	if err := resp.parse(httpStatus, data); err != nil {
+		return Result{}, err
+	}
+
+	if resp.Links.Hotlink == "" {
+		return Result{}, ErrNoLink
+	}
+
+	return Result{Image: resp.Image, Links: resp.Links}, nil
+}
+
+// Gallery is created gallery response.
+type Gallery struct {
+	ID  string `xml:"id"`
+	URL string `xml:"url"`
+}
+
+func parseGalleryResponse(httpStatus int, data []byte) (Gallery, error) {
+	var resp response
+
+	if err := resp.parse(httpStatus, data); err != nil {
+		return Gallery{}, err
+	}
+
+	if resp.Gallery.ID == "" {
+		return Gallery{}, ErrNoGallery
+	}
+
+	return resp.Gallery, nil
+}
+
+type response struct {
+	XMLName xml.Name `xml:"data"`
+	Success string   `xml:"success,attr"`
+	Status  string   `xml:"status,attr"`
+	Error   struct {
+		Code    string `xml:"code,attr"`
+		Message string `xml:",chardata"`
+	} `xml:"error"`
+	Image   Image   `xml:"image"`
+	Links   Links   `xml:"links"`
+	Gallery Gallery `xml:"gallery"`
+}
+
+func (r *response) parse(httpStatus int, data []byte) error {
+	parseErr := xml.Unmarshal(data, r)
+
+	if httpStatus >= http.StatusBadRequest {
+		// error body is not guaranteed to be xml, details are best effort
+		return r.apiError(httpStatus)
+	}
+
+	if parseErr != nil {
+		return fmt.Errorf("parse response: %w", parseErr)
+	}
+
+	status, _ := strconv.Atoi(r.Status)
+
+	if r.Success != "1" || status >= http.StatusBadRequest {
+		return r.apiError(status)
+	}
+
+	return nil
+}
+
+func (r response) apiError(status int) *APIError {
+	apiErr := &APIError{
+		Status:  status,
+		Code:    r.Error.Code,
+		Message: strings.TrimSpace(r.Error.Message),
+		kind:    ErrUploadFailed,
+	}
+
+	switch {
+	case status >= http.StatusInternalServerError:
+		apiErr.kind = ErrUnavailable
+	case status >= http.StatusBadRequest:
+		apiErr.kind = ErrBadRequest
+	}
+
+	return apiErr
+}
@@ -5,20 +5,23 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
-	"encoding/xml"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/bohdanch-w/go-tgupload/entities"
 	"github.com/bohdanch-w/go-tgupload/services"
 )
 
 const (
-	uploadURL = "https://api.postimage.org/1/upload"
+	DefaultEndpoint = "https://api.postimage.org/1"
+
+	uploadPath  = "/upload"
+	galleryPath = "/gallery"
 
 	o        = "2b819584285c102318568238c7d4a4c7"
 	m        = "59c2ad4b46b0c1e12d5703302bff0120"
@@ -26,81 +29,173 @@ const (
 	portable = "1"
 )
 
-var _ services.CDN = (*API)(nil)
+var (
+	_ services.CDN        = (*API)(nil)
+	_ services.CDNDeleter = (*API)(nil)
+	_ services.AlbumCDN   = (*API)(nil)
+)
+
+type Option func(*API)
 
-func NewAPI(apiKey string, gallery string) *API {
-	return &API{
-		apiKey: apiKey,
-		cli:    http.DefaultClient,
+// WithHTTPClient sets client used for API requests, e.g. with proxy or timeout.
+func WithHTTPClient(cli *http.Client) Option {
+	return func(a *API) {
+		a.cli = cli
 	}
 }
 
+// WithEndpoint overrides API base URL.
+func WithEndpoint(endpoint string) Option {
+	return func(a *API) {
+		a.endpoint = strings.TrimSuffix(endpoint, "/")
+	}
+}
+
+// NewAPI creates postimages client. Non empty gallery is the id of existing gallery
+// to upload images into.
+func NewAPI(apiKey string, gallery string, opts ...Option) *API {
+	api := &API{
+		cli:      http.DefaultClient,
+		endpoint: DefaultEndpoint,
+		apiKey:   apiKey,
+		gallery:  gallery,
+	}
+
+	for _, opt := range opts {
+		opt(api)
+	}
+
+	return api
+}
+
 type API struct {
-	cli     *http.Client
-	apiKey  string
+	cli      *http.Client
+	endpoint string
+	apiKey   string
+
+	mux     sync.RWMutex
 	gallery string
 }
 
-func (s *API) Upload(ctx context.Context, media entities.MediaFile) (string, error) {
+// Gallery returns id of the gallery images are uploaded to.
+func (s *API) Gallery() string {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	return s.gallery
+}
+
+// CreateAlbum creates new gallery with given title. Following uploads are placed into it.
+func (s *API) CreateAlbum(ctx context.Context, title string) error {
+	form := s.baseForm()
+	form.Add("name", title)
+
+	content, status, err := s.post(ctx, s.endpoint+galleryPath, form)
+	if err != nil {
+		return fmt.Errorf("create gallery: %w", err)
+	}
+
+	gallery, err := parseGalleryResponse(status, content)
+	if err != nil {
+		return fmt.Errorf("create gallery: %w", err)
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.gallery = gallery.ID
+
+	return nil
+}
+
+func (s *API) Upload(ctx context.Context, media entities.MediaFile) (entities.MediaFile, error) {
 	var (
-		form = make(url.Values)
+		form = s.baseForm()
 		ext  = strings.TrimPrefix(filepath.Ext(media.Name), ".")
 		hash = sha256.New()
 	)
 
-	if _, err := hash.Write(media.Data); err != nil {
-		return "", fmt.Errorf("generate file hash")
+	data, err := media.Content()
+	if err != nil {
+		return media, err // nolint: wrapcheck
+	}
+
+	if _, err := hash.Write(data); err != nil {
+		return media, fmt.Errorf("generate file hash")
 	}
 
 	nameNoExt := hex.EncodeToString(hash.Sum(nil))[:32]
 
-	image := base64.StdEncoding.EncodeToString(media.Data)
+	image := base64.StdEncoding.EncodeToString(data)
 
-	form.Add("o", o)
-	form.Add("m", m)
 	form.Add("name", nameNoExt)
 	form.Add("type", ext)
-	form.Add("version", version)
-	form.Add("portable", portable)
-	form.Add("key", s.apiKey)
 	form.Add("image", image)
 
-	request, err := http.NewRequestWithContext(ctx, http.MethodPost, uploadURL, strings.NewReader(form.Encode()))
-	if err != nil {
-		return "", fmt.Errorf("create request: %w", err)
+	if gallery := s.Gallery(); gallery != "" {
+		form.Add("gallery", gallery)
 	}
 
-	request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-
-	response, err := http.DefaultClient.Do(request)
+	content, status, err := s.post(ctx, s.endpoint+uploadPath, form)
 	if err != nil {
-		return "", fmt.Errorf("execute request: %w", err)
+		return media, err
 	}
-	defer response.Body.Close()
 
-	content, err := io.ReadAll(response.Body)
+	resp, err := parseResponse(status, content)
 	if err != nil {
-		return "", fmt.Errorf("read response body: %w", err)
+		return media, err
 	}
 
-	return ParseResponse(content)
+	media.URL = resp.Links.Hotlink
+	media.DeleteHandle = resp.Links.Delete
+
+	return media, nil
 }
 
-func ParseResponse(data []byte) (string, error) {
-	var resp response
+// Delete removes image by confirming its delete page, returned as delete handle on upload.
+func (s *API) Delete(ctx context.Context, deleteURL string) error {
+	_, status, err := s.post(ctx, deleteURL, url.Values{"confirm": []string{"1"}})
+	if err != nil {
+		return err
+	}
 
-	if err := xml.Unmarshal(data, &resp); err != nil {
-		return "", fmt.Errorf("parse response: %w", err)
+	if status >= http.StatusBadRequest {
+		return fmt.Errorf("delete image: %w", response{}.apiError(status))
 	}
 
-	return resp.Links.Hotlink, nil
+	return nil
+}
+
+func (s *API) baseForm() url.Values {
+	form := make(url.Values)
+
+	form.Add("o", o)
+	form.Add("m", m)
+	form.Add("version", version)
+	form.Add("portable", portable)
+	form.Add("key", s.apiKey)
+
+	return form
 }
 
-type response struct {
-	XMLName xml.Name `xml:"data"`
-	Success string   `xml:"success,attr"`
-	Status  string   `xml:"status,attr"`
-	Links   struct {
-		Hotlink string `xml:"hotlink"`
-	} `xml:"links"`
+func (s *API) post(ctx context.Context, endpoint string, form url.Values) ([]byte, int, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, 0, fmt.Errorf("create request: %w", err)
+	}
+
+	request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	response, err := s.cli.Do(request)
+	if err != nil {
+		return nil, 0, fmt.Errorf("execute request: %w", err)
+	}
+	defer response.Body.Close()
+
+	content, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, 0, fmt.Errorf("read response body: %w", err)
+	}
+
+	return content, response.StatusCode, nil
 }
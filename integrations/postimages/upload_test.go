@@ -12,7 +12,36 @@ func TestParseResponse(t *testing.T) {
 	file, err := os.ReadFile("testdata/resp.xml")
 	require.NoError(t, err)
 
-	link, err := postimages.ParseResponse(file)
+	res, err := postimages.ParseResponse(file)
 	require.NoError(t, err)
-	require.Equal(t, "https://i.postimg.cc/KY92bYbL/02.png", link)
+	require.Equal(t, "https://i.postimg.cc/KY92bYbL/02.png", res.Links.Hotlink)
+	require.Equal(t, "https://postimg.cc/JyBgcMG4", res.Links.Page)
+	require.Equal(t, "https://postimg.cc/delete/0h4sywYB/952e55ab", res.Links.Delete)
+	require.Equal(t, "https://i.postimg.cc/JyBgcMG4/02.png", res.Links.Thumbnail)
+	require.EqualValues(t, 267874, res.Image.Size)
+}
+
+func TestParseResponseFailure(t *testing.T) {
+	tests := []struct {
+		file    string
+		err     error
+		message string
+	}{
+		{file: "error_key.xml", err: postimages.ErrBadRequest, message: "status 403: code invalid_key: Invalid API key"},
+		{file: "error_type.xml", err: postimages.ErrBadRequest, message: "Unsupported file type"},
+		{file: "error_unavailable.xml", err: postimages.ErrUnavailable, message: "temporarily unavailable"},
+		{file: "error_unknown.xml", err: postimages.ErrUploadFailed, message: "Upload failed"},
+		{file: "empty_hotlink.xml", err: postimages.ErrNoLink},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			file, err := os.ReadFile("testdata/" + tt.file)
+			require.NoError(t, err)
+
+			_, err = postimages.ParseResponse(file)
+			require.ErrorIs(t, err, tt.err)
+			require.ErrorContains(t, err, tt.message)
+		})
+	}
 }
@@ -0,0 +1,138 @@
+package telegraph
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"gitlab.com/toby3d/telegraph"
+
+	"github.com/bohdanch-w/go-tgupload/entities"
+
+	wherr "github.com/bohdanch-w/wheel/errors"
+)
+
+// maxPageListLimit is the maximum number of pages returned by single getPageList call.
+const maxPageListLimit = 200
+
+// PageList returns pages of the account without content, most recent first, and their total count.
+func (a *API) PageList(ctx context.Context, offset, limit int) ([]entities.Page, int, error) {
+	list, err := a.account.GetPageList(offset, min(limit, maxPageListLimit))
+	if err != nil {
+		return nil, 0, fmt.Errorf("get page list: %w", err)
+	}
+
+	pages := make([]entities.Page, 0, len(list.Pages))
+	for _, p := range list.Pages {
+		pages = append(pages, fromPage(p))
+	}
+
+	return pages, list.TotalCount, nil
+}
+
+// Page returns page with its content.
+func (a *API) Page(ctx context.Context, pageURL string) (entities.Page, error) {
+	path, err := pagePath(pageURL)
+	if err != nil {
+		return entities.Page{}, err
+	}
+
+	p, err := telegraph.GetPage(path, true)
+	if err != nil {
+		return entities.Page{}, fmt.Errorf("get page: %w", err)
+	}
+
+	return fromPage(*p), nil
+}
+
+func pagePath(pageURL string) (string, error) {
+	path := strings.TrimPrefix(strings.TrimPrefix(pageURL, TelegraphAddress), "/")
+	if path == "" || strings.Contains(path, "/") {
+		return "", wherr.Errorf("%w: %q", "invalid page url", pageURL)
+	}
+
+	return path, nil
+}
+
+func fromPage(p telegraph.Page) entities.Page {
+	page := entities.Page{
+		URL:         p.URL,
+		Title:       p.Title,
+		Description: p.Description,
+	}
+
+	for _, n := range p.Content {
+		if node, ok := fromNode(n); ok {
+			page.Content = append(page.Content, node)
+		}
+	}
+
+	return page
+}
+
+// fromNode converts element of page content. Decoded content consists of
+// strings and generic maps, rather than NodeElement values.
+func fromNode(n telegraph.Node) (entities.Node, bool) {
+	var (
+		node     entities.Node
+		children []any
+	)
+
+	switch v := n.(type) {
+	case telegraph.NodeElement:
+		return fromNodeElement(v), true
+	case *telegraph.NodeElement:
+		return fromNodeElement(*v), true
+	case map[string]any:
+		node.Tag, _ = v["tag"].(string)
+
+		if attrs, ok := v["attrs"].(map[string]any); ok {
+			node.Attrs = make(map[string]string, len(attrs))
+
+			for k, attr := range attrs {
+				if s, ok := attr.(string); ok {
+					node.Attrs[k] = s
+				}
+			}
+		}
+
+		children, _ = v["children"].([]any)
+	default:
+		return node, false
+	}
+
+	node.Children = fromChildren(children)
+
+	return node, true
+}
+
+func fromNodeElement(el telegraph.NodeElement) entities.Node {
+	children := make([]any, 0, len(el.Children))
+	for _, c := range el.Children {
+		children = append(children, c)
+	}
+
+	return entities.Node{
+		Tag:      el.Tag,
+		Attrs:    el.Attrs,
+		Children: fromChildren(children),
+	}
+}
+
+func fromChildren(children []any) []any {
+	res := make([]any, 0, len(children))
+
+	for _, c := range children {
+		if s, ok := c.(string); ok {
+			res = append(res, s)
+
+			continue
+		}
+
+		if child, ok := fromNode(c); ok {
+			res = append(res, child)
+		}
+	}
+
+	return res
+}
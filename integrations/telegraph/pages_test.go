@@ -0,0 +1,86 @@
+package telegraph
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.com/toby3d/telegraph"
+
+	"github.com/bohdanch-w/go-tgupload/entities"
+)
+
+func TestFromPage(t *testing.T) {
+	img := func(src string) entities.Node {
+		return entities.Node{Tag: "img", Attrs: map[string]string{"src": src}, Children: []any{}}
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		want    []entities.Node
+	}{
+		{
+			name:    "figure with images",
+			content: `[{"tag":"figure","children":[{"tag":"img","attrs":{"src":"/a.png"}},{"tag":"img","attrs":{"src":"/b.png"}}]}]`,
+			want: []entities.Node{
+				{Tag: "figure", Children: []any{img("/a.png"), img("/b.png")}},
+			},
+		},
+		{
+			name:    "link around image",
+			content: `[{"tag":"p","children":["text",{"tag":"a","attrs":{"href":"/full.png"},"children":[{"tag":"img","attrs":{"src":"/thumb.png"}}]}]}]`,
+			want: []entities.Node{{
+				Tag: "p",
+				Children: []any{"text", entities.Node{
+					Tag:      "a",
+					Attrs:    map[string]string{"href": "/full.png"},
+					Children: []any{img("/thumb.png")},
+				}},
+			}},
+		},
+		{
+			name:    "deeply nested iframe",
+			content: `[{"tag":"blockquote","children":[{"tag":"figure","children":[{"tag":"iframe","attrs":{"src":"/embed"}},{"tag":"figcaption","children":["caption"]}]}]}]`,
+			want: []entities.Node{{
+				Tag: "blockquote",
+				Children: []any{entities.Node{
+					Tag: "figure",
+					Children: []any{
+						entities.Node{Tag: "iframe", Attrs: map[string]string{"src": "/embed"}, Children: []any{}},
+						entities.Node{Tag: "figcaption", Children: []any{"caption"}},
+					},
+				}},
+			}},
+		},
+		{
+			name:    "text and unknown values",
+			content: `["top level text",{"tag":"p","attrs":{"href":1},"children":[2,null,"text"]}]`,
+			want: []entities.Node{
+				{Tag: "p", Attrs: map[string]string{}, Children: []any{"text"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p telegraph.Page
+
+			require.NoError(t, json.Unmarshal([]byte(`{"content":`+tt.content+`}`), &p))
+			require.Equal(t, tt.want, fromPage(p).Content)
+		})
+	}
+}
+
+func TestFromPageElements(t *testing.T) {
+	p := telegraph.Page{Content: []telegraph.Node{
+		telegraph.NodeElement{Tag: "figure", Children: []telegraph.Node{
+			&telegraph.NodeElement{Tag: "img", Attrs: map[string]string{"src": "/a.png"}},
+		}},
+	}}
+
+	require.Equal(t, []entities.Node{{
+		Tag:      "figure",
+		Children: []any{entities.Node{Tag: "img", Attrs: map[string]string{"src": "/a.png"}, Children: []any{}}},
+	}}, fromPage(p).Content)
+}
@@ -29,18 +29,22 @@ func toNode(div entities.Node) telegraph.NodeElement {
 	}
 }
 
-func (a *API) CreatePage(ctx context.Context, page entities.Page) (string, error) {
+func toContent(page entities.Page) []telegraph.Node {
 	html := make([]telegraph.Node, 0, len(page.Content))
 	for _, div := range page.Content {
 		html = append(html, toNode(div))
 	}
 
+	return html
+}
+
+func (a *API) CreatePage(ctx context.Context, page entities.Page) (string, error) {
 	p, err := a.account.CreatePage(telegraph.Page{
 		Title:       page.Title,
 		AuthorName:  a.account.AuthorName,
 		AuthorURL:   a.account.AuthorURL,
 		Description: page.Description,
-		Content:     html,
+		Content:     toContent(page),
 	}, true)
 	if err != nil {
 		return "", fmt.Errorf("create page: %w", err)
@@ -48,3 +52,25 @@ func (a *API) CreatePage(ctx context.Context, page entities.Page) (string, error
 
 	return p.URL, nil
 }
+
+// EditPage replaces content of the page, created by the account before.
+func (a *API) EditPage(ctx context.Context, pageURL string, page entities.Page) error {
+	path, err := pagePath(pageURL)
+	if err != nil {
+		return err
+	}
+
+	_, err = a.account.EditPage(telegraph.Page{
+		Path:        path,
+		Title:       page.Title,
+		AuthorName:  a.account.AuthorName,
+		AuthorURL:   a.account.AuthorURL,
+		Description: page.Description,
+		Content:     toContent(page),
+	}, false)
+	if err != nil {
+		return fmt.Errorf("edit page: %w", err)
+	}
+
+	return nil
+}
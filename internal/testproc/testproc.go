@@ -0,0 +1,63 @@
+// Package testproc runs helpers of tests in separate processes of the test binary,
+// e.g. to check that concurrent runs don't lose each other's changes.
+package testproc
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// helperEnv names the helper process is started for.
+const helperEnv = "GOTG_TEST_HELPER"
+
+// Helper is executed in separate process with arguments given to Command.
+type Helper func(args []string) error
+
+// Command returns command running the test binary as separate process, which executes
+// the named helper of TestHelperProcess with the arguments.
+func Command(helper string, args ...string) *exec.Cmd {
+	cmd := exec.Command(os.Args[0], append([]string{"-test.run=^TestHelperProcess$", "--"}, args...)...)
+	cmd.Env = append(os.Environ(), helperEnv+"="+helper)
+
+	return cmd
+}
+
+// Run executes the named helper in separate process and fails the test with its output on error.
+func Run(t *testing.T, helper string, args ...string) {
+	t.Helper()
+
+	out, err := Command(helper, args...).CombinedOutput()
+	require.NoError(t, err, string(out))
+}
+
+// Main is called by TestHelperProcess of the package, which is not a real test, but the entry point
+// of processes started by Command. It executes the helper the process is started for and exits.
+func Main(t *testing.T, helpers map[string]Helper) {
+	t.Helper()
+
+	name := os.Getenv(helperEnv)
+	if name == "" {
+		t.Skip("helper process")
+	}
+
+	args := os.Args
+	for len(args) > 0 && args[0] != "--" {
+		args = args[1:]
+	}
+
+	err := fmt.Errorf("unknown helper %q", name) // nolint: err113
+	if helper, ok := helpers[name]; ok {
+		err = helper(args[1:])
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	os.Exit(0)
+}
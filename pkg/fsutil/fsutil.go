@@ -0,0 +1,74 @@
+// Package fsutil provides file operations safe for concurrent use by several processes.
+package fsutil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const lockExt = ".lock"
+
+// Lock blocks until exclusive advisory lock of the file at the path is acquired and
+// returns function releasing it. Lock is kept in separate file next to the path, so that
+// the file itself may be replaced, e.g. by WriteFile. Lock is released by OS if process dies.
+func Lock(path string) (func() error, error) {
+	f, err := os.OpenFile(path+lockExt, os.O_RDWR|os.O_CREATE, 0o600) // nolint: mnd
+	if err != nil {
+		return nil, fmt.Errorf("open lock file: %w", err)
+	}
+
+	if err := LockFile(f); err != nil {
+		f.Close()
+
+		return nil, err
+	}
+
+	return func() error {
+		if err := UnlockFile(f); err != nil {
+			f.Close()
+
+			return err
+		}
+
+		return f.Close() // nolint: wrapcheck
+	}, nil
+}
+
+// WriteFile atomically replaces file at the path: data is written to temporary file
+// in the same directory, which is renamed to the path, so readers never see partial content.
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("create temporary file: %w", err)
+	}
+
+	// removal fails once the file is renamed
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+
+		return fmt.Errorf("write temporary file: %w", err)
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+
+		return fmt.Errorf("sync temporary file: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close temporary file: %w", err)
+	}
+
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return fmt.Errorf("set file mode: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("replace file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package fsutil_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bohdanch-w/go-tgupload/pkg/fsutil"
+)
+
+func TestWriteFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.json")
+
+	require.NoError(t, fsutil.WriteFile(path, []byte("long content"), 0o600))
+	require.NoError(t, fsutil.WriteFile(path, []byte("short"), 0o600))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "short", string(data))
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	require.Len(t, entries, 1, "temporary files are not left")
+}
+
+func TestTryLockFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data")
+
+	first, err := os.Create(path)
+	require.NoError(t, err)
+
+	defer first.Close()
+
+	second, err := os.Open(path)
+	require.NoError(t, err)
+
+	defer second.Close()
+
+	ok, err := fsutil.TryLockFile(first)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	ok, err = fsutil.TryLockFile(second)
+	require.NoError(t, err)
+	require.False(t, ok, "file is locked by other descriptor")
+
+	require.NoError(t, fsutil.UnlockFile(first))
+
+	ok, err = fsutil.TryLockFile(second)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.NoError(t, fsutil.UnlockFile(second))
+}
+
+func TestLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data")
+
+	unlock, err := fsutil.Lock(path)
+	require.NoError(t, err)
+
+	lockFile, err := os.Open(path + ".lock")
+	require.NoError(t, err)
+
+	defer lockFile.Close()
+
+	ok, err := fsutil.TryLockFile(lockFile)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	require.NoError(t, unlock())
+
+	ok, err = fsutil.TryLockFile(lockFile)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.NoError(t, fsutil.UnlockFile(lockFile))
+}
@@ -0,0 +1,48 @@
+//go:build !windows
+
+package fsutil
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// LockFile blocks until exclusive advisory lock of the open file is acquired.
+func LockFile(f *os.File) error {
+	for {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+		if !errors.Is(err, syscall.EINTR) {
+			return wrapLockErr(err)
+		}
+	}
+}
+
+// TryLockFile acquires exclusive advisory lock of the open file without waiting
+// and reports whether it succeeded.
+func TryLockFile(f *os.File) (bool, error) {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return false, nil
+	}
+
+	return err == nil, wrapLockErr(err)
+}
+
+// UnlockFile releases lock of the open file.
+func UnlockFile(f *os.File) error {
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_UN); err != nil {
+		return fmt.Errorf("unlock file: %w", err)
+	}
+
+	return nil
+}
+
+func wrapLockErr(err error) error {
+	if err != nil {
+		return fmt.Errorf("lock file: %w", err)
+	}
+
+	return nil
+}
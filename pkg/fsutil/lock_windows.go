@@ -0,0 +1,52 @@
+//go:build windows
+
+package fsutil
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// whole file is locked by the maximal byte range
+const (
+	lockRangeLow  = ^uint32(0)
+	lockRangeHigh = ^uint32(0)
+)
+
+// LockFile blocks until exclusive advisory lock of the open file is acquired.
+func LockFile(f *os.File) error {
+	return lockFile(f, windows.LOCKFILE_EXCLUSIVE_LOCK)
+}
+
+// TryLockFile acquires exclusive advisory lock of the open file without waiting
+// and reports whether it succeeded.
+func TryLockFile(f *os.File) (bool, error) {
+	err := lockFile(f, windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY)
+	if errors.Is(err, windows.ERROR_LOCK_VIOLATION) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// UnlockFile releases lock of the open file.
+func UnlockFile(f *os.File) error {
+	err := windows.UnlockFileEx(windows.Handle(f.Fd()), 0, lockRangeLow, lockRangeHigh, new(windows.Overlapped))
+	if err != nil {
+		return fmt.Errorf("unlock file: %w", err)
+	}
+
+	return nil
+}
+
+func lockFile(f *os.File, flags uint32) error {
+	err := windows.LockFileEx(windows.Handle(f.Fd()), flags, 0, lockRangeLow, lockRangeHigh, new(windows.Overlapped))
+	if err != nil {
+		return fmt.Errorf("lock file: %w", err)
+	}
+
+	return nil
+}
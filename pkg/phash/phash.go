@@ -0,0 +1,140 @@
+// Package phash computes perceptual hashes of images, which stay close for copies of the same
+// image saved with different encoder settings or resized, unlike content hashes.
+package phash
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"math/bits"
+	"strconv"
+
+	// decoders of supported formats
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	_ "golang.org/x/image/webp"
+)
+
+// DefaultDistance is the Hamming distance, within which re-encoded copies of the same image
+// usually are. Different images rarely get this close.
+const DefaultDistance = 8
+
+// image is shrunk to grid of hashWidth x hashHeight cells, neighbour cells of a row
+// give single bit of the hash
+const (
+	hashWidth  = 9
+	hashHeight = 8
+
+	// maxSamples limits number of pixels averaged per cell side, so that big images are hashed fast
+	maxSamples = 16
+)
+
+// Hash is 64 bit difference hash (dHash) of the image.
+type Hash uint64
+
+// Compute decodes the image and returns its hash. JPEG, PNG, GIF and WebP images are supported.
+func Compute(data []byte) (Hash, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return 0, fmt.Errorf("decode image: %w", err)
+	}
+
+	return DHash(img), nil
+}
+
+// DHash returns difference hash of the image: it is shrunk to 9x8 grayscale grid by averaging,
+// and every bit tells whether cell is brighter than its right neighbour.
+func DHash(img image.Image) Hash {
+	var (
+		b    = img.Bounds()
+		grid [hashHeight][hashWidth]float64
+		hash Hash
+	)
+
+	for cy := range hashHeight {
+		y0, y1 := cellRange(b.Min.Y, b.Dy(), cy, hashHeight)
+
+		for cx := range hashWidth {
+			x0, x1 := cellRange(b.Min.X, b.Dx(), cx, hashWidth)
+			grid[cy][cx] = average(img, x0, x1, y0, y1)
+		}
+	}
+
+	for cy := range hashHeight {
+		for cx := range hashWidth - 1 {
+			hash <<= 1
+
+			if grid[cy][cx] > grid[cy][cx+1] {
+				hash |= 1
+			}
+		}
+	}
+
+	return hash
+}
+
+// cellRange returns pixel range of the cell, at least one pixel wide.
+func cellRange(start, size, cell, cells int) (int, int) {
+	from := start + cell*size/cells
+	to := start + (cell+1)*size/cells
+
+	return from, max(to, min(from+1, start+size))
+}
+
+// average returns mean luminance of sampled pixels of the rectangle.
+func average(img image.Image, x0, x1, y0, y1 int) float64 {
+	var (
+		sum   float64
+		count int
+		stepX = max((x1-x0)/maxSamples, 1)
+		stepY = max((y1-y0)/maxSamples, 1)
+	)
+
+	for y := y0; y < y1; y += stepY {
+		for x := x0; x < x1; x += stepX {
+			sum += luminance(img, x, y)
+			count++
+		}
+	}
+
+	if count == 0 {
+		return 0
+	}
+
+	return sum / float64(count)
+}
+
+func luminance(img image.Image, x, y int) float64 {
+	switch img := img.(type) {
+	case *image.YCbCr:
+		return float64(img.Y[img.YOffset(x, y)])
+	case *image.Gray:
+		return float64(img.GrayAt(x, y).Y)
+	}
+
+	r, g, b, _ := img.At(x, y).RGBA()
+
+	// the same weights as of Y in YCbCr, scaled from 16 to 8 bit values
+	return (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)) / 257 // nolint: mnd
+}
+
+// Distance returns number of different bits of the hashes. The lower it is, the more images are alike.
+func (h Hash) Distance(other Hash) int {
+	return bits.OnesCount64(uint64(h ^ other))
+}
+
+func (h Hash) String() string {
+	return fmt.Sprintf("%016x", uint64(h))
+}
+
+// Parse decodes hash returned by String.
+func Parse(s string) (Hash, error) {
+	v, err := strconv.ParseUint(s, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse perceptual hash %q: %w", s, err)
+	}
+
+	return Hash(v), nil
+}
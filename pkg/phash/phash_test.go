@@ -0,0 +1,118 @@
+package phash_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bohdanch-w/go-tgupload/pkg/phash"
+)
+
+// page draws test image: diagonal gradient with dark rectangle, shifted by seed.
+func page(width, height, seed int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := range height {
+		for x := range width {
+			v := uint8((x*255/width + y*seed*255/height) % 256) // nolint: gosec
+
+			if x > width*seed/10 && x < width/2+width*seed/10 && y > height/3 && y < height*2/3 {
+				v /= 4
+			}
+
+			img.Set(x, y, color.RGBA{R: v, G: v / 2, B: 255 - v, A: 255})
+		}
+	}
+
+	return img
+}
+
+func encodeJPEG(t *testing.T, img image.Image, quality int) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}))
+
+	return buf.Bytes()
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+
+	return buf.Bytes()
+}
+
+func TestCompute(t *testing.T) {
+	var (
+		original = page(800, 1200, 1)
+		resized  = page(400, 600, 1)
+		other    = page(800, 1200, 3)
+	)
+
+	hash, err := phash.Compute(encodePNG(t, original))
+	require.NoError(t, err)
+
+	for name, data := range map[string][]byte{
+		"jpeg high quality": encodeJPEG(t, original, 95),
+		"jpeg low quality":  encodeJPEG(t, original, 30),
+		"resized":           encodePNG(t, resized),
+	} {
+		similar, err := phash.Compute(data)
+		require.NoError(t, err, name)
+		require.LessOrEqual(t, hash.Distance(similar), phash.DefaultDistance, name)
+	}
+
+	different, err := phash.Compute(encodeJPEG(t, other, 95))
+	require.NoError(t, err)
+	require.Greater(t, hash.Distance(different), phash.DefaultDistance)
+
+	_, err = phash.Compute([]byte("not an image"))
+	require.Error(t, err)
+}
+
+func TestComputeWebP(t *testing.T) {
+	var hashes []phash.Hash
+
+	for _, name := range []string{"page.lossless.webp", "page.lossy.webp"} {
+		data, err := os.ReadFile(filepath.Join("testdata", name))
+		require.NoError(t, err)
+
+		hash, err := phash.Compute(data)
+		require.NoError(t, err, name)
+
+		hashes = append(hashes, hash)
+	}
+
+	require.LessOrEqual(t, hashes[0].Distance(hashes[1]), phash.DefaultDistance)
+}
+
+func TestHashString(t *testing.T) {
+	hash := phash.Hash(0x00ff00ff12345678)
+
+	parsed, err := phash.Parse(hash.String())
+	require.NoError(t, err)
+	require.Equal(t, hash, parsed)
+	require.Equal(t, "00ff00ff12345678", hash.String())
+	require.Zero(t, hash.Distance(parsed))
+	require.Equal(t, 64, hash.Distance(^hash))
+
+	_, err = phash.Parse("xyz")
+	require.Error(t, err)
+}
+
+func TestTinyImage(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 2, 1))
+	img.SetGray(0, 0, color.Gray{Y: 255})
+
+	require.NotPanics(t, func() { phash.DHash(img) })
+}
@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+)
+
+// SniffLen is the amount of data used for content type detection.
+const SniffLen = 512
+
+// ContentType detects media type by file extension, falling back to content sniffing.
+func ContentType(name string, data []byte) string {
+	if typ := mime.TypeByExtension(filepath.Ext(name)); typ != "" {
+		return typ
+	}
+
+	return http.DetectContentType(data)
+}
+
+// ReadDigest reads content to the end writing it to the hash. It returns content size and its head,
+// suitable for ContentType, so that large files are not kept in memory.
+func ReadDigest(r io.Reader, h hash.Hash) (int64, []byte, error) {
+	head := make([]byte, SniffLen)
+
+	n, err := io.ReadFull(r, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return 0, nil, fmt.Errorf("read content: %w", err)
+	}
+
+	h.Write(head[:n])
+
+	size, err := io.Copy(h, r)
+	if err != nil {
+		return 0, nil, fmt.Errorf("read content: %w", err)
+	}
+
+	return int64(n) + size, head[:n], nil
+}
@@ -0,0 +1,23 @@
+package utils_test
+
+import (
+	"testing"
+
+	"github.com/bohdanch-w/go-tgupload/pkg/utils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatSize(t *testing.T) {
+	tests := map[int64]string{
+		0:             "0 B",
+		1023:          "1023 B",
+		1024:          "1.0 KiB",
+		1536:          "1.5 KiB",
+		5 << 20:       "5.0 MiB",
+		3<<30 + 1<<29: "3.5 GiB",
+	}
+
+	for in, expected := range tests {
+		require.Equal(t, expected, utils.FormatSize(in), in)
+	}
+}
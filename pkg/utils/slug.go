@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// cyrillic holds transliteration of cyrillic letters, which have no ASCII decomposition.
+var cyrillic = map[rune]string{ // nolint: gochecknoglobals
+	'а': "a", 'б': "b", 'в': "v", 'г': "h", 'ґ': "g", 'д': "d", 'е': "e", 'є': "ie", 'ё': "io",
+	'ж': "zh", 'з': "z", 'и': "y", 'і': "i", 'ї': "i", 'й': "i", 'к': "k", 'л': "l", 'м': "m",
+	'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh",
+	'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "iu",
+	'я': "ia",
+}
+
+// Slug converts string to lowercase URL-safe form: latin letters, digits and single dashes.
+// Diacritics are dropped and cyrillic is transliterated, other characters are replaced with dash.
+func Slug(s string) string {
+	var sb strings.Builder
+
+	dash := false
+
+	write := func(part string) {
+		if part == "" {
+			return
+		}
+
+		if dash && sb.Len() != 0 {
+			sb.WriteByte('-')
+		}
+
+		dash = false
+
+		sb.WriteString(part)
+	}
+
+	for _, r := range norm.NFKD.String(strings.ToLower(s)) {
+		switch {
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			write(string(r))
+		case unicode.Is(unicode.Mn, r): // combining marks of decomposed letters
+		default:
+			if tr, ok := cyrillic[r]; ok {
+				write(tr)
+			} else {
+				dash = true
+			}
+		}
+	}
+
+	return sb.String()
+}
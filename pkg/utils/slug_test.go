@@ -0,0 +1,23 @@
+package utils_test
+
+import (
+	"testing"
+
+	"github.com/bohdanch-w/go-tgupload/pkg/utils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlug(t *testing.T) {
+	tests := map[string]string{
+		"Hello, World!":          "hello-world",
+		"  Chapter 01 / Part 2 ": "chapter-01-part-2",
+		"Café déjà vu":           "cafe-deja-vu",
+		"Привіт, світ":           "pryvit-svit",
+		"already-slug_name.v2":   "already-slug-name-v2",
+		"日本語":                    "",
+	}
+
+	for in, expected := range tests {
+		require.Equal(t, expected, utils.Slug(in), in)
+	}
+}
@@ -0,0 +1,233 @@
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/bohdanch-w/go-tgupload/entities"
+	"github.com/bohdanch-w/go-tgupload/services"
+)
+
+// argSeparator separates backend name from its argument, e.g. "exec:my-plugin".
+const argSeparator = ":"
+
+// ErrIdentityChanged means that backend can't be configured as it was, when files were stored.
+const ErrIdentityChanged = entities.Error("cdn configuration changed")
+
+// fingerprintLen is the number of hash bytes identifying sensitive value.
+const fingerprintLen = 8
+
+// Backend describes CDN implementation available to the user.
+type Backend struct {
+	// Name is used to select backend in --cdn flag and preferred-cdn config.
+	Name string
+	// Syntax is shown in help instead of Name, if backend requires an argument.
+	Syntax string
+	// Options are config keys of the backend, also exposed as command line flags.
+	Options []Option
+	// New creates backend from resolved option values.
+	New func(ctx context.Context, params Params) (services.CDN, error)
+}
+
+// Option is a single configuration value of the backend.
+type Option struct {
+	// Key in the config file.
+	Key string
+	// Flag name, defaults to Key.
+	Flag      string
+	Usage     string
+	Aliases   []string
+	EnvVars   []string
+	Hidden    bool
+	Sensitive bool
+	// Identity marks options, which define where files are stored, e.g. bucket or account.
+	// Cached uploads are reused only while identity of the backend stays the same.
+	Identity bool
+}
+
+func (o Option) FlagName() string {
+	if o.Flag == "" {
+		return o.Key
+	}
+
+	return o.Flag
+}
+
+// Params are passed to backend constructor.
+type Params struct {
+	// Arg is the part of cdn type after colon, e.g. "my-plugin" for "exec:my-plugin".
+	Arg string
+	// Parallel is maximum number of concurrent uploads.
+	Parallel uint
+	// Profile is the name of used config profile.
+	Profile string
+	// Get returns option value by config key. Command line values take precedence over config.
+	Get func(key string) string
+}
+
+var (
+	backends = make(map[string]Backend) // nolint: gochecknoglobals
+	mux      sync.RWMutex               // nolint: gochecknoglobals
+)
+
+// Register makes backend available by its name. It panics if name is already taken.
+func Register(b Backend) {
+	mux.Lock()
+	defer mux.Unlock()
+
+	if b.Name == "" || b.New == nil {
+		panic("registry: invalid backend")
+	}
+
+	if _, ok := backends[b.Name]; ok {
+		panic(fmt.Sprintf("registry: backend %q registered twice", b.Name))
+	}
+
+	backends[b.Name] = b
+}
+
+// Lookup finds backend by cdn type and returns it with the type argument.
+func Lookup(typ string) (Backend, string, bool) {
+	mux.RLock()
+	defer mux.RUnlock()
+
+	name, arg, _ := strings.Cut(typ, argSeparator)
+	b, ok := backends[name]
+
+	return b, arg, ok
+}
+
+// Backends returns all registered backends sorted by name.
+func Backends() []Backend {
+	mux.RLock()
+	defer mux.RUnlock()
+
+	res := make([]Backend, 0, len(backends))
+	for _, b := range backends {
+		res = append(res, b)
+	}
+
+	slices.SortFunc(res, func(a, b Backend) int { return strings.Compare(a.Name, b.Name) })
+
+	return res
+}
+
+// Names returns names of registered backends as shown to the user.
+func Names() []string {
+	list := Backends()
+	names := make([]string, 0, len(list))
+
+	for _, b := range list {
+		if b.Syntax != "" {
+			names = append(names, b.Syntax)
+		} else {
+			names = append(names, b.Name)
+		}
+	}
+
+	return names
+}
+
+// SensitiveKeys returns config keys of all backends that hold secrets.
+func SensitiveKeys() []string {
+	var keys []string
+
+	for _, b := range Backends() {
+		for _, opt := range b.Options {
+			if opt.Sensitive {
+				keys = append(keys, opt.Key)
+			}
+		}
+	}
+
+	return keys
+}
+
+// Identity describes where backend of the type stores files: the type followed by values of
+// identity options, e.g. "s3{aws-s3-bucket=images}". Sensitive values are replaced by fingerprint.
+func Identity(typ string, get func(key string) string) string {
+	backend, _, ok := Lookup(typ)
+	if !ok {
+		return typ
+	}
+
+	var parts []string
+
+	for _, opt := range backend.Options {
+		v := get(opt.Key)
+		if !opt.Identity || v == "" {
+			continue
+		}
+
+		if opt.Sensitive {
+			sum := sha256.Sum256([]byte(v))
+			v = "sha256:" + hex.EncodeToString(sum[:fingerprintLen])
+		}
+
+		parts = append(parts, opt.Key+"="+v)
+	}
+
+	if len(parts) == 0 {
+		return typ
+	}
+
+	return typ + "{" + strings.Join(parts, ",") + "}"
+}
+
+// WithIdentity returns getter of options for backend, which stored files under the identity.
+// Identity options are taken from the identity, the rest are resolved via get. Sensitive values
+// are kept only as fingerprints, so they are resolved via get and must match the stored ones.
+func WithIdentity(identity string, get func(key string) string) (func(key string) string, error) {
+	typ, list, _ := strings.Cut(strings.TrimSuffix(identity, "}"), "{")
+
+	backend, _, ok := Lookup(typ)
+	if !ok {
+		return get, nil
+	}
+
+	stored := make(map[string]string)
+
+	for _, part := range strings.Split(list, ",") {
+		if key, v, ok := strings.Cut(part, "="); ok {
+			stored[key] = v
+		}
+	}
+
+	keys := make(map[string]bool)
+
+	for _, opt := range backend.Options {
+		if opt.Identity && !opt.Sensitive {
+			keys[opt.Key] = true
+		}
+	}
+
+	res := func(key string) string {
+		if keys[key] {
+			return stored[key]
+		}
+
+		return get(key)
+	}
+
+	if current := Identity(typ, res); current != identity {
+		return nil, fmt.Errorf("%w: stored as %s, now %s", ErrIdentityChanged, identity, current)
+	}
+
+	return res, nil
+}
+
+// Options returns options of all backends.
+func Options() []Option {
+	var opts []Option
+
+	for _, b := range Backends() {
+		opts = append(opts, b.Options...)
+	}
+
+	return opts
+}
@@ -0,0 +1,102 @@
+package registry_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bohdanch-w/go-tgupload/registry"
+	"github.com/bohdanch-w/go-tgupload/services"
+)
+
+func TestRegistry(t *testing.T) {
+	registry.Register(registry.Backend{
+		Name:   "test-exec",
+		Syntax: "test-exec:<name>",
+		Options: []registry.Option{
+			{Key: "test-exec-secret", Sensitive: true},
+			{Key: "test-exec-path", Flag: "path"},
+		},
+		New: func(context.Context, registry.Params) (services.CDN, error) { return nil, nil },
+	})
+
+	backend, arg, ok := registry.Lookup("test-exec:my-plugin")
+	require.True(t, ok)
+	require.Equal(t, "test-exec", backend.Name)
+	require.Equal(t, "my-plugin", arg)
+
+	_, _, ok = registry.Lookup("missing")
+	require.False(t, ok)
+
+	require.Contains(t, registry.Names(), "test-exec:<name>")
+	require.Contains(t, registry.SensitiveKeys(), "test-exec-secret")
+	require.NotContains(t, registry.SensitiveKeys(), "test-exec-path")
+	require.Equal(t, "path", backend.Options[1].FlagName())
+	require.Equal(t, "test-exec-secret", backend.Options[0].FlagName())
+
+	require.Panics(t, func() {
+		registry.Register(backend)
+	})
+}
+
+func TestIdentity(t *testing.T) {
+	registry.Register(registry.Backend{
+		Name: "test-identity",
+		Options: []registry.Option{
+			{Key: "test-identity-key", Sensitive: true, Identity: true},
+			{Key: "test-identity-bucket", Identity: true},
+			{Key: "test-identity-acl"},
+		},
+		New: func(context.Context, registry.Params) (services.CDN, error) { return nil, nil },
+	})
+
+	values := map[string]string{
+		"test-identity-key":    "secret",
+		"test-identity-bucket": "images",
+		"test-identity-acl":    "public-read",
+	}
+
+	identity := registry.Identity("test-identity", func(key string) string { return values[key] })
+	require.Equal(t, "test-identity{test-identity-key=sha256:2bb80d537b1da3e3,test-identity-bucket=images}", identity)
+	require.NotContains(t, identity, "secret")
+
+	require.Equal(t, "missing", registry.Identity("missing", func(string) string { return "" }))
+	require.Equal(t, "test-identity", registry.Identity("test-identity", func(string) string { return "" }))
+}
+
+func TestWithIdentity(t *testing.T) {
+	registry.Register(registry.Backend{
+		Name: "test-stored",
+		Options: []registry.Option{
+			{Key: "test-stored-key", Sensitive: true, Identity: true},
+			{Key: "test-stored-bucket", Identity: true},
+			{Key: "test-stored-prefix", Identity: true},
+			{Key: "test-stored-acl"},
+		},
+		New: func(context.Context, registry.Params) (services.CDN, error) { return nil, nil },
+	})
+
+	stored := registry.Identity("test-stored", func(key string) string {
+		return map[string]string{"test-stored-key": "secret", "test-stored-bucket": "old"}[key]
+	})
+
+	current := map[string]string{
+		"test-stored-key":    "secret",
+		"test-stored-bucket": "new",
+		"test-stored-prefix": "gallery",
+		"test-stored-acl":    "private",
+	}
+
+	get, err := registry.WithIdentity(stored, func(key string) string { return current[key] })
+	require.NoError(t, err)
+	require.Equal(t, "old", get("test-stored-bucket"))
+	require.Empty(t, get("test-stored-prefix"))
+	require.Equal(t, "secret", get("test-stored-key"))
+	require.Equal(t, "private", get("test-stored-acl"))
+
+	current["test-stored-key"] = "rotated"
+
+	_, err = registry.WithIdentity(stored, func(key string) string { return current[key] })
+	require.ErrorIs(t, err, registry.ErrIdentityChanged)
+}
@@ -7,5 +7,28 @@ import (
 )
 
 type CDN interface {
-	Upload(ctx context.Context, media entities.MediaFile) (string, error)
+	Upload(ctx context.Context, media entities.MediaFile) (entities.MediaFile, error)
+}
+
+// CDNDeleter is implemented by CDNs, which support removal of uploaded media.
+// Handle is the MediaFile.DeleteHandle returned on upload.
+type CDNDeleter interface {
+	Delete(ctx context.Context, handle string) error
+}
+
+// AlbumCDN is implemented by CDNs, which can group uploaded media into albums.
+// Media uploaded after CreateAlbum is placed into the created album.
+type AlbumCDN interface {
+	CreateAlbum(ctx context.Context, title string) error
+}
+
+// CDNRefresher is implemented by CDNs, which return links valid for a limited time.
+// Refresh issues new link for media uploaded before, setting its URL and ExpiresAt.
+type CDNRefresher interface {
+	Refresh(ctx context.Context, media entities.MediaFile) (entities.MediaFile, error)
+}
+
+// CDNLister is implemented by CDNs, which can enumerate all stored objects, e.g. for garbage collection.
+type CDNLister interface {
+	List(ctx context.Context) ([]entities.StoredObject, error)
 }
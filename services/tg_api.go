@@ -8,5 +8,9 @@ import (
 
 type TelegraphAPI interface {
 	CreatePage(ctx context.Context, page entities.Page) (string, error)
+	EditPage(ctx context.Context, pageURL string, page entities.Page) error
+	// PageList returns pages of the account without content, most recent first, and their total count.
+	PageList(ctx context.Context, offset, limit int) ([]entities.Page, int, error)
+	Page(ctx context.Context, pageURL string) (entities.Page, error)
 	Account(ctx context.Context, fields ...string) (entities.Account, error)
 }
@@ -0,0 +1,104 @@
+package azblob
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+
+	"github.com/bohdanch-w/go-tgupload/registry"
+	"github.com/bohdanch-w/go-tgupload/services"
+
+	wherr "github.com/bohdanch-w/wheel/errors"
+)
+
+const (
+	Name = "azblob"
+
+	AccountName = "azure-account-name"
+	AccountKey  = "azure-account-key"
+	SASToken    = "azure-sas-token"
+	Endpoint    = "azure-endpoint"
+	Container   = "azure-container"
+	Location    = "azure-location"
+	PublicURL   = "azure-public-url"
+)
+
+func init() { // nolint: gochecknoinits
+	registry.Register(registry.Backend{
+		Name: Name,
+		Options: []registry.Option{
+			{Key: AccountName, Hidden: true, Identity: true, EnvVars: []string{"AZURE_STORAGE_ACCOUNT"}},
+			{Key: AccountKey, Hidden: true, Sensitive: true, EnvVars: []string{"AZURE_STORAGE_KEY"}},
+			{Key: SASToken, Hidden: true, Sensitive: true, EnvVars: []string{"AZURE_STORAGE_SAS_TOKEN"}},
+			{Key: Endpoint, Hidden: true, Identity: true, EnvVars: []string{"AZURE_STORAGE_ENDPOINT"}},
+			{
+				Key:      Container,
+				Usage:    "name of the container for Azure Blob CDN",
+				Aliases:  []string{"container"},
+				EnvVars:  []string{"AZURE_STORAGE_CONTAINER"},
+				Identity: true,
+			},
+			{
+				Key:      Location,
+				Usage:    "location in the container for Azure Blob CDN",
+				EnvVars:  []string{"AZURE_STORAGE_LOCATION"},
+				Identity: true,
+			},
+			{
+				Key:      PublicURL,
+				Usage:    "prefix or template ({container}, {key}) for formed URL for Azure Blob CDN",
+				EnvVars:  []string{"AZURE_STORAGE_PUBLIC_URL"},
+				Identity: true,
+			},
+		},
+		New: newCDN,
+	})
+}
+
+func newCDN(_ context.Context, params registry.Params) (services.CDN, error) {
+	accountName := params.Get(AccountName)
+	accountKey := params.Get(AccountKey)
+	sasToken := params.Get(SASToken)
+	endpoint := params.Get(Endpoint)
+	container := params.Get(Container)
+	location := params.Get(Location)
+	publicURL := params.Get(PublicURL)
+
+	if endpoint == "" && accountName != "" {
+		endpoint = fmt.Sprintf("https://%s.blob.core.windows.net/", accountName)
+	}
+
+	if endpoint == "" || container == "" {
+		return nil, wherr.Error("azblob: invalid configuration")
+	}
+
+	var (
+		client *azblob.Client
+		err    error
+	)
+
+	switch {
+	case accountName != "" && accountKey != "":
+		cred, credErr := azblob.NewSharedKeyCredential(accountName, accountKey)
+		if credErr != nil {
+			return nil, fmt.Errorf("azblob: invalid shared key: %w", credErr)
+		}
+
+		client, err = azblob.NewClientWithSharedKeyCredential(endpoint, cred, nil)
+	case sasToken != "":
+		client, err = azblob.NewClientWithNoCredential(
+			strings.TrimRight(endpoint, "?")+"?"+strings.TrimPrefix(sasToken, "?"),
+			nil,
+		)
+	default:
+		return nil, wherr.Error("azblob: missing credentials")
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("azblob: create client: %w", err)
+	}
+
+	return NewMediaStorage(client, container, location, publicURL), nil
+}
@@ -0,0 +1,118 @@
+package azblob
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+
+	"github.com/bohdanch-w/go-tgupload/entities"
+	"github.com/bohdanch-w/go-tgupload/pkg/utils"
+	"github.com/bohdanch-w/go-tgupload/services"
+)
+
+const (
+	placeholderContainer = "{container}"
+	placeholderKey       = "{key}"
+)
+
+var (
+	_ services.CDN        = (*MediaStorage)(nil)
+	_ services.CDNDeleter = (*MediaStorage)(nil)
+)
+
+// NewMediaStorage creates storage, which puts media into the container under root prefix.
+func NewMediaStorage(client *azblob.Client, container, root, publicURL string) *MediaStorage {
+	publicURL = strings.TrimRight(publicURL, `/\`)
+	if publicURL == "" {
+		publicURL = strings.TrimRight(stripQuery(client.URL()), "/") + "/" + placeholderContainer + "/" + placeholderKey
+	}
+
+	return &MediaStorage{
+		client:    client,
+		container: container,
+		root:      strings.Trim(filepath.ToSlash(root), "/"),
+		publicURL: publicURL,
+	}
+}
+
+type MediaStorage struct {
+	client    *azblob.Client
+	container string
+	root      string
+	publicURL string
+}
+
+func (ms *MediaStorage) Store(ctx context.Context, key string, data []byte, contentType string) error {
+	_, err := ms.client.UploadBuffer(ctx, ms.container, ms.blobName(key), data, &azblob.UploadBufferOptions{
+		HTTPHeaders: &blob.HTTPHeaders{
+			BlobContentType: to.Ptr(contentType),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("azblob storage: upload blob: %w", err)
+	}
+
+	return nil
+}
+
+func (ms *MediaStorage) Upload(ctx context.Context, media entities.MediaFile) (entities.MediaFile, error) {
+	data, err := media.Content()
+	if err != nil {
+		return media, err // nolint: wrapcheck
+	}
+
+	ext := filepath.Ext(media.Name)
+	hash := sha256.Sum256(data)
+	key := hex.EncodeToString(hash[:])[:32] + ext
+
+	if err := ms.Store(ctx, key, data, utils.ContentType(media.Name, data)); err != nil {
+		return media, fmt.Errorf("store file: %w", err)
+	}
+
+	media.URL = ms.url(key)
+	media.DeleteHandle = ms.blobName(key)
+
+	return media, nil
+}
+
+// Delete removes blob by its name, returned as delete handle on upload.
+func (ms *MediaStorage) Delete(ctx context.Context, name string) error {
+	if _, err := ms.client.DeleteBlob(ctx, ms.container, name, nil); err != nil {
+		return fmt.Errorf("azblob storage: delete blob: %w", err)
+	}
+
+	return nil
+}
+
+func (ms *MediaStorage) blobName(key string) string {
+	return strings.TrimPrefix(path.Join(ms.root, key), "/")
+}
+
+func (ms *MediaStorage) url(key string) string {
+	name := ms.blobName(key)
+
+	if !strings.Contains(ms.publicURL, placeholderKey) {
+		return ms.publicURL + "/" + name
+	}
+
+	return strings.NewReplacer(
+		placeholderContainer, ms.container,
+		placeholderKey, name,
+	).Replace(ms.publicURL)
+}
+
+func stripQuery(u string) string {
+	if idx := strings.IndexByte(u, '?'); idx >= 0 {
+		return u[:idx]
+	}
+
+	return u
+}
@@ -0,0 +1,119 @@
+package azblob_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bohdanch-w/go-tgupload/entities"
+	azstorage "github.com/bohdanch-w/go-tgupload/storage/azblob"
+)
+
+type putRequest struct {
+	path        string
+	query       string
+	contentType string
+	blobType    string
+	body        []byte
+}
+
+func newFakeServer(t *testing.T) (*httptest.Server, <-chan putRequest) {
+	t.Helper()
+
+	reqs := make(chan putRequest, 1)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+
+		reqs <- putRequest{
+			path:        r.URL.Path,
+			query:       r.URL.RawQuery,
+			contentType: r.Header.Get("x-ms-blob-content-type"),
+			blobType:    r.Header.Get("x-ms-blob-type"),
+			body:        body,
+		}
+
+		w.Header().Set("ETag", `"0x8D0000000000000"`)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, reqs
+}
+
+func TestUpload(t *testing.T) {
+	srv, reqs := newFakeServer(t)
+
+	client, err := azblob.NewClientWithNoCredential(srv.URL+"/devstoreaccount1?sv=2022&sig=secret", nil)
+	require.NoError(t, err)
+
+	storage := azstorage.NewMediaStorage(client, "media", "/chapters/", "")
+
+	media, err := storage.Upload(context.Background(), entities.MediaFile{
+		Name: "01.png",
+		Data: []byte("image data"),
+	})
+	require.NoError(t, err)
+
+	req := <-reqs
+	require.Equal(t, "/devstoreaccount1/media/chapters/b41b86dcfdc6219bc2fb987591ad9995.png", req.path)
+	require.Contains(t, req.query, "sig=secret")
+	require.Equal(t, "image/png", req.contentType)
+	require.Equal(t, "BlockBlob", req.blobType)
+	require.Equal(t, []byte("image data"), req.body)
+	require.Equal(t, srv.URL+"/devstoreaccount1/media/chapters/b41b86dcfdc6219bc2fb987591ad9995.png", media.URL)
+}
+
+func TestUploadPublicURL(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		publicURL string
+		expected  string
+	}{
+		{
+			name:      "prefix",
+			publicURL: "https://cdn.example.com/",
+			expected:  "https://cdn.example.com/b41b86dcfdc6219bc2fb987591ad9995.jpg",
+		},
+		{
+			name:      "template",
+			publicURL: "https://{container}.example.com/img/{key}",
+			expected:  "https://media.example.com/img/b41b86dcfdc6219bc2fb987591ad9995.jpg",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv, reqs := newFakeServer(t)
+
+			client, err := azblob.NewClientWithNoCredential(srv.URL+"/devstoreaccount1", nil)
+			require.NoError(t, err)
+
+			storage := azstorage.NewMediaStorage(client, "media", "", tc.publicURL)
+
+			media, err := storage.Upload(context.Background(), entities.MediaFile{
+				Name: "01.jpg",
+				Data: []byte("image data"),
+			})
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, media.URL)
+
+			req := <-reqs
+			require.Equal(t, "image/jpeg", req.contentType)
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bohdanch-w/go-tgupload/registry"
+	"github.com/bohdanch-w/go-tgupload/services"
+
+	wherr "github.com/bohdanch-w/wheel/errors"
+)
+
+const (
+	Name = "exec"
+
+	execKeyPrefix = "cdn-exec-"
+)
+
+// ExecKey returns config key of the executable path for the plugin with given name.
+func ExecKey(name string) string {
+	return execKeyPrefix + name
+}
+
+func init() { // nolint: gochecknoinits
+	registry.Register(registry.Backend{
+		Name:   Name,
+		Syntax: Name + ":<name>",
+		New:    newCDN,
+	})
+}
+
+func newCDN(ctx context.Context, params registry.Params) (services.CDN, error) {
+	if params.Arg == "" {
+		return nil, wherr.Error("exec: plugin name is not specified")
+	}
+
+	path := params.Get(ExecKey(params.Arg))
+	if path == "" {
+		return nil, wherr.Errorf("%w: set %s", "exec: plugin is not configured", ExecKey(params.Arg))
+	}
+
+	p, err := Start(ctx, path, params.Parallel)
+	if err != nil {
+		return nil, fmt.Errorf("exec: %s: %w", params.Arg, err)
+	}
+
+	return p, nil
+}
@@ -0,0 +1,338 @@
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/semaphore"
+
+	"github.com/bohdanch-w/go-tgupload/entities"
+	"github.com/bohdanch-w/go-tgupload/pkg/utils"
+	"github.com/bohdanch-w/go-tgupload/services"
+
+	wherr "github.com/bohdanch-w/wheel/errors"
+)
+
+const (
+	ErrPluginExited = entities.Error("plugin exited")
+
+	closeTimeout = 5 * time.Second
+	// handshakeTimeout limits wait for plugin response to handshake, so that hung plugin doesn't block the run.
+	handshakeTimeout = 30 * time.Second
+)
+
+var (
+	_ services.CDN = (*Plugin)(nil)
+	_ io.Closer    = (*Plugin)(nil)
+)
+
+// Start runs plugin executable and performs the handshake, which is limited by ctx and handshakeTimeout.
+// Plugin process is kept alive until Close is called, at most parallel uploads are sent to it at once.
+func Start(ctx context.Context, path string, parallel uint) (*Plugin, error) {
+	cmd := exec.Command(path) // nolint: gosec
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("plugin stdin: %w", err)
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("plugin stdout: %w", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start plugin: %w", err)
+	}
+
+	p := &Plugin{
+		cmd:     cmd,
+		stdin:   stdin,
+		enc:     json.NewEncoder(stdin),
+		pending: make(map[uint64]chan UploadResponse),
+		exited:  make(chan struct{}),
+	}
+
+	dec := json.NewDecoder(bufio.NewReader(stdout))
+
+	if err := p.handshake(ctx, dec, parallel); err != nil {
+		p.kill()
+		_ = cmd.Wait()
+
+		return nil, err
+	}
+
+	go p.readLoop(dec)
+
+	return p, nil
+}
+
+type Plugin struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	enc   *json.Encoder
+	sem   *semaphore.Weighted
+	name  string
+
+	mux     sync.Mutex
+	lastID  uint64
+	pending map[uint64]chan UploadResponse
+	err     error
+
+	exited    chan struct{}
+	closeOnce sync.Once
+}
+
+// Name returns name reported by plugin on handshake.
+func (p *Plugin) Name() string {
+	return p.name
+}
+
+func (p *Plugin) Upload(ctx context.Context, media entities.MediaFile) (entities.MediaFile, error) {
+	if err := p.sem.Acquire(ctx, 1); err != nil {
+		return media, fmt.Errorf("wait for plugin: %w", err)
+	}
+
+	release := true
+
+	defer func() {
+		if release {
+			p.sem.Release(1)
+		}
+	}()
+
+	hash, head, err := digest(media)
+	if err != nil {
+		return media, err
+	}
+
+	req := UploadRequest{
+		Type:        MessageTypeUpload,
+		Path:        media.Path,
+		Name:        media.Name,
+		Hash:        hash,
+		ContentType: utils.ContentType(media.Name, head),
+	}
+
+	respCh, err := p.send(&req)
+	if err != nil {
+		return media, err
+	}
+
+	select {
+	case <-ctx.Done():
+		// plugin still processes the request, so its slot is taken until the response or plugin exit
+		release = false
+
+		go func() {
+			<-respCh
+			p.sem.Release(1)
+		}()
+
+		return media, ctx.Err() // nolint: wrapcheck
+	case resp, ok := <-respCh:
+		if !ok {
+			return media, p.exitErr()
+		}
+
+		if resp.Error != "" {
+			return media, wherr.Errorf("%w: %s", "plugin upload failed", resp.Error)
+		}
+
+		if resp.URL == "" {
+			return media, wherr.Error("plugin returned empty url")
+		}
+
+		media.URL = resp.URL
+
+		return media, nil
+	}
+}
+
+// digest returns hex SHA-256 of media content and its head. Plugin reads the file itself,
+// so content is streamed instead of loading.
+func digest(media entities.MediaFile) (string, []byte, error) {
+	r, err := media.Open()
+	if err != nil {
+		return "", nil, err // nolint: wrapcheck
+	}
+	defer r.Close()
+
+	h := sha256.New()
+
+	_, head, err := utils.ReadDigest(r, h)
+	if err != nil {
+		return "", nil, fmt.Errorf("hash media: %w", err)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), head, nil
+}
+
+// Close ends plugin session and waits for the process to exit.
+func (p *Plugin) Close() error {
+	var err error
+
+	p.closeOnce.Do(func() {
+		p.stdin.Close()
+
+		select {
+		case <-p.exited:
+		case <-time.After(closeTimeout):
+			p.kill()
+			<-p.exited
+		}
+
+		if waitErr := p.cmd.Wait(); waitErr != nil {
+			err = fmt.Errorf("plugin exit: %w", waitErr)
+		}
+	})
+
+	return err
+}
+
+func (p *Plugin) handshake(ctx context.Context, dec *json.Decoder, parallel uint) error {
+	if err := p.enc.Encode(Handshake{
+		Type:     MessageTypeHandshake,
+		Protocol: ProtocolVersion,
+		Parallel: parallel,
+	}); err != nil {
+		return fmt.Errorf("send handshake: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, handshakeTimeout)
+	defer cancel()
+
+	respCh := make(chan error, 1)
+
+	go func() {
+		var resp HandshakeResponse
+
+		if err := dec.Decode(&resp); err != nil {
+			respCh <- fmt.Errorf("read handshake: %w", err)
+
+			return
+		}
+
+		switch {
+		case resp.Type != MessageTypeHandshake:
+			respCh <- wherr.Errorf("%w: %q", "unexpected handshake message", resp.Type)
+		case resp.Error != "":
+			respCh <- wherr.Errorf("%w: %s", "plugin handshake failed", resp.Error)
+		case resp.Protocol != ProtocolVersion:
+			respCh <- wherr.Errorf("%w: %d", "unsupported plugin protocol", resp.Protocol)
+		default:
+			p.name = resp.Name
+			p.sem = semaphore.NewWeighted(int64(inFlight(resp.Capabilities, parallel)))
+			respCh <- nil
+		}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("wait for handshake: %w", ctx.Err())
+	case err := <-respCh:
+		return err
+	}
+}
+
+func (p *Plugin) readLoop(dec *json.Decoder) {
+	defer close(p.exited)
+
+	for {
+		var resp UploadResponse
+
+		if err := dec.Decode(&resp); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = ErrPluginExited
+			}
+
+			p.fail(err)
+
+			return
+		}
+
+		p.mux.Lock()
+		ch, ok := p.pending[resp.ID]
+		delete(p.pending, resp.ID)
+		p.mux.Unlock()
+
+		if ok {
+			ch <- resp
+		}
+	}
+}
+
+func (p *Plugin) send(req *UploadRequest) (<-chan UploadResponse, error) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	p.lastID++
+	req.ID = p.lastID
+
+	ch := make(chan UploadResponse, 1)
+	p.pending[req.ID] = ch
+
+	if err := p.enc.Encode(req); err != nil {
+		delete(p.pending, req.ID)
+
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+
+	return ch, nil
+}
+
+func (p *Plugin) fail(err error) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	p.err = err
+
+	for id, ch := range p.pending {
+		close(ch)
+		delete(p.pending, id)
+	}
+}
+
+func (p *Plugin) exitErr() error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	return p.err
+}
+
+func (p *Plugin) kill() {
+	if p.cmd.Process != nil {
+		_ = p.cmd.Process.Kill()
+	}
+}
+
+func inFlight(caps Capabilities, parallel uint) uint {
+	if !caps.Concurrent {
+		return 1
+	}
+
+	if parallel == 0 || (caps.MaxParallel != 0 && caps.MaxParallel < parallel) {
+		parallel = caps.MaxParallel
+	}
+
+	if parallel == 0 {
+		return 1
+	}
+
+	return parallel
+}
@@ -0,0 +1,149 @@
+package plugin_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/bohdanch-w/go-tgupload/entities"
+	"github.com/bohdanch-w/go-tgupload/storage/plugin"
+)
+
+func buildRefPlugin(t *testing.T) string {
+	t.Helper()
+
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go toolchain is not available")
+	}
+
+	bin := filepath.Join(t.TempDir(), "refplugin")
+
+	out, err := exec.Command(goBin, "build", "-o", bin, "./testdata/refplugin").CombinedOutput()
+	require.NoError(t, err, string(out))
+
+	return bin
+}
+
+func TestPluginUpload(t *testing.T) {
+	bin := buildRefPlugin(t)
+	srcDir, dstDir := t.TempDir(), t.TempDir()
+
+	t.Setenv("REFPLUGIN_DIR", dstDir)
+
+	p, err := plugin.Start(context.Background(), bin, 8)
+	require.NoError(t, err)
+	require.Equal(t, "refplugin", p.Name())
+
+	const filesCount = 20
+
+	urls := make([]string, filesCount)
+	group, ctx := errgroup.WithContext(context.Background())
+
+	for i := range filesCount {
+		path := filepath.Join(srcDir, fmt.Sprintf("%02d.png", i))
+		data := []byte(fmt.Sprintf("image %d", i))
+
+		require.NoError(t, os.WriteFile(path, data, 0o600))
+
+		group.Go(func() error {
+			media, err := p.Upload(ctx, entities.MediaFile{
+				Name: filepath.Base(path),
+				Path: path,
+				Data: data,
+			})
+			urls[i] = media.URL
+
+			return err
+		})
+	}
+
+	require.NoError(t, group.Wait())
+	require.NoError(t, p.Close())
+
+	for i, url := range urls {
+		require.Regexp(t, `^file://.+\.png$`, url)
+
+		data, err := os.ReadFile(url[len("file://"):])
+		require.NoError(t, err)
+		require.Equal(t, fmt.Sprintf("image %d", i), string(data))
+	}
+}
+
+func TestPluginUploadError(t *testing.T) {
+	bin := buildRefPlugin(t)
+
+	t.Setenv("REFPLUGIN_DIR", filepath.Join(t.TempDir(), "missing"))
+
+	p, err := plugin.Start(context.Background(), bin, 1)
+	require.NoError(t, err)
+
+	defer p.Close()
+
+	src := filepath.Join(t.TempDir(), "01.png")
+	require.NoError(t, os.WriteFile(src, []byte("image"), 0o600))
+
+	_, err = p.Upload(context.Background(), entities.MediaFile{Name: "01.png", Path: src})
+	require.ErrorContains(t, err, "create file")
+}
+
+func TestPluginHandshakeError(t *testing.T) {
+	bin := buildRefPlugin(t)
+
+	t.Setenv("REFPLUGIN_DIR", "")
+
+	_, err := plugin.Start(context.Background(), bin, 1)
+	require.ErrorContains(t, err, "REFPLUGIN_DIR is not set")
+}
+
+func TestPluginHandshakeTimeout(t *testing.T) {
+	bin := buildRefPlugin(t)
+
+	t.Setenv("REFPLUGIN_DIR", t.TempDir())
+	t.Setenv("REFPLUGIN_MODE", "hang")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	_, err := plugin.Start(ctx, bin, 1)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.ErrorContains(t, err, "wait for handshake")
+}
+
+func TestPluginCanceledUploadKeepsSlot(t *testing.T) {
+	bin := buildRefPlugin(t)
+	srcDir := t.TempDir()
+
+	t.Setenv("REFPLUGIN_DIR", t.TempDir())
+	t.Setenv("REFPLUGIN_MODE", "serial")
+
+	p, err := plugin.Start(context.Background(), bin, 1)
+	require.NoError(t, err)
+
+	defer p.Close()
+
+	media := func(name string) entities.MediaFile {
+		path := filepath.Join(srcDir, name)
+		require.NoError(t, os.WriteFile(path, []byte(name), 0o600))
+
+		return entities.MediaFile{Name: name, Path: path}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err = p.Upload(ctx, media("01.png"))
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// plugin is still uploading the canceled file, next request waits for it
+	res, err := p.Upload(context.Background(), media("02.png"))
+	require.NoError(t, err)
+	require.NotEmpty(t, res.URL)
+}
@@ -0,0 +1,54 @@
+package plugin
+
+// Plugin protocol is a newline delimited JSON exchanged over plugin stdin (requests)
+// and stdout (responses). Plugin stderr is forwarded to the user.
+//
+// Session starts with the handshake: host sends Handshake, plugin replies with HandshakeResponse.
+// After that host sends UploadRequest messages, possibly several at once, and the plugin replies
+// with UploadResponse for each of them in any order, matched by ID.
+// Session ends when host closes plugin stdin; plugin is expected to exit.
+
+const (
+	ProtocolVersion = 1
+
+	MessageTypeHandshake = "handshake"
+	MessageTypeUpload    = "upload"
+	MessageTypeResult    = "result"
+)
+
+type Handshake struct {
+	Type     string `json:"type"`
+	Protocol int    `json:"protocol"`
+	Parallel uint   `json:"parallel"`
+}
+
+type HandshakeResponse struct {
+	Type         string       `json:"type"`
+	Protocol     int          `json:"protocol"`
+	Name         string       `json:"name"`
+	Capabilities Capabilities `json:"capabilities"`
+	Error        string       `json:"error,omitempty"`
+}
+
+type Capabilities struct {
+	// Concurrent signals that plugin accepts new requests before previous are answered.
+	Concurrent bool `json:"concurrent"`
+	// MaxParallel limits number of requests in flight. Zero means no limit.
+	MaxParallel uint `json:"max_parallel,omitempty"`
+}
+
+type UploadRequest struct {
+	Type        string `json:"type"`
+	ID          uint64 `json:"id"`
+	Path        string `json:"path"`
+	Name        string `json:"name"`
+	Hash        string `json:"hash"`
+	ContentType string `json:"content_type"`
+}
+
+type UploadResponse struct {
+	Type  string `json:"type"`
+	ID    uint64 `json:"id"`
+	URL   string `json:"url,omitempty"`
+	Error string `json:"error,omitempty"`
+}
@@ -0,0 +1,138 @@
+// Reference CDN plugin. It "uploads" files by copying them into the directory
+// from REFPLUGIN_DIR environment variable and responds with file:// URLs.
+// REFPLUGIN_MODE changes behaviour for tests: "hang" never answers handshake,
+// "serial" uploads slowly and fails requests sent while other one is in progress.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bohdanch-w/go-tgupload/storage/plugin"
+)
+
+func main() {
+	dir := os.Getenv("REFPLUGIN_DIR")
+	mode := os.Getenv("REFPLUGIN_MODE")
+
+	dec := json.NewDecoder(bufio.NewReader(os.Stdin))
+	enc := json.NewEncoder(os.Stdout)
+
+	var handshake plugin.Handshake
+
+	if err := dec.Decode(&handshake); err != nil {
+		fmt.Fprintln(os.Stderr, "read handshake:", err)
+		os.Exit(1)
+	}
+
+	if mode == "hang" {
+		_, _ = io.Copy(io.Discard, os.Stdin)
+
+		return
+	}
+
+	resp := plugin.HandshakeResponse{
+		Type:     plugin.MessageTypeHandshake,
+		Protocol: plugin.ProtocolVersion,
+		Name:     "refplugin",
+		Capabilities: plugin.Capabilities{
+			Concurrent:  true,
+			MaxParallel: 4,
+		},
+	}
+
+	if handshake.Protocol != plugin.ProtocolVersion {
+		resp.Error = "unsupported protocol"
+	}
+
+	if dir == "" {
+		resp.Error = "REFPLUGIN_DIR is not set"
+	}
+
+	if err := enc.Encode(resp); err != nil || resp.Error != "" {
+		os.Exit(1)
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mux      sync.Mutex
+		inFlight atomic.Int32
+	)
+
+	for {
+		var req plugin.UploadRequest
+
+		if err := dec.Decode(&req); err != nil {
+			break // stdin closed by host
+		}
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			res := plugin.UploadResponse{
+				Type: plugin.MessageTypeResult,
+				ID:   req.ID,
+			}
+
+			if mode == "serial" {
+				if inFlight.Add(1) > 1 {
+					res.Error = "too many requests"
+				}
+
+				time.Sleep(300 * time.Millisecond)
+			}
+
+			if res.Error == "" {
+				url, err := store(dir, req)
+				if err != nil {
+					res.Error = err.Error()
+				} else {
+					res.URL = url
+				}
+			}
+
+			if mode == "serial" {
+				// request is done before the response is sent, host may send the next one right after it
+				inFlight.Add(-1)
+			}
+
+			mux.Lock()
+			defer mux.Unlock()
+
+			_ = enc.Encode(res)
+		}()
+	}
+
+	wg.Wait()
+}
+
+func store(dir string, req plugin.UploadRequest) (string, error) {
+	src, err := os.Open(req.Path)
+	if err != nil {
+		return "", fmt.Errorf("open source: %w", err)
+	}
+	defer src.Close()
+
+	dst := filepath.Join(dir, req.Hash[:32]+filepath.Ext(req.Name))
+
+	f, err := os.Create(dst)
+	if err != nil {
+		return "", fmt.Errorf("create file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, src); err != nil {
+		return "", fmt.Errorf("copy file: %w", err)
+	}
+
+	return "file://" + filepath.ToSlash(dst), nil
+}
@@ -0,0 +1,417 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/bohdanch-w/go-tgupload/registry"
+	"github.com/bohdanch-w/go-tgupload/services"
+
+	"github.com/bohdanch-w/wheel/collections"
+	wherr "github.com/bohdanch-w/wheel/errors"
+)
+
+const (
+	Name = "s3"
+
+	KeyID            = "aws-key-id"
+	SecretAccessKey  = "aws-secret-access-key"
+	SessionToken     = "aws-session-token"
+	AWSProfile       = "aws-profile"
+	Region           = "aws-region"
+	Endpoint         = "aws-endpoint"
+	Bucket           = "aws-s3-bucket"
+	Location         = "aws-s3-location"
+	PublicURL        = "aws-s3-public-url"
+	CacheControl     = "aws-s3-cache-control"
+	ACL              = "aws-s3-acl"
+	StorageClass     = "aws-s3-storage-class"
+	Metadata         = "aws-s3-metadata"
+	SkipExistingMode = "aws-s3-skip-existing"
+	PartSize         = "aws-s3-part-size"
+	Concurrency      = "aws-s3-concurrency"
+	URLModeKey       = "aws-s3-url-mode"
+	PresignExpiry    = "aws-s3-presign-expiry"
+	KeyTemplateKey   = "aws-s3-key-template"
+
+	PathStyle          = "aws-s3-path-style"
+	CABundle           = "aws-s3-ca-bundle"
+	InsecureSkipVerify = "aws-s3-insecure-skip-verify"
+	ChecksumMode       = "aws-s3-checksum"
+)
+
+// Values of ChecksumMode option.
+const (
+	ChecksumWhenSupported = "when-supported"
+	ChecksumWhenRequired  = "when-required"
+)
+
+// minPartSizeMiB is the minimal part size allowed by S3.
+const minPartSizeMiB = 5
+
+func init() { // nolint: gochecknoinits
+	registry.Register(registry.Backend{
+		Name: Name,
+		Options: []registry.Option{
+			{Key: KeyID, Hidden: true, Sensitive: true, EnvVars: []string{"AWS_KEY_ID", "AWS_ACCESS_KEY_ID"}},
+			{Key: SecretAccessKey, Hidden: true, Sensitive: true, EnvVars: []string{"AWS_SECRET_ACCESS_KEY"}},
+			{Key: SessionToken, Hidden: true, Sensitive: true, EnvVars: []string{"AWS_SESSION_TOKEN"}},
+			{
+				Key:     AWSProfile,
+				Usage:   "named profile of AWS shared config used by S3 CDN, if static keys aren't set",
+				EnvVars: []string{"AWS_PROFILE"},
+			},
+			{Key: Region, Hidden: true, Identity: true, EnvVars: []string{"AWS_REGION"}},
+			{Key: Endpoint, Hidden: true, Identity: true, EnvVars: []string{"AWS_ENDPOINT"}},
+			{
+				Key:      Bucket,
+				Usage:    "name of the bucket for S3 CDN",
+				Aliases:  []string{"bucket"},
+				EnvVars:  []string{"AWS_S3_BUCKET"},
+				Identity: true,
+			},
+			{
+				Key:      Location,
+				Usage:    "location in the bucket for S3 CDN",
+				Aliases:  []string{"location"},
+				EnvVars:  []string{"AWS_S3_LOCATION"},
+				Identity: true,
+			},
+			{
+				Key:      PublicURL,
+				Usage:    "prefix for formed URL for S3 CDN",
+				Aliases:  []string{"public-url"},
+				EnvVars:  []string{"AWS_S3_PUBLIC_URL"},
+				Identity: true,
+			},
+			{
+				Key:     CacheControl,
+				Usage:   "Cache-Control header of uploaded objects for S3 CDN",
+				EnvVars: []string{"AWS_S3_CACHE_CONTROL"},
+			},
+			{
+				Key:     ACL,
+				Usage:   "canned ACL of uploaded objects for S3 CDN, e.g. public-read",
+				EnvVars: []string{"AWS_S3_ACL"},
+			},
+			{
+				Key:     StorageClass,
+				Usage:   "storage class of uploaded objects for S3 CDN, e.g. STANDARD_IA",
+				EnvVars: []string{"AWS_S3_STORAGE_CLASS"},
+			},
+			{
+				Key:     Metadata,
+				Usage:   "comma separated key=value metadata of uploaded objects for S3 CDN",
+				EnvVars: []string{"AWS_S3_METADATA"},
+			},
+			{
+				Key:     SkipExistingMode,
+				Usage:   "skip upload of already stored objects for S3 CDN: 'on' (default), 'etag' to also compare MD5, or 'off'",
+				EnvVars: []string{"AWS_S3_SKIP_EXISTING"},
+			},
+			{
+				Key:     PartSize,
+				Usage:   "multipart upload part size in MiB for S3 CDN, 5 at least",
+				EnvVars: []string{"AWS_S3_PART_SIZE"},
+			},
+			{
+				Key:     Concurrency,
+				Usage:   "number of parts of a single file uploaded in parallel for S3 CDN",
+				EnvVars: []string{"AWS_S3_CONCURRENCY"},
+			},
+			{
+				Key:      URLModeKey,
+				Usage:    "way of building object URLs for S3 CDN: 'public' (default), 'presigned', 'path-style' or 'virtual-host'",
+				EnvVars:  []string{"AWS_S3_URL_MODE"},
+				Identity: true,
+			},
+			{
+				Key:     PresignExpiry,
+				Usage:   "lifetime of presigned URLs for S3 CDN, 168h at most",
+				EnvVars: []string{"AWS_S3_PRESIGN_EXPIRY"},
+			},
+			{
+				Key:     KeyTemplateKey,
+				Usage:   "template of object keys for S3 CDN, e.g. '{profile}/{title}/{index:03}{ext}'",
+				EnvVars: []string{"AWS_S3_KEY_TEMPLATE"},
+			},
+			{
+				Key:     PathStyle,
+				Usage:   "use path-style addressing (endpoint/bucket/key) for S3 CDN, required by most self-hosted services",
+				EnvVars: []string{"AWS_S3_PATH_STYLE"},
+			},
+			{
+				Key:     CABundle,
+				Usage:   "path to PEM file with custom CA certificates for S3 CDN",
+				EnvVars: []string{"AWS_S3_CA_BUNDLE"},
+			},
+			{
+				Key:     InsecureSkipVerify,
+				Usage:   "don't verify TLS certificate of S3 CDN endpoint. Use only in trusted networks",
+				EnvVars: []string{"AWS_S3_INSECURE_SKIP_VERIFY"},
+			},
+			{
+				Key:     ChecksumMode,
+				Usage:   "request checksums for S3 CDN: 'when-supported' (default) or 'when-required' for gateways rejecting CRC checksums",
+				EnvVars: []string{"AWS_S3_CHECKSUM"},
+			},
+		},
+		New: newCDN,
+	})
+}
+
+func newCDN(ctx context.Context, params registry.Params) (services.CDN, error) {
+	bucket := params.Get(Bucket)
+	location := params.Get(Location)
+	publicURL := params.Get(PublicURL)
+
+	urlMode := URLMode(collections.DefaultIfEmpty(params.Get(URLModeKey), string(URLModePublic)))
+
+	if bucket == "" || (urlMode == URLModePublic && publicURL == "") {
+		return nil, wherr.Error("s3: invalid configuration")
+	}
+
+	client, err := newClient(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	opts, err := objectOptions(params)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewMediaStorage(client, bucket, location, publicURL, opts...), nil
+}
+
+func newClient(ctx context.Context, params registry.Params) (*s3.Client, error) {
+	region := params.Get(Region)
+	endpoint := params.Get(Endpoint)
+
+	loadOpts := []func(*awsconfig.LoadOptions) error{
+		awsconfig.WithRegion(region),
+	}
+
+	keyID, secretKey := params.Get(KeyID), params.Get(SecretAccessKey)
+
+	switch {
+	case keyID != "" && secretKey != "":
+		loadOpts = append(loadOpts, awsconfig.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(keyID, secretKey, params.Get(SessionToken)),
+		))
+	case keyID != "" || secretKey != "":
+		return nil, wherr.Error("s3: both key id and secret access key must be set")
+	default:
+		// default chain: env, shared config and credentials files, SSO, web identity, instance role
+		if profile := params.Get(AWSProfile); profile != "" {
+			loadOpts = append(loadOpts, awsconfig.WithSharedConfigProfile(profile))
+		}
+	}
+
+	insecure, err := parseBool(params, InsecureSkipVerify)
+	if err != nil {
+		return nil, err
+	}
+
+	if insecure {
+		loadOpts = append(loadOpts, awsconfig.WithHTTPClient(
+			awshttp.NewBuildableClient().WithTransportOptions(func(tr *http.Transport) {
+				if tr.TLSClientConfig == nil {
+					tr.TLSClientConfig = &tls.Config{} // nolint: gosec
+				}
+
+				tr.TLSClientConfig.InsecureSkipVerify = true
+			}),
+		))
+	}
+
+	if path := params.Get(CABundle); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("s3: read ca bundle: %w", err)
+		}
+
+		loadOpts = append(loadOpts, awsconfig.WithCustomCABundle(bytes.NewReader(data)))
+	}
+
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, loadOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("can't load AWS config: %w", err)
+	}
+
+	pathStyle, err := parseBool(params, PathStyle)
+	if err != nil {
+		return nil, err
+	}
+
+	var whenRequired bool
+
+	switch v := params.Get(ChecksumMode); v {
+	case "", ChecksumWhenSupported:
+	case ChecksumWhenRequired:
+		whenRequired = true
+	default:
+		return nil, wherr.Errorf("%w: %q", "s3: unsupported checksum mode", v)
+	}
+
+	return s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+
+		o.UsePathStyle = pathStyle
+
+		// some S3 compatible gateways reject CRC checksums, which are sent by default
+		if whenRequired {
+			o.RequestChecksumCalculation = aws.RequestChecksumCalculationWhenRequired
+			o.ResponseChecksumValidation = aws.ResponseChecksumValidationWhenRequired
+		}
+	}), nil
+}
+
+func parseBool(params registry.Params, key string) (bool, error) {
+	v := params.Get(key)
+	if v == "" {
+		return false, nil
+	}
+
+	res, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, wherr.Errorf("%w: %s: %q", "s3: invalid boolean", key, v)
+	}
+
+	return res, nil
+}
+
+func objectOptions(params registry.Params) ([]Option, error) {
+	opts := []Option{WithProfile(params.Profile)}
+
+	if v := params.Get(CacheControl); v != "" {
+		opts = append(opts, WithCacheControl(v))
+	}
+
+	if v := types.ObjectCannedACL(params.Get(ACL)); v != "" {
+		if !slices.Contains(v.Values(), v) {
+			return nil, wherr.Errorf("%w: %q", "s3: unsupported acl", v)
+		}
+
+		opts = append(opts, WithACL(v))
+	}
+
+	if v := types.StorageClass(params.Get(StorageClass)); v != "" {
+		if !slices.Contains(v.Values(), v) {
+			return nil, wherr.Errorf("%w: %q", "s3: unsupported storage class", v)
+		}
+
+		opts = append(opts, WithStorageClass(v))
+	}
+
+	urlOpt, err := urlModeOption(params)
+	if err != nil {
+		return nil, err
+	}
+
+	opts = append(opts, urlOpt)
+
+	switch v := SkipExisting(params.Get(SkipExistingMode)); v {
+	case "":
+	case SkipExistingOn, SkipExistingOff, SkipExistingETag:
+		opts = append(opts, WithSkipExisting(v))
+	default:
+		return nil, wherr.Errorf("%w: %q", "s3: unsupported skip existing mode", v)
+	}
+
+	if v := params.Get(PartSize); v != "" {
+		size, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || size < minPartSizeMiB {
+			return nil, wherr.Errorf("%w: %q", "s3: invalid part size", v)
+		}
+
+		opts = append(opts, WithPartSize(size<<20)) // nolint: mnd
+	}
+
+	if v := params.Get(Concurrency); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, wherr.Errorf("%w: %q", "s3: invalid concurrency", v)
+		}
+
+		opts = append(opts, WithConcurrency(n))
+	}
+
+	if v := params.Get(KeyTemplateKey); v != "" {
+		tmpl, err := ParseKeyTemplate(v)
+		if err != nil {
+			return nil, fmt.Errorf("s3: %w", err)
+		}
+
+		opts = append(opts, WithKeyTemplate(tmpl))
+	}
+
+	if v := params.Get(Metadata); v != "" {
+		meta, err := parseMetadata(v)
+		if err != nil {
+			return nil, err
+		}
+
+		opts = append(opts, WithMetadata(meta))
+	}
+
+	return opts, nil
+}
+
+func urlModeOption(params registry.Params) (Option, error) {
+	mode := URLMode(collections.DefaultIfEmpty(params.Get(URLModeKey), string(URLModePublic)))
+
+	switch mode {
+	case URLModePublic, URLModePresigned, URLModePathStyle, URLModeVirtualHost:
+	default:
+		return nil, wherr.Errorf("%w: %q", "s3: unsupported url mode", mode)
+	}
+
+	var expiry time.Duration
+
+	if v := params.Get(PresignExpiry); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 || d > defaultPresignExpiry {
+			return nil, wherr.Errorf("%w: %q", "s3: invalid presign expiry", v)
+		}
+
+		expiry = d
+	}
+
+	return WithURLMode(mode, expiry), nil
+}
+
+// parseMetadata parses "key=value,key2=value2" list.
+func parseMetadata(s string) (map[string]string, error) {
+	meta := make(map[string]string)
+
+	for _, pair := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+
+		if !ok || key == "" {
+			return nil, wherr.Errorf("%w: %q", "s3: invalid metadata", pair)
+		}
+
+		meta[key] = strings.TrimSpace(value)
+	}
+
+	return meta, nil
+}
@@ -0,0 +1,335 @@
+package s3_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+
+	"github.com/bohdanch-w/go-tgupload/cmd/cdnflags"
+	"github.com/bohdanch-w/go-tgupload/entities"
+	"github.com/bohdanch-w/go-tgupload/registry"
+	"github.com/bohdanch-w/go-tgupload/services"
+	"github.com/bohdanch-w/go-tgupload/storage/s3"
+	"github.com/bohdanch-w/go-tgupload/usecases"
+)
+
+func newFakeS3(t *testing.T) (*s3mem.Backend, *httptest.Server) {
+	t.Helper()
+
+	backend := s3mem.New()
+	require.NoError(t, backend.CreateBucket("bucket"))
+
+	srv := httptest.NewTLSServer(gofakes3.New(backend).Server())
+	t.Cleanup(srv.Close)
+
+	return backend, srv
+}
+
+func newBackendCDN(t *testing.T, values map[string]string) (services.CDN, error) {
+	t.Helper()
+
+	backend, _, ok := registry.Lookup("s3")
+	require.True(t, ok)
+
+	defaults := map[string]string{
+		s3.KeyID:           "key",
+		s3.SecretAccessKey: "secret",
+		s3.Region:          "us-east-1",
+		s3.Bucket:          "bucket",
+		s3.Location:        "gallery",
+		s3.PathStyle:       "true",
+		s3.URLModeKey:      string(s3.URLModePathStyle),
+		// gofakes3 stores streaming checksum trailers as object content
+		s3.ChecksumMode: s3.ChecksumWhenRequired,
+	}
+
+	for k, v := range values {
+		defaults[k] = v
+	}
+
+	return backend.New(context.Background(), registry.Params{
+		Get: func(key string) string { return defaults[key] },
+	})
+}
+
+func TestBackendTLS(t *testing.T) {
+	_, srv := newFakeS3(t)
+
+	caBundle := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(caBundle, pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: srv.Certificate().Raw,
+	}), 0o600))
+
+	tests := []struct {
+		name   string
+		values map[string]string
+		fails  bool
+	}{
+		{name: "untrusted", values: map[string]string{}, fails: true},
+		{name: "ca bundle", values: map[string]string{s3.CABundle: caBundle}},
+		{name: "insecure", values: map[string]string{s3.InsecureSkipVerify: "true"}},
+		{name: "checksum when supported", values: map[string]string{
+			s3.InsecureSkipVerify: "true",
+			s3.ChecksumMode:       s3.ChecksumWhenSupported,
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.values[s3.Endpoint] = srv.URL
+
+			cdn, err := newBackendCDN(t, tt.values)
+			require.NoError(t, err)
+
+			res, err := cdn.Upload(context.Background(), entities.MediaFile{Name: "01.png", Data: []byte("image")})
+			if tt.fails {
+				require.Error(t, err)
+
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, srv.URL+"/bucket/"+res.DeleteHandle, res.URL)
+		})
+	}
+}
+
+func TestBackendUpload(t *testing.T) {
+	fake, srv := newFakeS3(t)
+
+	cdn, err := newBackendCDN(t, map[string]string{
+		s3.Endpoint:           srv.URL,
+		s3.InsecureSkipVerify: "true",
+		s3.KeyTemplateKey:     "{title}/{index}{ext}",
+		s3.Metadata:           "owner=test",
+	})
+	require.NoError(t, err)
+
+	album, ok := cdn.(services.AlbumCDN)
+	require.True(t, ok)
+	require.NoError(t, album.CreateAlbum(context.Background(), "My Album"))
+
+	first, err := cdn.Upload(context.Background(), entities.MediaFile{Name: "a.png", Index: 1, Data: []byte("first")})
+	require.NoError(t, err)
+	require.Equal(t, "gallery/my-album/1.png", first.DeleteHandle)
+
+	obj, err := fake.HeadObject("bucket", first.DeleteHandle)
+	require.NoError(t, err)
+	require.Equal(t, "test", obj.Metadata["X-Amz-Meta-Owner"])
+
+	// same key with other content gets hash suffix instead of overwriting
+	second, err := cdn.Upload(context.Background(), entities.MediaFile{Name: "b.png", Index: 1, Data: []byte("second")})
+	require.NoError(t, err)
+	require.NotEqual(t, first.DeleteHandle, second.DeleteHandle)
+	require.Regexp(t, `^gallery/my-album/1-[0-9a-f]{8}\.png$`, second.DeleteHandle)
+}
+
+func TestBackendMultipart(t *testing.T) {
+	fake, srv := newFakeS3(t)
+
+	cdn, err := newBackendCDN(t, map[string]string{
+		s3.Endpoint:           srv.URL,
+		s3.InsecureSkipVerify: "true",
+		s3.PartSize:           "5",
+	})
+	require.NoError(t, err)
+
+	data := bytes.Repeat([]byte("0123456789abcdef"), 11<<20/16)
+
+	res, err := cdn.Upload(context.Background(), entities.MediaFile{Name: "large.bin", Data: data})
+	require.NoError(t, err)
+
+	obj, err := fake.GetObject("bucket", res.DeleteHandle, nil)
+	require.NoError(t, err)
+	require.EqualValues(t, len(data), obj.Size)
+	require.NoError(t, obj.Contents.Close())
+}
+
+func TestBackendMultipartFromDisk(t *testing.T) {
+	fake := s3mem.New()
+	require.NoError(t, fake.CreateBucket("bucket"))
+
+	var parts atomic.Int64
+
+	handler := gofakes3.New(fake).Server()
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut && r.URL.Query().Has("partNumber") {
+			parts.Add(1)
+		}
+
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	cdn, err := newBackendCDN(t, map[string]string{
+		s3.Endpoint:           srv.URL,
+		s3.InsecureSkipVerify: "true",
+		s3.PartSize:           "5",
+	})
+	require.NoError(t, err)
+
+	data := bytes.Repeat([]byte("0123456789abcdef"), 11<<20/16)
+	path := filepath.Join(t.TempDir(), "large.bin")
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+
+	media, err := usecases.LoadMedia(path)
+	require.NoError(t, err)
+	require.Nil(t, media.Data, "content must be streamed from disk")
+
+	res, err := cdn.Upload(context.Background(), media)
+	require.NoError(t, err)
+
+	obj, err := fake.GetObject("bucket", res.DeleteHandle, nil)
+	require.NoError(t, err)
+
+	defer obj.Contents.Close()
+
+	require.EqualValues(t, 3, parts.Load(), "object must be uploaded in parts")
+
+	stored, err := io.ReadAll(obj.Contents)
+	require.NoError(t, err)
+	require.Equal(t, data, stored)
+}
+
+func TestBackendInvalidOptions(t *testing.T) {
+	_, err := newBackendCDN(t, map[string]string{s3.PathStyle: "maybe"})
+	require.Error(t, err)
+
+	_, err = newBackendCDN(t, map[string]string{s3.ChecksumMode: "always"})
+	require.Error(t, err)
+
+	_, err = newBackendCDN(t, map[string]string{s3.CABundle: filepath.Join(t.TempDir(), "missing.pem")})
+	require.Error(t, err)
+
+	_, err = newBackendCDN(t, map[string]string{s3.KeyTemplateKey: "{title} #1/{name}{ext}"})
+	require.ErrorContains(t, err, `unsafe characters in key template, only latin letters, digits, '-', '_', '.' and '/' are allowed outside of placeholders: " #1/"`)
+}
+
+func TestBackendCredentialChain(t *testing.T) {
+	_, srv := newFakeS3(t)
+
+	dir := t.TempDir()
+	credsFile := filepath.Join(dir, "credentials")
+	require.NoError(t, os.WriteFile(credsFile, []byte("[build]\naws_access_key_id = key\naws_secret_access_key = secret\n"), 0o600))
+
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", credsFile)
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	t.Setenv("AWS_PROFILE", "")
+
+	tests := []struct {
+		name   string
+		values map[string]string
+		fails  bool
+	}{
+		{name: "shared profile", values: map[string]string{s3.AWSProfile: "build"}},
+		{name: "missing profile", values: map[string]string{s3.AWSProfile: "other"}, fails: true},
+		{name: "incomplete static keys", values: map[string]string{s3.KeyID: "key", s3.SecretAccessKey: ""}, fails: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := map[string]string{
+				s3.KeyID:              "",
+				s3.SecretAccessKey:    "",
+				s3.Endpoint:           srv.URL,
+				s3.InsecureSkipVerify: "true",
+			}
+
+			for k, v := range tt.values {
+				values[k] = v
+			}
+
+			cdn, err := newBackendCDN(t, values)
+			if tt.fails {
+				require.Error(t, err)
+
+				return
+			}
+
+			require.NoError(t, err)
+
+			_, err = cdn.Upload(context.Background(), entities.MediaFile{Name: "01.png", Data: []byte("image")})
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestBackendSDKEnvCredentials(t *testing.T) {
+	_, srv := newFakeS3(t)
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_KEY_ID", "")
+	require.NoError(t, os.Unsetenv("AWS_KEY_ID"))
+
+	var values map[string]string
+
+	app := &cli.App{
+		Flags: cdnflags.Flags(),
+		Action: func(ctx *cli.Context) error {
+			values = cdnflags.Values(ctx)
+
+			return nil
+		},
+	}
+	require.NoError(t, app.Run([]string{"gotg"}))
+	require.Equal(t, "key", values[s3.KeyID], "key id is read from standard AWS variable")
+
+	values[s3.Endpoint] = srv.URL
+	values[s3.InsecureSkipVerify] = "true"
+
+	cdn, err := newBackendCDN(t, values)
+	require.NoError(t, err)
+
+	_, err = cdn.Upload(context.Background(), entities.MediaFile{Name: "01.png", Data: []byte("image")})
+	require.NoError(t, err)
+}
+
+func TestBackendList(t *testing.T) {
+	_, srv := newFakeS3(t)
+
+	cdn, err := newBackendCDN(t, map[string]string{
+		s3.Endpoint:           srv.URL,
+		s3.InsecureSkipVerify: "true",
+	})
+	require.NoError(t, err)
+
+	uploaded, err := cdn.Upload(context.Background(), entities.MediaFile{Name: "01.png", Data: []byte("image")})
+	require.NoError(t, err)
+
+	other, err := newBackendCDN(t, map[string]string{
+		s3.Endpoint:           srv.URL,
+		s3.InsecureSkipVerify: "true",
+		s3.Location:           "other",
+	})
+	require.NoError(t, err)
+
+	_, err = other.Upload(context.Background(), entities.MediaFile{Name: "02.png", Data: []byte("other")})
+	require.NoError(t, err)
+
+	lister, ok := cdn.(services.CDNLister)
+	require.True(t, ok)
+
+	objects, err := lister.List(context.Background())
+	require.NoError(t, err)
+	require.Len(t, objects, 1)
+	require.Equal(t, uploaded.DeleteHandle, objects[0].Handle)
+	require.Equal(t, uploaded.URL, objects[0].URL)
+	require.EqualValues(t, len("image"), objects[0].Size)
+	require.False(t, objects[0].ModifiedAt.IsZero())
+}
@@ -0,0 +1,234 @@
+package s3
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/bohdanch-w/go-tgupload/pkg/utils"
+
+	"github.com/bohdanch-w/wheel/collections"
+	wherr "github.com/bohdanch-w/wheel/errors"
+)
+
+// DefaultKeyTemplate names objects by content hash.
+const DefaultKeyTemplate = "{hash}{ext}"
+
+const (
+	hashLen      = 32
+	shortHashLen = 8
+	dateLayout   = "2006-01-02"
+	emptySlug    = "untitled"
+)
+
+// KeyContext holds values of key template placeholders.
+type KeyContext struct {
+	Profile string
+	Title   string
+	// Path is the local path of uploaded file.
+	Path  string
+	Name  string
+	Index int
+	// Hash is hex encoded content hash.
+	Hash string
+	Time time.Time
+}
+
+// KeyTemplate renders object keys, which are URL-safe. Text outside of placeholders may contain
+// latin letters, digits, dash, underscore, dot and slash only. Supported placeholders:
+//
+//	{profile} {title} {dir} {name}  - slugs of config profile, album title, parent directory and file name
+//	{index} {index:03}              - position of the file in upload, optionally zero padded
+//	{ext}                           - file extension with dot, lowercase except in default template
+//	{hash} {hash8}                  - 32 or 8 first characters of content hash
+//	{date} {date:2006/01}           - upload date, optionally in Go time layout
+type KeyTemplate struct {
+	parts  []keyPart
+	unique bool
+	// rawExt keeps extension as is, so that default keys match ones of older versions.
+	rawExt bool
+}
+
+type keyPart struct {
+	literal string
+	name    string
+	arg     string
+}
+
+func ParseKeyTemplate(tmpl string) (*KeyTemplate, error) {
+	var (
+		kt   = &KeyTemplate{rawExt: tmpl == DefaultKeyTemplate}
+		rest = tmpl
+	)
+
+	for rest != "" {
+		start := strings.IndexByte(rest, '{')
+		if start < 0 {
+			start = len(rest)
+		}
+
+		if literal := rest[:start]; strings.IndexFunc(literal, unsafeLiteralRune) >= 0 {
+			return nil, wherr.Errorf("%w: %q", "unsafe characters in key template, only latin letters, digits, "+
+				"'-', '_', '.' and '/' are allowed outside of placeholders", literal)
+		}
+
+		if start == len(rest) {
+			kt.parts = append(kt.parts, keyPart{literal: rest})
+
+			break
+		}
+
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			return nil, wherr.Errorf("%w: %q", "unclosed placeholder in key template", tmpl)
+		}
+
+		if start > 0 {
+			kt.parts = append(kt.parts, keyPart{literal: rest[:start]})
+		}
+
+		name, arg, _ := strings.Cut(rest[start+1:start+end], ":")
+
+		if err := validatePlaceholder(name, arg); err != nil {
+			return nil, err
+		}
+
+		kt.unique = kt.unique || (name == "hash")
+		kt.parts = append(kt.parts, keyPart{name: name, arg: arg})
+		rest = rest[start+end+1:]
+	}
+
+	if len(kt.parts) == 0 {
+		return nil, wherr.Error("empty key template")
+	}
+
+	return kt, nil
+}
+
+func validatePlaceholder(name, arg string) error {
+	switch name {
+	case "profile", "title", "dir", "name", "ext", "hash", "hash8":
+		if arg != "" {
+			return wherr.Errorf("%w: {%s:%s}", "placeholder has no arguments", name, arg)
+		}
+	case "index":
+		if _, err := strconv.Atoi(collections.DefaultIfEmpty(arg, "0")); err != nil {
+			return wherr.Errorf("%w: {%s:%s}", "invalid index width", name, arg)
+		}
+	case "date":
+	default:
+		return wherr.Errorf("%w: {%s}", "unknown placeholder", name)
+	}
+
+	return nil
+}
+
+// Unique reports whether rendered keys are unique for different content.
+func (kt *KeyTemplate) Unique() bool {
+	return kt.unique
+}
+
+// Render builds object key. Rendered values never contain slashes, except date layout.
+func (kt *KeyTemplate) Render(kc KeyContext) string {
+	var sb strings.Builder
+
+	for _, p := range kt.parts {
+		switch {
+		case p.name == "":
+			sb.WriteString(p.literal)
+		case p.name == "ext" && kt.rawExt:
+			sb.WriteString(filepath.Ext(kc.Name))
+		default:
+			sb.WriteString(kc.value(p.name, p.arg))
+		}
+	}
+
+	// drop empty and relative segments, which come from template literals
+	segments := strings.Split(sb.String(), "/")
+	res := segments[:0]
+
+	for _, s := range segments {
+		if s != "" && s != "." && s != ".." {
+			res = append(res, s)
+		}
+	}
+
+	return strings.Join(res, "/")
+}
+
+func (kc KeyContext) value(name, arg string) string {
+	ext := filepath.Ext(kc.Name)
+
+	switch name {
+	case "profile":
+		return slug(kc.Profile)
+	case "title":
+		return slug(kc.Title)
+	case "dir":
+		return slug(filepath.Base(filepath.Dir(kc.Path)))
+	case "name":
+		return slug(strings.TrimSuffix(kc.Name, ext))
+	case "ext":
+		if ext := utils.Slug(ext); ext != "" {
+			return "." + ext
+		}
+
+		return ""
+	case "index":
+		width, _ := strconv.Atoi(collections.DefaultIfEmpty(arg, "0"))
+
+		return fmt.Sprintf("%0*d", width, kc.Index)
+	case "hash":
+		return kc.Hash[:min(hashLen, len(kc.Hash))]
+	case "hash8":
+		return kc.Hash[:min(shortHashLen, len(kc.Hash))]
+	case "date":
+		segments := strings.Split(kc.Time.Format(collections.DefaultIfEmpty(arg, dateLayout)), "/")
+		for i, s := range segments {
+			segments[i] = safeSegment(s)
+		}
+
+		return strings.Join(segments, "/")
+	}
+
+	return ""
+}
+
+// safeSegment replaces characters other than latin letters, digits, dash, underscore and dot
+// with dash. Relative segments are dropped.
+func safeSegment(s string) string {
+	res := strings.Map(func(r rune) rune {
+		if isSafeKeyRune(r) {
+			return r
+		}
+
+		return '-'
+	}, s)
+
+	if res == "." || res == ".." {
+		return ""
+	}
+
+	return res
+}
+
+// unsafeLiteralRune reports whether the character can't be used in key template outside of placeholders.
+func unsafeLiteralRune(r rune) bool {
+	return !isSafeKeyRune(r) && r != '/'
+}
+
+// isSafeKeyRune reports whether the character may be used in key segment without URL escaping.
+func isSafeKeyRune(r rune) bool {
+	return r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) || r == '-' || r == '_' || r == '.'
+}
+
+func slug(s string) string {
+	if res := utils.Slug(s); res != "" {
+		return res
+	}
+
+	return emptySlug
+}
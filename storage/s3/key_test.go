@@ -0,0 +1,58 @@
+package s3_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bohdanch-w/go-tgupload/storage/s3"
+)
+
+func TestKeyTemplateRender(t *testing.T) {
+	kc := s3.KeyContext{
+		Profile: "default",
+		Title:   "Моя галерея: Part 1",
+		Path:    "/home/user/My Pictures/IMG 01.PNG",
+		Name:    "IMG 01.PNG",
+		Index:   7,
+		Hash:    "0123456789abcdef0123456789abcdef0123456789abcdef",
+		Time:    time.Date(2025, 11, 10, 12, 0, 0, 0, time.UTC),
+	}
+
+	tests := map[string]string{
+		s3.DefaultKeyTemplate:                      "0123456789abcdef0123456789abcdef.PNG",
+		"{hash}{ext}/":                             "0123456789abcdef0123456789abcdef.png",
+		"{profile}/{title}/{index:03}{ext}":        "default/moia-halereia-part-1/007.png",
+		"{date:2006/01}/{dir}/{name}-{hash8}{ext}": "2025/11/my-pictures/img-01-01234567.png",
+		"{date}/{index}":                           "2025-11-10/7",
+		"{date:Jan 2006/../02}/{index}":            "Nov-2025/10/7",
+		"{date:2006/.}/{index}":                    "2025/7",
+		"/{title}//../{name}":                      "moia-halereia-part-1/img-01",
+	}
+
+	for tmpl, expected := range tests {
+		kt, err := s3.ParseKeyTemplate(tmpl)
+		require.NoError(t, err, tmpl)
+		require.Equal(t, expected, kt.Render(kc), tmpl)
+	}
+
+	kc.Title = ""
+
+	kt, err := s3.ParseKeyTemplate("{title}/{name}{ext}")
+	require.NoError(t, err)
+	require.Equal(t, "untitled/img-01.png", kt.Render(kc))
+	require.False(t, kt.Unique())
+}
+
+func TestKeyTemplateInvalid(t *testing.T) {
+	for _, tmpl := range []string{"", "{unknown}", "{index:x}", "{name", "{hash:8}"} {
+		_, err := s3.ParseKeyTemplate(tmpl)
+		require.Error(t, err, tmpl)
+	}
+
+	for _, tmpl := range []string{"{title} #1/{name}{ext}", "{name}?v=1{ext}", "галерея/{hash}{ext}", "{hash}%20{ext}"} {
+		_, err := s3.ParseKeyTemplate(tmpl)
+		require.ErrorContains(t, err, "unsafe characters in key template", tmpl)
+	}
+}
@@ -1,106 +1,684 @@
 package s3
 
 import (
-	"bytes"
 	"context"
+	"crypto/md5" // nolint: gosec
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
-	"os"
+	"maps"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 
 	"github.com/bohdanch-w/go-tgupload/entities"
+	"github.com/bohdanch-w/go-tgupload/pkg/utils"
 	"github.com/bohdanch-w/go-tgupload/services"
 
 	"github.com/bohdanch-w/wheel/collections"
 	wherr "github.com/bohdanch-w/wheel/errors"
 )
 
-var _ services.CDN = (*MediaStorage)(nil)
+// Metadata keys set on every uploaded object.
+const (
+	MetaSourceName = "source-name"
+	MetaAlbum      = "album"
+	MetaProfile    = "profile"
+	MetaSHA256     = "sha256"
+)
+
+const ErrKeyCollision = entities.Error("s3 storage: object key is taken by other content")
+
+var (
+	_ services.CDN          = (*MediaStorage)(nil)
+	_ services.CDNDeleter   = (*MediaStorage)(nil)
+	_ services.AlbumCDN     = (*MediaStorage)(nil)
+	_ services.CDNRefresher = (*MediaStorage)(nil)
+	_ services.CDNLister    = (*MediaStorage)(nil)
+)
+
+type SkipExisting string
+
+const (
+	// SkipExistingOff always uploads objects.
+	SkipExistingOff SkipExisting = "off"
+	// SkipExistingOn skips upload if object with the same key exists.
+	SkipExistingOn SkipExisting = "on"
+	// SkipExistingETag additionally requires object ETag to match content MD5.
+	SkipExistingETag SkipExisting = "etag"
+)
+
+const abortTimeout = 30 * time.Second
+
+type URLMode string
+
+const (
+	// URLModePublic builds URL from public URL prefix and object key.
+	URLModePublic URLMode = "public"
+	// URLModePresigned returns GET URL signed for limited time, for private buckets.
+	URLModePresigned URLMode = "presigned"
+	// URLModePathStyle builds URL as endpoint/bucket/key.
+	URLModePathStyle URLMode = "path-style"
+	// URLModeVirtualHost builds URL as bucket.endpoint/key.
+	URLModeVirtualHost URLMode = "virtual-host"
+)
+
+// defaultPresignExpiry is the maximum allowed by SigV4.
+const defaultPresignExpiry = 7 * 24 * time.Hour
+
+type Option func(*MediaStorage)
+
+// WithPartSize sets size of multipart upload parts in bytes. Smaller files are uploaded in single request.
+func WithPartSize(size int64) Option {
+	return func(ms *MediaStorage) {
+		ms.partSize = size
+	}
+}
+
+// WithConcurrency sets number of parts of single file uploaded in parallel.
+func WithConcurrency(n int) Option {
+	return func(ms *MediaStorage) {
+		ms.concurrency = n
+	}
+}
+
+// WithSkipExisting sets check of already uploaded objects, SkipExistingOn by default.
+func WithSkipExisting(mode SkipExisting) Option {
+	return func(ms *MediaStorage) {
+		ms.skipExisting = mode
+	}
+}
+
+// WithCacheControl sets Cache-Control header of uploaded objects.
+func WithCacheControl(cacheControl string) Option {
+	return func(ms *MediaStorage) {
+		ms.cacheControl = cacheControl
+	}
+}
+
+// WithACL sets canned ACL of uploaded objects, e.g. public-read.
+func WithACL(acl types.ObjectCannedACL) Option {
+	return func(ms *MediaStorage) {
+		ms.acl = acl
+	}
+}
+
+// WithStorageClass sets storage class of uploaded objects.
+func WithStorageClass(class types.StorageClass) Option {
+	return func(ms *MediaStorage) {
+		ms.storageClass = class
+	}
+}
+
+// WithMetadata adds custom metadata to uploaded objects.
+func WithMetadata(meta map[string]string) Option {
+	return func(ms *MediaStorage) {
+		maps.Copy(ms.metadata, meta)
+	}
+}
 
-func NewMediaStorage(client *s3.Client, bucket, root, publicURL string) *MediaStorage {
-	return &MediaStorage{
+// WithURLMode sets the way of building object URLs. Expiry is used for presigned mode only.
+func WithURLMode(mode URLMode, expiry time.Duration) Option {
+	return func(ms *MediaStorage) {
+		ms.urlMode = mode
+		ms.presignExpiry = collections.DefaultIfEmpty(expiry, defaultPresignExpiry)
+	}
+}
+
+// WithKeyTemplate sets template of object keys, DefaultKeyTemplate by default.
+func WithKeyTemplate(tmpl *KeyTemplate) Option {
+	return func(ms *MediaStorage) {
+		ms.keyTemplate = tmpl
+	}
+}
+
+// WithProfile adds config profile name to uploaded objects metadata.
+func WithProfile(profile string) Option {
+	return func(ms *MediaStorage) {
+		ms.profile = profile
+	}
+}
+
+func NewMediaStorage(client *s3.Client, bucket, root, publicURL string, opts ...Option) *MediaStorage {
+	ms := &MediaStorage{
 		client:    client,
 		bucket:    bucket,
 		root:      collections.DefaultIfEmpty(strings.Trim(root, `/\`), "/"),
 		publicURL: strings.Trim(publicURL, `/\`),
+		metadata:  make(map[string]string),
+
+		skipExisting: SkipExistingOn,
+		urlMode:      URLModePublic,
+		claimed:      make(map[string]*claim),
+	}
+
+	for _, opt := range opts {
+		opt(ms)
+	}
+
+	if ms.keyTemplate == nil {
+		ms.keyTemplate, _ = ParseKeyTemplate(DefaultKeyTemplate)
 	}
+
+	ms.uploader = manager.NewUploader(client, func(u *manager.Uploader) {
+		u.PartSize = collections.DefaultIfEmpty(ms.partSize, manager.DefaultUploadPartSize)
+		u.Concurrency = collections.DefaultIfEmpty(ms.concurrency, manager.DefaultUploadConcurrency)
+		// parts are aborted by storage itself, so that it works for cancelled context too
+		u.LeavePartsOnError = true
+		// uploader doesn't inherit checksum settings of the client
+		if mode := client.Options().RequestChecksumCalculation; mode != 0 {
+			u.RequestChecksumCalculation = mode
+		}
+	})
+
+	return ms
 }
 
 type MediaStorage struct {
 	client    *s3.Client
+	uploader  *manager.Uploader
 	bucket    string
 	root      string
 	publicURL string
+
+	cacheControl string
+	acl          types.ObjectCannedACL
+	storageClass types.StorageClass
+	metadata     map[string]string
+	profile      string
+	skipExisting SkipExisting
+	partSize     int64
+	concurrency  int
+
+	urlMode       URLMode
+	presignExpiry time.Duration
+
+	keyTemplate *KeyTemplate
+
+	mux     sync.RWMutex
+	album   string
+	claimed map[string]*claim
+}
+
+// claim tracks upload of the key during this run.
+type claim struct {
+	key  string
+	hash string
+	// done is closed once upload completes, stored is set before that.
+	done   chan struct{}
+	stored bool
+}
+
+// CreateAlbum records album title in metadata of following uploads.
+func (ms *MediaStorage) CreateAlbum(_ context.Context, title string) error {
+	ms.mux.Lock()
+	defer ms.mux.Unlock()
+
+	ms.album = title
+
+	return nil
 }
 
+// Store puts object with the key under storage root. Content type is detected by key extension.
 func (ms *MediaStorage) Store(ctx context.Context, key string, data io.Reader) error {
+	return ms.store(ctx, key, data, mime.TypeByExtension(filepath.Ext(key)), ms.metadata)
+}
+
+func (ms *MediaStorage) store(
+	ctx context.Context,
+	key string,
+	data io.Reader,
+	contentType string,
+	meta map[string]string,
+) error {
 	s3Obj := &s3.PutObjectInput{
-		Bucket: aws.String(ms.bucket),
-		Key:    aws.String(filepath.ToSlash(filepath.Join(ms.root, key))),
-		Body:   data,
+		Bucket:       aws.String(ms.bucket),
+		Key:          aws.String(filepath.ToSlash(filepath.Join(ms.root, key))),
+		Body:         data,
+		ACL:          ms.acl,
+		StorageClass: ms.storageClass,
+		Metadata:     meta,
+	}
+
+	if contentType != "" {
+		s3Obj.ContentType = aws.String(contentType)
+	}
+
+	if ms.cacheControl != "" {
+		s3Obj.CacheControl = aws.String(ms.cacheControl)
+	}
+
+	out, err := ms.uploader.Upload(ctx, s3Obj)
+	if err != nil {
+		var multiErr manager.MultiUploadFailure
+		if errors.As(err, &multiErr) {
+			ms.abortUpload(ctx, aws.ToString(s3Obj.Key), multiErr.UploadID())
+		}
+
+		return fmt.Errorf("s3 storage: put object: %w", err)
+	}
+
+	if out == nil || out.ETag == nil {
+		return wherr.Error("s3 storage: put object: no meta")
+	}
+
+	return nil
+}
+
+// Upload stores media under the key rendered from template. Media without loaded data is streamed from disk.
+// If the key is taken by different content, short content hash is appended to it.
+func (ms *MediaStorage) Upload(ctx context.Context, media entities.MediaFile) (_ entities.MediaFile, err error) {
+	body, err := media.Open()
+	if err != nil {
+		return media, err // nolint: wrapcheck
+	}
+	defer body.Close()
+
+	sum, size, err := hashContent(body, sha256.New())
+	if err != nil {
+		return media, fmt.Errorf("generate file hash: %w", err)
 	}
 
-	_, ok := data.(io.Seeker)
-	if !ok {
-		f, err := os.CreateTemp("", "")
+	var (
+		hash  = hex.EncodeToString(sum)
+		key   = ms.objectKey(media, hash)
+		state objectState
+		owned *claim
+	)
+
+	defer func() { ms.finish(owned, err == nil) }()
+
+	for attempt := 0; ; attempt++ {
+		state, owned, err = ms.check(ctx, ms.fullKey(key), hash, body, size)
 		if err != nil {
-			return fmt.Errorf("create temp file: %w", err)
+			return media, fmt.Errorf("check existing file: %w", err)
 		}
 
-		if _, err := io.Copy(f, data); err != nil {
-			f.Close()
+		if state != objectConflict {
+			break
+		}
 
-			return fmt.Errorf("copy data: %w", err)
+		if attempt > 0 {
+			return media, fmt.Errorf("%w: %s", ErrKeyCollision, key)
 		}
 
-		f.Close()
+		key = withSuffix(key, hash[:shortHashLen])
+	}
+
+	if state != objectSame || ms.skipExisting == SkipExistingOff {
+		head := make([]byte, utils.SniffLen)
+
+		n, err := io.ReadFull(body, head)
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+			return media, fmt.Errorf("read file: %w", err)
+		}
+
+		if _, err := body.Seek(0, io.SeekStart); err != nil {
+			return media, fmt.Errorf("rewind file: %w", err)
+		}
+
+		contentType := utils.ContentType(media.Name, head[:n])
+
+		if err := ms.store(ctx, key, body, contentType, ms.objectMetadata(media, hash)); err != nil {
+			return media, fmt.Errorf("store file: %w", err)
+		}
+	}
+
+	media.DeleteHandle = ms.fullKey(key)
+
+	return ms.Refresh(ctx, media)
+}
+
+func (ms *MediaStorage) objectKey(media entities.MediaFile, hash string) string {
+	ms.mux.RLock()
+	album := ms.album
+	ms.mux.RUnlock()
+
+	return ms.keyTemplate.Render(KeyContext{
+		Profile: ms.profile,
+		Title:   album,
+		Path:    media.Path,
+		Name:    media.Name,
+		Index:   media.Index,
+		Hash:    hash,
+		Time:    time.Now().UTC(),
+	})
+}
+
+func (ms *MediaStorage) fullKey(key string) string {
+	return filepath.ToSlash(filepath.Join(ms.root, key))
+}
+
+// withSuffix inserts suffix before extension of the key.
+func withSuffix(key, suffix string) string {
+	ext := path.Ext(key)
+
+	return strings.TrimSuffix(key, ext) + "-" + suffix + ext
+}
+
+// Refresh builds object URL for configured mode. For presigned mode it signs new link.
+func (ms *MediaStorage) Refresh(ctx context.Context, media entities.MediaFile) (entities.MediaFile, error) {
+	key := media.DeleteHandle
+	if key == "" {
+		return media, wherr.Error("s3 storage: no object key")
+	}
+
+	media.ExpiresAt = time.Time{}
 
-		f, err = os.Open(f.Name())
+	switch ms.urlMode {
+	case URLModePresigned:
+		req, err := s3.NewPresignClient(ms.client).PresignGetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(ms.bucket),
+			Key:    aws.String(key),
+		}, s3.WithPresignExpires(ms.presignExpiry))
 		if err != nil {
-			return fmt.Errorf("open temp file: %w", err)
+			return media, fmt.Errorf("s3 storage: presign url: %w", err)
 		}
 
-		defer f.Close()
+		media.URL = req.URL
+		media.ExpiresAt = time.Now().Add(ms.presignExpiry).UTC()
+	default:
+		u, err := ms.objectURL(key)
+		if err != nil {
+			return media, err
+		}
 
-		s3Obj.Body = f
+		media.URL = u
+	}
 
-		defer os.Remove(f.Name())
+	return media, nil
+}
+
+// objectURL builds not signed object URL.
+func (ms *MediaStorage) objectURL(key string) (string, error) {
+	if ms.urlMode == URLModePublic {
+		return ms.publicURL + "/" + strings.TrimPrefix(key, "/"), nil
 	}
 
-	out, err := ms.client.PutObject(ctx, s3Obj)
+	return ms.endpointURL(key)
+}
+
+// endpointURL builds object URL from the client endpoint, defaulting to AWS one for the region.
+func (ms *MediaStorage) endpointURL(key string) (string, error) {
+	opts := ms.client.Options()
+
+	endpoint := aws.ToString(opts.BaseEndpoint)
+	if endpoint == "" {
+		endpoint = "https://s3." + opts.Region + ".amazonaws.com"
+	}
+
+	u, err := url.Parse(endpoint)
 	if err != nil {
-		return fmt.Errorf("s3 storage: put object: %w", err)
+		return "", fmt.Errorf("s3 storage: parse endpoint: %w", err)
 	}
 
-	if out == nil || out.ETag == nil {
-		return wherr.Error("s3 storage: put object: no meta")
+	u.RawQuery = ""
+
+	if ms.urlMode == URLModeVirtualHost {
+		u.Host = ms.bucket + "." + u.Host
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + key
+	} else {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + ms.bucket + "/" + key
 	}
 
-	return nil
+	return u.String(), nil
+}
+
+// abortUpload removes parts of failed multipart upload. It is done even if context is cancelled.
+func (ms *MediaStorage) abortUpload(ctx context.Context, key, uploadID string) {
+	if uploadID == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), abortTimeout)
+	defer cancel()
+
+	_, _ = ms.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(ms.bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	})
+}
+
+// hashContent returns hash and size of the content, rewinding it back to start.
+func hashContent(r io.ReadSeeker, h hash.Hash) ([]byte, int64, error) {
+	size, err := io.Copy(h, r)
+	if err != nil {
+		return nil, 0, fmt.Errorf("read content: %w", err)
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, 0, fmt.Errorf("rewind content: %w", err)
+	}
+
+	return h.Sum(nil), size, nil
+}
+
+type objectState int
+
+const (
+	objectMissing objectState = iota
+	objectSame
+	objectConflict
+)
+
+// check reports whether key is free, holds the same content or is taken by other content.
+// Objects uploaded during this run are tracked locally, so that concurrent uploads don't collide.
+// Key is claimed, unless it is taken by other content, and the claim must be finished by caller.
+// Upload of the same content waits for the claim, so that object is reported only once stored.
+func (ms *MediaStorage) check(
+	ctx context.Context,
+	key, hash string,
+	body io.ReadSeeker,
+	size int64,
+) (objectState, *claim, error) {
+	c, state, err := ms.claim(ctx, key, hash)
+	if c == nil {
+		return state, nil, err
+	}
+
+	// hash named objects can't collide, so there is nothing to check
+	if ms.skipExisting == SkipExistingOff && ms.keyTemplate.Unique() {
+		return objectMissing, c, nil
+	}
+
+	out, err := ms.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(ms.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var respErr *awshttp.ResponseError
+
+		// no read permission doesn't allow to tell, so just upload
+		if errors.As(err, &respErr) &&
+			(respErr.HTTPStatusCode() == http.StatusNotFound || respErr.HTTPStatusCode() == http.StatusForbidden) {
+			return objectMissing, c, nil
+		}
+
+		ms.finish(c, false)
+
+		return objectMissing, nil, fmt.Errorf("s3 storage: head object: %w", err)
+	}
+
+	same := ms.keyTemplate.Unique()
+
+	if stored, ok := out.Metadata[MetaSHA256]; ok {
+		same = stored == hash
+	} else if !same || ms.skipExisting == SkipExistingETag {
+		same, err = etagMatches(out, body, size)
+		if err != nil {
+			ms.finish(c, false)
+
+			return objectMissing, nil, err
+		}
+
+		// ETag mismatch of hash named object means broken upload, it is overwritten
+		if !same && ms.keyTemplate.Unique() {
+			return objectMissing, c, nil
+		}
+	}
+
+	if !same {
+		ms.finish(c, false)
+
+		return objectConflict, nil, nil
+	}
+
+	return objectSame, c, nil
+}
+
+// claim takes the key for upload of the content. If the key is already claimed, nil claim is
+// returned with the object state: conflict for other content or, once upload of the same content
+// succeeded, same. Failed upload releases the key, so it is claimed again.
+func (ms *MediaStorage) claim(ctx context.Context, key, hash string) (*claim, objectState, error) {
+	for {
+		ms.mux.Lock()
+		c, ok := ms.claimed[key]
+
+		if !ok {
+			c = &claim{key: key, hash: hash, done: make(chan struct{})}
+			ms.claimed[key] = c
+		}
+		ms.mux.Unlock()
+
+		switch {
+		case !ok:
+			return c, objectMissing, nil
+		case c.hash != hash:
+			return nil, objectConflict, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, objectMissing, ctx.Err() // nolint: wrapcheck
+		case <-c.done:
+		}
+
+		if c.stored {
+			return nil, objectSame, nil
+		}
+	}
+}
+
+// finish completes claimed upload. Key of failed upload is released.
+func (ms *MediaStorage) finish(c *claim, stored bool) {
+	if c == nil {
+		return
+	}
+
+	ms.mux.Lock()
+	defer ms.mux.Unlock()
+
+	select {
+	case <-c.done:
+		return
+	default:
+	}
+
+	if !stored && ms.claimed[c.key] == c {
+		delete(ms.claimed, c.key)
+	}
+
+	c.stored = stored
+	close(c.done)
+}
+
+func etagMatches(out *s3.HeadObjectOutput, body io.ReadSeeker, size int64) (bool, error) {
+	etag := strings.Trim(aws.ToString(out.ETag), `"`)
+
+	// multipart upload ETag is not an MD5 of the content, fallback to size comparison
+	if strings.Contains(etag, "-") {
+		return aws.ToInt64(out.ContentLength) == size, nil
+	}
+
+	sum, _, err := hashContent(body, md5.New()) // nolint: gosec
+	if err != nil {
+		return false, err
+	}
+
+	return strings.EqualFold(etag, hex.EncodeToString(sum)), nil
 }
 
-func (ms *MediaStorage) Upload(ctx context.Context, media entities.MediaFile) (string, error) {
-	ext := filepath.Ext(media.Name)
-	hash := sha256.New()
+func (ms *MediaStorage) objectMetadata(media entities.MediaFile, hash string) map[string]string {
+	meta := maps.Clone(ms.metadata)
+	meta[MetaSHA256] = hash
 
-	if _, err := hash.Write(media.Data); err != nil {
-		return "", fmt.Errorf("generate file hash")
+	// metadata is sent as headers, so non-ASCII values are escaped
+	meta[MetaSourceName] = url.PathEscape(media.Name)
+
+	if ms.profile != "" {
+		meta[MetaProfile] = url.PathEscape(ms.profile)
 	}
 
-	key := hex.EncodeToString(hash.Sum(nil))[:32] + ext
+	ms.mux.RLock()
+	defer ms.mux.RUnlock()
 
-	if err := ms.Store(ctx, key, bytes.NewReader(media.Data)); err != nil {
-		return "", fmt.Errorf("store file: %w", err)
+	if ms.album != "" {
+		meta[MetaAlbum] = url.PathEscape(ms.album)
 	}
 
-	actualPath := filepath.ToSlash(filepath.Join(ms.root, key))
-	url := ms.publicURL + actualPath
+	return meta
+}
+
+// Delete removes object by its key, returned as delete handle on upload.
+func (ms *MediaStorage) Delete(ctx context.Context, key string) error {
+	_, err := ms.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(ms.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("s3 storage: delete object: %w", err)
+	}
+
+	return nil
+}
+
+// List returns all objects under storage root. URLs of objects are never presigned.
+func (ms *MediaStorage) List(ctx context.Context) ([]entities.StoredObject, error) {
+	var (
+		res       []entities.StoredObject
+		paginator = s3.NewListObjectsV2Paginator(ms.client, &s3.ListObjectsV2Input{
+			Bucket: aws.String(ms.bucket),
+			Prefix: aws.String(strings.TrimSuffix(ms.root, "/") + "/"),
+		})
+	)
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("s3 storage: list objects: %w", err)
+		}
+
+		for _, obj := range page.Contents {
+			key := aws.ToString(obj.Key)
+
+			u, err := ms.objectURL(key)
+			if err != nil {
+				return nil, err
+			}
+
+			res = append(res, entities.StoredObject{
+				Handle:     key,
+				URL:        u,
+				Size:       aws.ToInt64(obj.Size),
+				ModifiedAt: aws.ToTime(obj.LastModified),
+			})
+		}
+	}
 
-	return url, nil
+	return res, nil
 }
@@ -0,0 +1,358 @@
+package s3_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5" // nolint: gosec
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	awss3 "github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bohdanch-w/go-tgupload/entities"
+	"github.com/bohdanch-w/go-tgupload/storage/s3"
+)
+
+func newClient(endpoint string) *awss3.Client {
+	return awss3.New(awss3.Options{
+		Region:       "eu-central-1",
+		BaseEndpoint: aws.String(endpoint),
+		Credentials:  credentials.NewStaticCredentialsProvider("key", "secret", ""),
+	})
+}
+
+// newFakeStorage creates storage backed by in-memory S3. Requests, for which intercept returns true,
+// are not passed to S3.
+func newFakeStorage(
+	t *testing.T,
+	intercept func(w http.ResponseWriter, r *http.Request) bool,
+	opts ...s3.Option,
+) (*s3mem.Backend, *s3.MediaStorage) {
+	t.Helper()
+
+	backend := s3mem.New()
+	require.NoError(t, backend.CreateBucket("bucket"))
+
+	handler := gofakes3.New(backend).Server()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if intercept == nil || !intercept(w, r) {
+			handler.ServeHTTP(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	client := awss3.New(awss3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(srv.URL),
+		Credentials:  credentials.NewStaticCredentialsProvider("key", "secret", ""),
+		UsePathStyle: true,
+		// gofakes3 stores streaming checksum trailers as object content
+		RequestChecksumCalculation: aws.RequestChecksumCalculationWhenRequired,
+		RetryMaxAttempts:           1,
+	})
+
+	return backend, s3.NewMediaStorage(client, "bucket", "gallery", "https://cdn.example.com", opts...)
+}
+
+func isPut(r *http.Request) bool {
+	return r.Method == http.MethodPut
+}
+
+func TestMediaStorageObjectHeaders(t *testing.T) {
+	var (
+		mux     sync.Mutex
+		headers = make(map[string]http.Header)
+	)
+
+	_, ms := newFakeStorage(t, func(_ http.ResponseWriter, r *http.Request) bool {
+		if isPut(r) {
+			mux.Lock()
+			headers[r.URL.Path] = r.Header.Clone()
+			mux.Unlock()
+		}
+
+		return false
+	},
+		s3.WithACL(types.ObjectCannedACLPublicRead),
+		s3.WithCacheControl("public, max-age=31536000"),
+		s3.WithMetadata(map[string]string{"owner": "test"}),
+		s3.WithProfile("main"),
+	)
+
+	require.NoError(t, ms.CreateAlbum(context.Background(), "Моя галерея"))
+
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+	tests := []struct {
+		name        string
+		file        string
+		data        []byte
+		contentType string
+	}{
+		{name: "extension", file: "01 фото.png", data: []byte("not checked"), contentType: "image/png"},
+		{name: "sniffed", file: "scan", data: png, contentType: "image/png"},
+		{name: "unknown extension", file: "notes.unknown", data: []byte("plain text"), contentType: "text/plain; charset=utf-8"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := ms.Upload(context.Background(), entities.MediaFile{Name: tt.file, Data: tt.data})
+			require.NoError(t, err)
+
+			mux.Lock()
+			h := headers["/bucket/"+res.DeleteHandle]
+			mux.Unlock()
+
+			require.NotNil(t, h, "object must be put")
+
+			sum := sha256.Sum256(tt.data)
+
+			require.Equal(t, tt.contentType, h.Get("Content-Type"))
+			require.Equal(t, "public-read", h.Get("X-Amz-Acl"))
+			require.Equal(t, "public, max-age=31536000", h.Get("Cache-Control"))
+			require.Equal(t, "test", h.Get("X-Amz-Meta-Owner"))
+			require.Equal(t, "main", h.Get("X-Amz-Meta-Profile"))
+			require.Equal(t, hex.EncodeToString(sum[:]), h.Get("X-Amz-Meta-"+s3.MetaSHA256))
+			require.Equal(t, url.PathEscape(tt.file), h.Get("X-Amz-Meta-"+s3.MetaSourceName))
+			require.Equal(t, url.PathEscape("Моя галерея"), h.Get("X-Amz-Meta-"+s3.MetaAlbum))
+		})
+	}
+}
+
+func TestMediaStorageSkipExisting(t *testing.T) {
+	var (
+		data   = []byte("image")
+		sum    = sha256.Sum256(data)
+		hash   = hex.EncodeToString(sum[:])
+		key    = "gallery/" + hash[:32] + ".png"
+		etag   = md5.Sum(data) // nolint: gosec
+		sha256 = "X-Amz-Meta-" + s3.MetaSHA256
+	)
+
+	multipart := func(size int) func(w http.ResponseWriter) {
+		return func(w http.ResponseWriter) {
+			w.Header().Set("ETag", `"`+hex.EncodeToString(etag[:])+`-2"`)
+			w.Header().Set("Content-Length", strconv.Itoa(size))
+			w.WriteHeader(http.StatusOK)
+		}
+	}
+
+	tests := []struct {
+		name string
+		mode s3.SkipExisting
+		// stored is metadata of already stored object, nil if there is no object
+		stored map[string]string
+		// head replaces response of S3 to HeadObject
+		head     func(w http.ResponseWriter)
+		uploaded bool
+	}{
+		{name: "missing", mode: s3.SkipExistingOn, uploaded: true},
+		{name: "same hash", mode: s3.SkipExistingOn, stored: map[string]string{sha256: hash}},
+		{name: "other hash", mode: s3.SkipExistingOn, stored: map[string]string{sha256: "other"}, uploaded: true},
+		{name: "no hash", mode: s3.SkipExistingOn, stored: map[string]string{}},
+		{name: "etag", mode: s3.SkipExistingETag, stored: map[string]string{}},
+		{name: "multipart same size", mode: s3.SkipExistingETag, head: multipart(len(data))},
+		{name: "multipart other size", mode: s3.SkipExistingETag, head: multipart(len(data) + 1), uploaded: true},
+		{name: "forbidden", mode: s3.SkipExistingOn, head: func(w http.ResponseWriter) {
+			w.WriteHeader(http.StatusForbidden)
+		}, uploaded: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var heads, puts atomic.Int64
+
+			fake, ms := newFakeStorage(t, func(w http.ResponseWriter, r *http.Request) bool {
+				switch {
+				case r.Method == http.MethodHead:
+					heads.Add(1)
+
+					if tt.head != nil {
+						tt.head(w)
+
+						return true
+					}
+				case isPut(r):
+					puts.Add(1)
+				}
+
+				return false
+			}, s3.WithSkipExisting(tt.mode))
+
+			if tt.stored != nil {
+				_, err := fake.PutObject("bucket", key, tt.stored, bytes.NewReader(data), int64(len(data)), nil)
+				require.NoError(t, err)
+			}
+
+			res, err := ms.Upload(context.Background(), entities.MediaFile{Name: "01.png", Data: data})
+			require.NoError(t, err)
+			require.Positive(t, heads.Load(), "existing object must be checked")
+
+			if !tt.uploaded {
+				require.Zero(t, puts.Load(), "stored object must not be uploaded again")
+				require.Equal(t, key, res.DeleteHandle)
+
+				return
+			}
+
+			require.EqualValues(t, 1, puts.Load())
+
+			_, err = fake.HeadObject("bucket", res.DeleteHandle)
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestMediaStorageRetryAfterFailedStore(t *testing.T) {
+	var failing atomic.Bool
+
+	failing.Store(true)
+
+	fake, ms := newFakeStorage(t, func(w http.ResponseWriter, r *http.Request) bool {
+		if isPut(r) && failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+
+			return true
+		}
+
+		return false
+	})
+
+	media := entities.MediaFile{Name: "01.png", Data: []byte("image")}
+
+	_, err := ms.Upload(context.Background(), media)
+	require.Error(t, err)
+
+	failing.Store(false)
+
+	res, err := ms.Upload(context.Background(), media)
+	require.NoError(t, err)
+
+	_, err = fake.HeadObject("bucket", res.DeleteHandle)
+	require.NoError(t, err, "key of failed upload must not be reported as stored")
+}
+
+func TestMediaStorageConcurrentSameContent(t *testing.T) {
+	var (
+		puts    atomic.Int64
+		started = make(chan struct{})
+		release = make(chan struct{})
+	)
+
+	fake, ms := newFakeStorage(t, func(_ http.ResponseWriter, r *http.Request) bool {
+		if isPut(r) && puts.Add(1) == 1 {
+			close(started)
+			<-release
+		}
+
+		return false
+	})
+
+	var releaseOnce sync.Once
+
+	// server waits for blocked request on close, so it is released if test fails
+	t.Cleanup(func() { releaseOnce.Do(func() { close(release) }) })
+
+	media := entities.MediaFile{Name: "01.png", Data: []byte("image")}
+	firstDone := make(chan error, 1)
+
+	go func() {
+		_, err := ms.Upload(context.Background(), media)
+		firstDone <- err
+	}()
+
+	<-started
+
+	secondDone := make(chan entities.MediaFile, 1)
+
+	go func() {
+		res, err := ms.Upload(context.Background(), media)
+		if err != nil {
+			res.DeleteHandle = ""
+		}
+
+		secondDone <- res
+	}()
+
+	select {
+	case <-secondDone:
+		t.Fatal("upload of the same content finished before the object was stored")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	releaseOnce.Do(func() { close(release) })
+
+	require.NoError(t, <-firstDone)
+
+	res := <-secondDone
+	require.NotEmpty(t, res.DeleteHandle)
+	require.EqualValues(t, 1, puts.Load(), "same content is uploaded once")
+
+	_, err := fake.HeadObject("bucket", res.DeleteHandle)
+	require.NoError(t, err)
+}
+
+func TestMediaStorageURLMode(t *testing.T) {
+	media := entities.MediaFile{Name: "01.png", DeleteHandle: "gallery/0123.png"}
+
+	tests := []struct {
+		mode     s3.URLMode
+		endpoint string
+		expected string
+	}{
+		{mode: s3.URLModePublic, expected: "https://cdn.example.com/gallery/0123.png"},
+		{mode: s3.URLModePathStyle, endpoint: "http://localhost:9000", expected: "http://localhost:9000/bucket/gallery/0123.png"},
+		{mode: s3.URLModeVirtualHost, endpoint: "https://s3.example.com", expected: "https://bucket.s3.example.com/gallery/0123.png"},
+		{mode: s3.URLModePathStyle, expected: "https://s3.eu-central-1.amazonaws.com/bucket/gallery/0123.png"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			client := awss3.New(awss3.Options{Region: "eu-central-1", BaseEndpoint: nilIfEmpty(tt.endpoint)})
+			ms := s3.NewMediaStorage(client, "bucket", "gallery", "https://cdn.example.com/", s3.WithURLMode(tt.mode, 0))
+
+			res, err := ms.Refresh(context.Background(), media)
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, res.URL)
+			require.True(t, res.ExpiresAt.IsZero())
+		})
+	}
+}
+
+func TestMediaStoragePresigned(t *testing.T) {
+	ms := s3.NewMediaStorage(newClient("http://localhost:9000"), "bucket", "", "",
+		s3.WithURLMode(s3.URLModePresigned, time.Hour))
+
+	res, err := ms.Refresh(context.Background(), entities.MediaFile{DeleteHandle: "gallery/0123.png"})
+	require.NoError(t, err)
+	require.WithinDuration(t, time.Now().Add(time.Hour), res.ExpiresAt, time.Minute)
+
+	u, err := url.Parse(res.URL)
+	require.NoError(t, err)
+	require.Equal(t, "bucket.localhost:9000", u.Host)
+	require.Equal(t, "/gallery/0123.png", u.Path)
+	require.Equal(t, "3600", u.Query().Get("X-Amz-Expires"))
+	require.NotEmpty(t, u.Query().Get("X-Amz-Signature"))
+}
+
+func nilIfEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+
+	return aws.String(s)
+}
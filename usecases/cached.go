@@ -0,0 +1,69 @@
+package usecases
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/hashicorp/go-multierror"
+
+	"github.com/bohdanch-w/go-tgupload/cache"
+	"github.com/bohdanch-w/go-tgupload/entities"
+	"github.com/bohdanch-w/go-tgupload/services"
+
+	whlogger "github.com/bohdanch-w/wheel/logger"
+)
+
+var (
+	_ services.CDN      = (*CachedCDN)(nil)
+	_ services.AlbumCDN = (*CachedCDN)(nil)
+	_ io.Closer         = (*CachedCDN)(nil)
+)
+
+// NewCachedCDN creates CDN, which reuses links of files uploaded before with the same content.
+// Cache is opened from the path, which may not exist yet, and saved on Close,
+// so that progress of failed uploads is kept as well.
+func NewCachedCDN(logger whlogger.Logger, cdn services.CDN, path string, opts ...cache.Option) (*CachedCDN, error) {
+	mediaCache, err := cache.Open(path, cdn, logger, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("open cache %s: %w", path, err)
+	}
+
+	return &CachedCDN{
+		cache: mediaCache,
+		cdn:   cdn,
+		path:  path,
+	}, nil
+}
+
+type CachedCDN struct {
+	cache *cache.MediaCache
+	cdn   services.CDN
+	path  string
+}
+
+func (c *CachedCDN) Upload(ctx context.Context, media entities.MediaFile) (entities.MediaFile, error) {
+	return c.cache.Upload(ctx, media) // nolint: wrapcheck
+}
+
+// CreateAlbum creates album on underlying CDN. Files found in cache stay in their old albums.
+func (c *CachedCDN) CreateAlbum(ctx context.Context, title string) error {
+	return createAlbum(ctx, c.cdn, title)
+}
+
+// Close saves cache and releases underlying CDN.
+func (c *CachedCDN) Close() error {
+	var mErr *multierror.Error
+
+	if err := c.cache.Close(); err != nil {
+		mErr = multierror.Append(mErr, fmt.Errorf("save cache %s: %w", c.path, err))
+	}
+
+	if closer, ok := c.cdn.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			mErr = multierror.Append(mErr, err)
+		}
+	}
+
+	return mErr.ErrorOrNil()
+}
@@ -0,0 +1,56 @@
+package usecases_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bohdanch-w/go-tgupload/entities"
+	"github.com/bohdanch-w/go-tgupload/usecases"
+
+	whlogger "github.com/bohdanch-w/wheel/logger"
+)
+
+func TestCachedCDNKeepsPartialProgress(t *testing.T) {
+	var (
+		ctx    = context.Background()
+		logger = whlogger.NewNullLogger()
+		path   = filepath.Join(t.TempDir(), "cache.json")
+		files  = []entities.MediaFile{
+			{Name: "01.png", Path: "01.png", Data: []byte("first")},
+			{Name: "02.png", Path: "02.png", Data: []byte("second")},
+		}
+	)
+
+	failing := &fakeCDN{prefix: "https://cdn/", failAt: 2}
+
+	// missing cache file is not an error
+	cdn, err := usecases.NewCachedCDN(logger, failing, path)
+	require.NoError(t, err)
+
+	_, err = cdn.Upload(ctx, files[0])
+	require.NoError(t, err)
+
+	_, err = cdn.Upload(ctx, files[1])
+	require.Error(t, err)
+
+	require.NoError(t, cdn.Close())
+
+	retry := &fakeCDN{prefix: "https://retry/"}
+
+	cdn, err = usecases.NewCachedCDN(logger, retry, path)
+	require.NoError(t, err)
+
+	first, err := cdn.Upload(ctx, files[0])
+	require.NoError(t, err)
+	require.Equal(t, "https://cdn/01.png", first.URL)
+
+	second, err := cdn.Upload(ctx, files[1])
+	require.NoError(t, err)
+	require.Equal(t, "https://retry/02.png", second.URL)
+
+	require.EqualValues(t, 1, retry.calls.Load())
+	require.NoError(t, cdn.Close())
+}
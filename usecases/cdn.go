@@ -3,126 +3,282 @@ package usecases
 import (
 	"context"
 	"fmt"
+	"io"
+	"strings"
+	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	awsconfig "github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/credentials"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
-
+	"github.com/bohdanch-w/go-tgupload/cache"
 	"github.com/bohdanch-w/go-tgupload/config"
-	"github.com/bohdanch-w/go-tgupload/integrations/postimages"
+	"github.com/bohdanch-w/go-tgupload/pkg/phash"
+	"github.com/bohdanch-w/go-tgupload/registry"
 	"github.com/bohdanch-w/go-tgupload/services"
-	s3storage "github.com/bohdanch-w/go-tgupload/storage/s3"
+
+	// CDN backends register themselves in the registry.
+	_ "github.com/bohdanch-w/go-tgupload/integrations/postimages"
+	_ "github.com/bohdanch-w/go-tgupload/storage/azblob"
+	_ "github.com/bohdanch-w/go-tgupload/storage/plugin"
+	_ "github.com/bohdanch-w/go-tgupload/storage/s3"
 
 	"github.com/bohdanch-w/wheel/collections"
 	wherr "github.com/bohdanch-w/wheel/errors"
-)
-
-const (
-	CDNTypePostImage = "post-image"
-	CDNTypeS3        = "s3"
+	whlogger "github.com/bohdanch-w/wheel/logger"
 )
 
 type CDNOptions struct {
-	S3 struct {
-		KeyID           string
-		SecretAccessKey string
-		Region          string
-		Endpoint        string
-		Bucket          string
-		Location        string
-		PublicURL       string
-	}
-	PostImage struct {
-		APIKey string
-	}
-	Cache struct {
+	// Values of backend options set via command line, keyed by config key.
+	Values   map[string]string
+	Mirrors  string
+	Parallel uint
+	Verify   bool
+	Cache    struct {
 		Enable   bool
 		FilePath string
+		// TTL is the period cached link is reused without check per CDN type, as parsed by
+		// cache.ParseTTL. Overrides cache-ttl config.
+		TTL string
+		// Similar is what to do with images perceptually similar to cached ones: SimilarWarn,
+		// SimilarReuse or nothing if empty.
+		Similar string
+		// SimilarDistance is the maximal Hamming distance of perceptual hashes of similar images.
+		// Negative if not set: default distance is used and similar images are only reported,
+		// so that links of other images are never reused by a guess.
+		SimilarDistance int
 	}
 }
 
-func NewCDN(ctx context.Context, typ string, cfg config.Config, opts CDNOptions) (services.CDN, error) {
-	var (
-		cdn services.CDN
-		err error
-	)
+const (
+	SimilarWarn  = "warn"
+	SimilarReuse = "reuse"
+)
 
+const errInvalidSimilar = wherr.Error("invalid similar images mode")
+
+// NewCDN creates CDN from the comma separated list of types, e.g. "post-image,s3".
+// Types after the first one are used as fallbacks in case previous ones fail. Once upload to a CDN
+// failed, the rest of files go to the fallback, the failed one isn't retried until the next run.
+// Uploads are limited by cdn-timeout only when there is a fallback to switch to.
+// Additionally files are copied to every CDN from the mirrors list.
+func NewCDN(
+	ctx context.Context,
+	logger whlogger.Logger,
+	typ string,
+	cfg config.Config,
+	opts CDNOptions,
+) (services.CDN, error) {
 	typ = collections.DefaultIfEmpty(typ, cfg.Get(config.PreferredCDN))
+	if typ == "" {
+		return nil, wherr.Error("cdn type is not configured")
+	}
 
-	switch typ {
-	case CDNTypePostImage:
-		cdn, err = newPostImageCDN(cfg, opts)
+	var timeout time.Duration
+
+	if v := cfg.Get(config.CDNTimeout); v != "" {
+		d, err := time.ParseDuration(v)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("parse %s: %w", config.CDNTimeout, err)
 		}
-	case CDNTypeS3:
-		cdn, err = newS3CDN(ctx, cfg, opts)
+
+		timeout = d
+	}
+
+	backends, err := newBackendCDNs(ctx, logger, typ, cfg, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(backends) == 1 {
+		timeout = 0
+	}
+
+	fallback := NewFallbackCDN(logger, timeout, backends...)
+
+	var (
+		cdn         services.CDN = fallback
+		mirrorTypes              = collections.DefaultIfEmpty(opts.Mirrors, cfg.Get(config.MirrorCDN))
+	)
+
+	if mirrorTypes != "" {
+		mirrors, err := newBackendCDNs(ctx, logger, mirrorTypes, cfg, opts)
 		if err != nil {
+			fallback.Close()
+
 			return nil, err
 		}
-	case "":
-		return nil, wherr.Error("cdn type is not configured")
-	default:
-		return nil, wherr.Errorf("%w: %q", "unsupported cdn type", typ)
+
+		cdn = NewMirrorCDN(logger, fallback, mirrors...)
 	}
 
 	if opts.Cache.Enable {
-		// ...
+		namespace, cdnTypes := cacheNamespace(typ, mirrorTypes, cfg, opts)
+
+		cached, err := newCachedCDN(logger, cdn, cfg, opts, cache.WithNamespace(namespace, cdnTypes...))
+		if err != nil {
+			if closer, ok := cdn.(io.Closer); ok {
+				closer.Close()
+			}
+
+			return nil, err
+		}
+
+		cdn = cached
 	}
 
 	return cdn, nil
 }
 
-func newPostImageCDN(cfg config.Config, opts CDNOptions) (*postimages.API, error) {
-	postImageAPIKey := collections.DefaultIfEmpty(opts.PostImage.APIKey, cfg.Get(config.PostimgAPIKey))
-	if postImageAPIKey == "" {
-		return nil, wherr.Error("post-image: no api key provided")
+func newBackendCDNs(
+	ctx context.Context,
+	logger whlogger.Logger,
+	types string,
+	cfg config.Config,
+	opts CDNOptions,
+) ([]NamedCDN, error) {
+	var backends []NamedCDN
+
+	for _, name := range strings.Split(types, ",") {
+		name = strings.TrimSpace(name)
+
+		cdn, err := newBackendCDN(ctx, name, cfg, opts)
+		if err != nil {
+			closeBackends(backends)
+
+			return nil, err
+		}
+
+		if opts.Verify {
+			cdn = NewVerifiedCDN(logger, cdn, nil, defaultVerifyAttempts, defaultVerifyDelay)
+		}
+
+		backends = append(backends, NamedCDN{Name: name, CDN: cdn})
 	}
 
-	return postimages.NewAPI(postImageAPIKey, ""), nil
+	return backends, nil
 }
 
-func newS3CDN(ctx context.Context, cfg config.Config, opts CDNOptions) (*s3storage.MediaStorage, error) {
-	keyID := collections.DefaultIfEmpty(opts.S3.KeyID, cfg.Get(config.AWSKeyID))
-	secretKey := collections.DefaultIfEmpty(opts.S3.SecretAccessKey, cfg.Get(config.AWSSecretAccessKey))
-	region := collections.DefaultIfEmpty(opts.S3.Region, cfg.Get(config.AWSRegion))
-	endpoint := collections.DefaultIfEmpty(opts.S3.Endpoint, cfg.Get(config.AWSEndpoint))
-	bucket := collections.DefaultIfEmpty(opts.S3.Bucket, cfg.Get(config.AWSS3Bucket))
-	location := collections.DefaultIfEmpty(opts.S3.Location, cfg.Get(config.AWSS3Location))
-	publicURL := collections.DefaultIfEmpty(opts.S3.PublicURL, cfg.Get(config.AWSS3PublicURL))
-
-	if keyID == "" || secretKey == "" {
-		return nil, wherr.Error("s3: missing credentials")
+func newBackendCDN(ctx context.Context, typ string, cfg config.Config, opts CDNOptions) (services.CDN, error) {
+	return newConfiguredCDN(ctx, typ, cfg, opts, optionGetter(cfg, opts))
+}
+
+func newConfiguredCDN(
+	ctx context.Context,
+	typ string,
+	cfg config.Config,
+	opts CDNOptions,
+	get func(key string) string,
+) (services.CDN, error) {
+	if typ == "" {
+		return nil, wherr.Error("cdn type is empty")
 	}
 
-	if bucket == "" || publicURL == "" {
-		return nil, wherr.Error("s3: invalid configuration")
+	backend, arg, ok := registry.Lookup(typ)
+	if !ok {
+		return nil, wherr.Errorf("%w: %q", "unsupported cdn type", typ)
 	}
 
-	awsCfg, err := awsconfig.LoadDefaultConfig(
-		ctx,
-		awsconfig.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
-			keyID,
-			secretKey,
-			"",
-		)),
-		awsconfig.WithDefaultRegion(region),
-		awsconfig.WithRegion(region),
+	return backend.New(ctx, registry.Params{
+		Arg:      arg,
+		Parallel: collections.DefaultIfEmpty(opts.Parallel, defaultCDNUploadParallel),
+		Profile:  cfg.Profile,
+		Get:      get,
+	})
+}
+
+// CDNIdentities returns identities of CDNs files are uploaded to, including mirrors, keyed by type.
+// Stored along with uploads, they allow to find the files after config is changed.
+func CDNIdentities(typ string, cfg config.Config, opts CDNOptions) map[string]string {
+	var (
+		get        = optionGetter(cfg, opts)
+		identities = make(map[string]string)
 	)
-	if err != nil {
-		return nil, fmt.Errorf("can't load AWS config: %w", err)
+
+	for _, list := range []string{
+		collections.DefaultIfEmpty(typ, cfg.Get(config.PreferredCDN)),
+		collections.DefaultIfEmpty(opts.Mirrors, cfg.Get(config.MirrorCDN)),
+	} {
+		for _, name := range strings.Split(list, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				identities[name] = registry.Identity(name, get)
+			}
+		}
 	}
 
-	var s3ClientOpts []func(*s3.Options)
+	return identities
+}
+
+// optionGetter resolves backend option values, command line ones take precedence over config.
+func optionGetter(cfg config.Config, opts CDNOptions) func(key string) string {
+	return func(key string) string {
+		return collections.DefaultIfEmpty(opts.Values[key], cfg.Get(key))
+	}
+}
+
+// newCachedCDN opens cache of CDN, revalidating links older than configured ttl.
+func newCachedCDN(
+	logger whlogger.Logger,
+	cdn services.CDN,
+	cfg config.Config,
+	opts CDNOptions,
+	cacheOpts ...cache.Option,
+) (*CachedCDN, error) {
+	if v := collections.DefaultIfEmpty(opts.Cache.TTL, cfg.Get(config.CacheTTL)); v != "" {
+		ttl, err := cache.ParseTTL(v)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", config.CacheTTL, err)
+		}
 
-	if endpoint != "" {
-		s3ClientOpts = append(s3ClientOpts, func(o *s3.Options) {
-			o.BaseEndpoint = aws.String(endpoint)
-		})
+		cacheOpts = append(cacheOpts, cache.WithRevalidation(ttl, nil))
 	}
 
-	client := s3.NewFromConfig(awsCfg, s3ClientOpts...)
+	switch opts.Cache.Similar {
+	case "":
+	case SimilarWarn, SimilarReuse:
+		distance, reuse := opts.Cache.SimilarDistance, opts.Cache.Similar == SimilarReuse
+
+		if distance < 0 {
+			if reuse {
+				logger.Warnf("similar distance is not set, similar images are only reported")
+			}
+
+			distance, reuse = phash.DefaultDistance, false
+		}
+
+		cacheOpts = append(cacheOpts, cache.WithSimilarity(distance, reuse))
+	default:
+		return nil, fmt.Errorf("%w: %q", errInvalidSimilar, opts.Cache.Similar)
+	}
+
+	return NewCachedCDN(logger, cdn, opts.Cache.FilePath, cacheOpts...)
+}
+
+// cacheNamespace identifies CDN chain for the cache, e.g. "s3{aws-s3-bucket=images}+mirrors:azblob{...}".
+// Mirrors are part of it, so that cached links have all mirrors. It also returns used CDN types.
+func cacheNamespace(types, mirrorTypes string, cfg config.Config, opts CDNOptions) (string, []string) {
+	var (
+		get       = optionGetter(cfg, opts)
+		cdnTypes  []string
+		namespace strings.Builder
+	)
+
+	for i, list := range []string{types, mirrorTypes} {
+		if list == "" {
+			continue
+		}
+
+		if i > 0 {
+			namespace.WriteString("+mirrors:")
+		}
+
+		for j, name := range strings.Split(list, ",") {
+			name = strings.TrimSpace(name)
+			cdnTypes = append(cdnTypes, name)
+
+			if j > 0 {
+				namespace.WriteString(",")
+			}
+
+			namespace.WriteString(registry.Identity(name, get))
+		}
+	}
 
-	return s3storage.NewMediaStorage(client, bucket, location, publicURL), nil
+	return namespace.String(), cdnTypes
 }
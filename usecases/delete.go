@@ -0,0 +1,292 @@
+package usecases
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/hashicorp/go-multierror"
+
+	"github.com/bohdanch-w/go-tgupload/cache"
+	"github.com/bohdanch-w/go-tgupload/config"
+	"github.com/bohdanch-w/go-tgupload/entities"
+	"github.com/bohdanch-w/go-tgupload/history"
+	"github.com/bohdanch-w/go-tgupload/registry"
+	"github.com/bohdanch-w/go-tgupload/services"
+
+	wherr "github.com/bohdanch-w/wheel/errors"
+)
+
+const (
+	ErrDeleteUnsupported = entities.Error("cdn does not support deletion")
+	ErrNoDeleteHandle    = entities.Error("no delete handle saved")
+	ErrNoUploadsMatched  = entities.Error("no uploaded files matched")
+)
+
+var _ io.Closer = (*CDNRemover)(nil)
+
+// NewCDNRemover creates remover, which deletes media from CDNs it was uploaded to.
+// CDN backends are created on demand, as they were configured when media was uploaded.
+func NewCDNRemover(cfg config.Config, opts CDNOptions) *CDNRemover {
+	return &CDNRemover{
+		cdnPool: newCDNPool(cfg, opts),
+	}
+}
+
+type CDNRemover struct {
+	*cdnPool
+}
+
+// DeleteReport describes result of RemoveUploads.
+type DeleteReport struct {
+	// Removed are media deleted from CDNs and dropped from history and cache.
+	Removed []entities.MediaFile
+	// Kept are links to objects left on CDN, since other uploads still reference them.
+	Kept []string
+}
+
+// upload is media found in history or cache with identities of CDNs it was stored to.
+type upload struct {
+	media      entities.MediaFile
+	identities map[string]string
+}
+
+// RemoveUploads deletes matched media, recorded in history or cache, from CDNs including mirrors
+// and drops it from both. Objects shared with other uploads, e.g. content addressed keys used by
+// another gallery, are left on CDN. Media failed to delete stays in history and cache, so that
+// removal can be retried. Cache is optional.
+func (r *CDNRemover) RemoveUploads(
+	ctx context.Context,
+	historyPath string,
+	mediaCache *cache.MediaCache,
+	match func(entities.MediaFile) bool,
+) (DeleteReport, error) {
+	var report DeleteReport
+
+	records, err := history.Read(historyPath)
+	if err != nil {
+		return report, fmt.Errorf("read history: %w", err)
+	}
+
+	var (
+		found []upload
+		refs  = NewReferences()
+	)
+
+	for _, rec := range records {
+		for _, file := range rec.Files {
+			if media := file.ToMedia(); match(media) {
+				found = appendUpload(found, upload{media: media, identities: rec.Identities})
+			} else {
+				refs.AddMedia(media)
+			}
+		}
+	}
+
+	if mediaCache != nil {
+		err := mediaCache.Range(func(_ cache.Key, entry cache.Entry) bool {
+			if media := entry.Media(); match(media) {
+				found = appendUpload(found, upload{media: media})
+			} else {
+				refs.AddMedia(media)
+			}
+
+			return true
+		})
+		if err != nil {
+			return report, fmt.Errorf("read cache: %w", err)
+		}
+	}
+
+	if len(found) == 0 {
+		return report, ErrNoUploadsMatched
+	}
+
+	var (
+		mErr    *multierror.Error
+		removed = make(map[string]bool, len(found))
+	)
+
+	for _, up := range found {
+		kept, err := r.remove(ctx, up, refs)
+		report.Kept = append(report.Kept, kept...)
+
+		if err != nil {
+			mErr = multierror.Append(mErr, err)
+
+			continue
+		}
+
+		removed[up.media.URL] = true
+		report.Removed = append(report.Removed, up.media)
+	}
+
+	if len(removed) == 0 {
+		return report, mErr.ErrorOrNil()
+	}
+
+	// other uploads may share the link, so only matched ones are dropped
+	drop := func(media entities.MediaFile) bool { return removed[media.URL] && match(media) }
+
+	err = history.Update(historyPath, func(records []history.Record) []history.Record {
+		return dropFiles(records, drop)
+	})
+	if err != nil {
+		mErr = multierror.Append(mErr, fmt.Errorf("update history: %w", err))
+	}
+
+	if mediaCache != nil {
+		mediaCache.Remove(drop)
+	}
+
+	return report, mErr.ErrorOrNil()
+}
+
+// remove deletes media and all its mirrors, except objects still referenced by other uploads.
+// It returns links to kept objects.
+func (r *CDNRemover) remove(ctx context.Context, up upload, refs *References) ([]string, error) {
+	var (
+		mErr    *multierror.Error
+		kept    []string
+		targets = append([]entities.Mirror{{
+			CDN:          up.media.CDN,
+			URL:          up.media.URL,
+			DeleteHandle: up.media.DeleteHandle,
+		}}, up.media.Mirrors...)
+	)
+
+	for _, target := range targets {
+		if refs.Has(target.CDN, entities.StoredObject{Handle: target.DeleteHandle, URL: target.URL}) {
+			kept = append(kept, target.URL)
+
+			continue
+		}
+
+		if err := r.delete(ctx, target.CDN, up.identities[target.CDN], target.DeleteHandle); err != nil {
+			mErr = multierror.Append(mErr, fmt.Errorf("%s: %w", target.URL, err))
+		}
+	}
+
+	return kept, mErr.ErrorOrNil()
+}
+
+func (r *CDNRemover) delete(ctx context.Context, typ, identity, handle string) error {
+	if handle == "" {
+		return ErrNoDeleteHandle
+	}
+
+	cdn, err := r.getStored(ctx, typ, identity)
+	if err != nil {
+		return err
+	}
+
+	deleter, ok := cdn.(services.CDNDeleter)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrDeleteUnsupported, typ)
+	}
+
+	if err := deleter.Delete(ctx, handle); err != nil {
+		return fmt.Errorf("%s: %w", typ, err)
+	}
+
+	return nil
+}
+
+func appendUpload(uploads []upload, up upload) []upload {
+	if slices.ContainsFunc(uploads, func(u upload) bool { return u.media.URL == up.media.URL }) {
+		return uploads
+	}
+
+	return append(uploads, up)
+}
+
+func dropFiles(records []history.Record, drop func(entities.MediaFile) bool) []history.Record {
+	res := make([]history.Record, 0, len(records))
+
+	for _, rec := range records {
+		rec.Files = slices.DeleteFunc(rec.Files, func(f history.File) bool { return drop(f.ToMedia()) })
+		if len(rec.Files) == 0 && rec.PageURL == "" {
+			continue
+		}
+
+		res = append(res, rec)
+	}
+
+	return res
+}
+
+func newCDNPool(cfg config.Config, opts CDNOptions) *cdnPool {
+	return &cdnPool{
+		cfg:      cfg,
+		opts:     opts,
+		backends: make(map[string]services.CDN),
+	}
+}
+
+// cdnPool creates CDN backends by type on demand, for media uploaded before.
+type cdnPool struct {
+	cfg      config.Config
+	opts     CDNOptions
+	backends map[string]services.CDN
+}
+
+func (p *cdnPool) get(ctx context.Context, typ string) (services.CDN, error) {
+	if typ == "" {
+		return nil, wherr.Error("unknown cdn")
+	}
+
+	if cdn, ok := p.backends[typ]; ok {
+		return cdn, nil
+	}
+
+	cdn, err := newBackendCDN(ctx, typ, p.cfg, p.opts)
+	if err != nil {
+		return nil, fmt.Errorf("open cdn connection: %w", err)
+	}
+
+	p.backends[typ] = cdn
+
+	return cdn, nil
+}
+
+// getStored creates backend of the type as it was configured, when files were stored under
+// the identity. Backend configured from current options is used for unknown identity.
+func (p *cdnPool) getStored(ctx context.Context, typ, identity string) (services.CDN, error) {
+	if identity == "" {
+		return p.get(ctx, typ)
+	}
+
+	if cdn, ok := p.backends[identity]; ok {
+		return cdn, nil
+	}
+
+	get, err := registry.WithIdentity(identity, optionGetter(p.cfg, p.opts))
+	if err != nil {
+		return nil, err // nolint: wrapcheck
+	}
+
+	cdn, err := newConfiguredCDN(ctx, typ, p.cfg, p.opts, get)
+	if err != nil {
+		return nil, fmt.Errorf("open cdn connection: %w", err)
+	}
+
+	p.backends[identity] = cdn
+
+	return cdn, nil
+}
+
+// Close releases created CDN backends.
+func (p *cdnPool) Close() error {
+	var mErr *multierror.Error
+
+	for typ, cdn := range p.backends {
+		if closer, ok := cdn.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				mErr = multierror.Append(mErr, fmt.Errorf("%s: %w", typ, err))
+			}
+		}
+	}
+
+	return mErr.ErrorOrNil()
+}
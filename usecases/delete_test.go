@@ -0,0 +1,247 @@
+package usecases_test
+
+import (
+	"context"
+	"crypto/md5" // nolint: gosec
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bohdanch-w/go-tgupload/cache"
+	"github.com/bohdanch-w/go-tgupload/config"
+	"github.com/bohdanch-w/go-tgupload/entities"
+	"github.com/bohdanch-w/go-tgupload/history"
+	"github.com/bohdanch-w/go-tgupload/registry"
+	"github.com/bohdanch-w/go-tgupload/services"
+	"github.com/bohdanch-w/go-tgupload/usecases"
+
+	whlogger "github.com/bohdanch-w/wheel/logger"
+)
+
+const (
+	deleteCDN    = "test-delete"
+	deleteBucket = "test-delete-bucket"
+)
+
+// deleterCDN records deleted handles, deletion of "broken" handle fails.
+type deleterCDN struct {
+	mux     sync.Mutex
+	deleted []string
+}
+
+func (d *deleterCDN) Upload(_ context.Context, media entities.MediaFile) (entities.MediaFile, error) {
+	return media, nil
+}
+
+func (d *deleterCDN) Delete(_ context.Context, handle string) error {
+	if handle == "broken" {
+		return entities.Error("access denied")
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	d.deleted = append(d.deleted, handle)
+
+	return nil
+}
+
+var (
+	buckets        = make(map[string]*deleterCDN) // nolint: gochecknoglobals
+	bucketsMux     sync.Mutex                     // nolint: gochecknoglobals
+	registerDelete sync.Once                      // nolint: gochecknoglobals
+)
+
+// bucket returns fake backend storing files in the bucket.
+func bucket(name string) *deleterCDN {
+	bucketsMux.Lock()
+	defer bucketsMux.Unlock()
+
+	if _, ok := buckets[name]; !ok {
+		buckets[name] = &deleterCDN{}
+	}
+
+	return buckets[name]
+}
+
+func newTestRemover(t *testing.T, currentBucket string) *usecases.CDNRemover {
+	t.Helper()
+
+	registerDelete.Do(func() {
+		registry.Register(registry.Backend{
+			Name:    deleteCDN,
+			Options: []registry.Option{{Key: deleteBucket, Identity: true}},
+			New: func(_ context.Context, params registry.Params) (services.CDN, error) {
+				return bucket(params.Get(deleteBucket)), nil
+			},
+		})
+	})
+
+	var opts usecases.CDNOptions
+
+	opts.Values = map[string]string{deleteBucket: currentBucket}
+
+	rm := usecases.NewCDNRemover(config.Config{}, opts)
+	t.Cleanup(func() { rm.Close() })
+
+	return rm
+}
+
+func deleteIdentity(bucketName string) map[string]string {
+	return map[string]string{deleteCDN: deleteCDN + "{" + deleteBucket + "=" + bucketName + "}"}
+}
+
+func inDir(dir string) func(entities.MediaFile) bool {
+	return func(media entities.MediaFile) bool { return filepath.Dir(media.Path) == dir }
+}
+
+func TestCDNRemoverMissingHandle(t *testing.T) {
+	historyPath := filepath.Join(t.TempDir(), "history.jsonl")
+
+	require.NoError(t, history.Append(historyPath, history.NewRecord("", []entities.MediaFile{{
+		Path: "gallery/01.png",
+		URL:  "https://primary/01.png",
+		CDN:  "s3",
+		Mirrors: []entities.Mirror{
+			{CDN: "post-image", URL: "https://mirror/01.png"},
+		},
+	}})))
+
+	rm := usecases.NewCDNRemover(config.Config{}, usecases.CDNOptions{})
+	defer rm.Close()
+
+	report, err := rm.RemoveUploads(context.Background(), historyPath, nil, inDir("gallery"))
+	require.ErrorIs(t, err, usecases.ErrNoDeleteHandle)
+	require.ErrorContains(t, err, "https://primary/01.png")
+	require.ErrorContains(t, err, "https://mirror/01.png")
+	require.Empty(t, report.Removed)
+
+	records, err := history.Read(historyPath)
+	require.NoError(t, err)
+	require.Len(t, records, 1, "failed removal must stay in history")
+}
+
+func TestCDNRemoverRemoveUploads(t *testing.T) {
+	var (
+		dir         = t.TempDir()
+		historyPath = filepath.Join(dir, "history.jsonl")
+		old         = "remove-old-" + t.Name()
+	)
+
+	first := history.NewRecord("", []entities.MediaFile{
+		{Path: "first/01.png", URL: "https://old/shared.png", CDN: deleteCDN, DeleteHandle: "shared.png"},
+		{Path: "first/02.png", URL: "https://old/own.png", CDN: deleteCDN, DeleteHandle: "own.png"},
+	})
+	first.Identities = deleteIdentity(old)
+
+	second := history.NewRecord("", []entities.MediaFile{
+		{Path: "second/01.png", URL: "https://old/shared.png", CDN: deleteCDN, DeleteHandle: "shared.png"},
+	})
+	second.PageURL = "https://telegra.ph/second"
+	second.Identities = deleteIdentity(old)
+
+	require.NoError(t, history.Append(historyPath, first))
+	require.NoError(t, history.Append(historyPath, second))
+
+	mediaCache := cache.New(nil, whlogger.NewNullLogger())
+
+	cached := cache.Key{Hash: md5.Sum([]byte("own"))}      // nolint: gosec
+	cachedOnly := cache.Key{Hash: md5.Sum([]byte("only"))} // nolint: gosec
+	other := cache.Key{Hash: md5.Sum([]byte("other"))}     // nolint: gosec
+
+	require.NoError(t, mediaCache.Put(cached, cache.Entry{
+		Path: "first/02.png", URL: "https://old/own.png", CDN: deleteCDN, DeleteHandle: "own.png",
+	}))
+	require.NoError(t, mediaCache.Put(cachedOnly, cache.Entry{
+		Path: "first/03.png", URL: "https://old/only.png", CDN: deleteCDN, DeleteHandle: "only.png",
+	}))
+	require.NoError(t, mediaCache.Put(other, cache.Entry{
+		Path: "third/01.png", URL: "https://old/other.png", CDN: deleteCDN, DeleteHandle: "other.png",
+	}))
+
+	// current config points to another bucket, files are deleted where they were uploaded
+	current := "remove-new-" + t.Name()
+	rm := newTestRemover(t, current)
+
+	report, err := rm.RemoveUploads(context.Background(), historyPath, mediaCache, inDir("first"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"https://old/shared.png"}, report.Kept)
+	require.Len(t, report.Removed, 3)
+
+	require.ElementsMatch(t, []string{"own.png"}, bucket(old).deleted)
+	require.ElementsMatch(t, []string{"only.png"}, bucket(current).deleted, "cache only entries use current config")
+
+	records, err := history.Read(historyPath)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	require.Equal(t, second.PageURL, records[0].PageURL)
+	require.Equal(t, second.Files, records[0].Files)
+
+	var left []string
+
+	require.NoError(t, mediaCache.Range(func(_ cache.Key, entry cache.Entry) bool {
+		left = append(left, entry.Path)
+
+		return true
+	}))
+	require.Equal(t, []string{"third/01.png"}, left)
+}
+
+func TestCDNRemoverMirrorFailed(t *testing.T) {
+	var (
+		historyPath = filepath.Join(t.TempDir(), "history.jsonl")
+		primary     = "mirror-primary-" + t.Name()
+	)
+
+	rec := history.NewRecord("", []entities.MediaFile{
+		{
+			Path:         "gallery/01.png",
+			URL:          "https://primary/01.png",
+			CDN:          deleteCDN,
+			DeleteHandle: "01.png",
+			Mirrors: []entities.Mirror{
+				{CDN: deleteCDN + ":mirror", URL: "https://mirror/01.png", DeleteHandle: "broken"},
+			},
+		},
+		{Path: "gallery/02.png", URL: "https://primary/02.png", CDN: deleteCDN, DeleteHandle: "02.png"},
+	})
+	rec.Identities = deleteIdentity(primary)
+
+	require.NoError(t, history.Append(historyPath, rec))
+
+	rm := newTestRemover(t, primary)
+
+	report, err := rm.RemoveUploads(context.Background(), historyPath, nil, inDir("gallery"))
+	require.ErrorContains(t, err, "https://mirror/01.png")
+	require.ErrorContains(t, err, "access denied")
+	require.Len(t, report.Removed, 1)
+	require.Equal(t, "https://primary/02.png", report.Removed[0].URL)
+	require.ElementsMatch(t, []string{"01.png", "02.png"}, bucket(primary).deleted)
+
+	records, err := history.Read(historyPath)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	require.Len(t, records[0].Files, 1)
+	require.Equal(t, "https://primary/01.png", records[0].Files[0].URL, "partially removed file is kept to retry")
+}
+
+func TestCDNRemoverIdentityChanged(t *testing.T) {
+	historyPath := filepath.Join(t.TempDir(), "history.jsonl")
+
+	rec := history.NewRecord("", []entities.MediaFile{
+		{Path: "gallery/01.png", URL: "https://plugin/01.png", CDN: deleteCDN, DeleteHandle: "01.png"},
+	})
+	// identity with option, which backend doesn't have anymore
+	rec.Identities = map[string]string{deleteCDN: deleteCDN + "{test-delete-region=eu}"}
+
+	require.NoError(t, history.Append(historyPath, rec))
+
+	rm := newTestRemover(t, "identity-"+t.Name())
+
+	_, err := rm.RemoveUploads(context.Background(), historyPath, nil, inDir("gallery"))
+	require.ErrorIs(t, err, registry.ErrIdentityChanged)
+	require.False(t, slices.Contains(bucket("identity-"+t.Name()).deleted, "01.png"))
+}
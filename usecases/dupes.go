@@ -0,0 +1,131 @@
+package usecases
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+
+	"golang.org/x/sync/semaphore"
+
+	"github.com/bohdanch-w/go-tgupload/pkg/phash"
+	"github.com/bohdanch-w/go-tgupload/pkg/utils"
+
+	whlogger "github.com/bohdanch-w/wheel/logger"
+)
+
+// SimilarImage is an image of the group of near-duplicates.
+type SimilarImage struct {
+	Path string
+	Hash phash.Hash
+	// Distance is the Hamming distance to the first image of the group.
+	Distance int
+}
+
+// FindSimilarImages hashes images concurrently and groups ones within the Hamming distance of
+// the first image of the group, see GroupSimilarImages. Images failed to decode are skipped.
+func FindSimilarImages(
+	ctx context.Context,
+	logger whlogger.Logger,
+	paths []string,
+	distance int,
+	parallel uint,
+) ([][]SimilarImage, error) {
+	images := hashImages(ctx, logger, paths, max(parallel, 1))
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("hash images: %w", err)
+	}
+
+	return GroupSimilarImages(images, distance), nil
+}
+
+// GroupSimilarImages groups images within the Hamming distance of the first image of the group.
+// Grouping is not transitive: image close to other member, but not to the first one, starts
+// its own group, so every image of the group resembles the first one.
+// Images are taken in path order and join the closest group, groups of single image are dropped.
+// Groups and their images are ordered by path.
+func GroupSimilarImages(images []SimilarImage, distance int) [][]SimilarImage {
+	images = slices.Clone(images)
+	utils.NaturalSort(images, func(img SimilarImage) string { return img.Path })
+
+	var groups [][]SimilarImage
+
+	for _, img := range images {
+		closest := -1
+
+		for i, group := range groups {
+			d := group[0].Hash.Distance(img.Hash)
+			if d <= distance && (closest < 0 || d < groups[closest][0].Hash.Distance(img.Hash)) {
+				closest = i
+			}
+		}
+
+		if closest < 0 {
+			groups = append(groups, []SimilarImage{img})
+
+			continue
+		}
+
+		img.Distance = groups[closest][0].Hash.Distance(img.Hash)
+		groups[closest] = append(groups[closest], img)
+	}
+
+	res := groups[:0]
+
+	for _, group := range groups {
+		if len(group) > 1 {
+			res = append(res, group)
+		}
+	}
+
+	if len(res) == 0 {
+		return nil
+	}
+
+	return res
+}
+
+func hashImages(ctx context.Context, logger whlogger.Logger, paths []string, parallel uint) []SimilarImage {
+	var (
+		sem    = semaphore.NewWeighted(int64(parallel))
+		wg     sync.WaitGroup
+		mux    sync.Mutex
+		images = make([]SimilarImage, 0, len(paths))
+	)
+
+	for _, path := range paths {
+		if err := sem.Acquire(ctx, 1); err != nil {
+			break
+		}
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			defer sem.Release(1)
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				logger.WithError(err).With("path", path).Warnf("failed to read image")
+
+				return
+			}
+
+			hash, err := phash.Compute(data)
+			if err != nil {
+				logger.WithError(err).With("path", path).Warnf("skipping unsupported image")
+
+				return
+			}
+
+			mux.Lock()
+			images = append(images, SimilarImage{Path: path, Hash: hash})
+			mux.Unlock()
+		}()
+	}
+
+	wg.Wait()
+
+	return images
+}
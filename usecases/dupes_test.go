@@ -0,0 +1,149 @@
+package usecases_test
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bohdanch-w/go-tgupload/pkg/phash"
+	"github.com/bohdanch-w/go-tgupload/usecases"
+
+	whlogger "github.com/bohdanch-w/wheel/logger"
+)
+
+func writeImage(t *testing.T, path string, seed int, quality int) {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, 200, 300))
+
+	for y := range 300 {
+		for x := range 200 {
+			v := uint8((x*255/200 + y*seed*255/300) % 256) // nolint: gosec
+			img.Set(x, y, color.RGBA{R: v, G: 255 - v, B: v / 2, A: 255})
+		}
+	}
+
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o700))
+
+	f, err := os.Create(path)
+	require.NoError(t, err)
+
+	defer f.Close()
+
+	if quality == 0 {
+		require.NoError(t, png.Encode(f, img))
+	} else {
+		require.NoError(t, jpeg.Encode(f, img, &jpeg.Options{Quality: quality}))
+	}
+}
+
+func TestFindSimilarImages(t *testing.T) {
+	dir := t.TempDir()
+
+	paths := []string{
+		filepath.Join(dir, "a", "10.png"),
+		filepath.Join(dir, "a", "2.png"),
+		filepath.Join(dir, "a", "3.png"),
+		filepath.Join(dir, "b", "1.jpg"),
+		filepath.Join(dir, "b", "2.jpg"),
+		filepath.Join(dir, "b", "broken.png"),
+	}
+
+	writeImage(t, paths[0], 1, 0)
+	writeImage(t, paths[1], 2, 0)
+	writeImage(t, paths[2], 5, 0)
+	writeImage(t, paths[3], 1, 30)
+	writeImage(t, paths[4], 2, 90)
+	require.NoError(t, os.WriteFile(paths[5], []byte("not an image"), 0o600))
+
+	groups, err := usecases.FindSimilarImages(
+		context.Background(), whlogger.NewNullLogger(), paths, phash.DefaultDistance, 2,
+	)
+	require.NoError(t, err)
+	require.Len(t, groups, 2)
+
+	var got [][]string
+
+	for _, group := range groups {
+		var names []string
+
+		for i, img := range group {
+			names = append(names, img.Path)
+
+			require.LessOrEqual(t, img.Distance, phash.DefaultDistance)
+
+			if i == 0 {
+				require.Zero(t, img.Distance)
+			}
+		}
+
+		got = append(got, names)
+	}
+
+	require.Equal(t, [][]string{{paths[1], paths[4]}, {paths[0], paths[3]}}, got)
+}
+
+func TestGroupSimilarImages(t *testing.T) {
+	const distance = 4
+
+	tests := []struct {
+		name   string
+		images []usecases.SimilarImage
+		want   [][]string
+	}{
+		{
+			name: "chain is not merged",
+			images: []usecases.SimilarImage{
+				{Path: "c.png", Hash: 0xff},
+				{Path: "a.png", Hash: 0x00},
+				{Path: "b.png", Hash: 0x0f},
+			},
+			want: [][]string{{"a.png", "b.png"}},
+		},
+		{
+			name: "closest group is joined",
+			images: []usecases.SimilarImage{
+				{Path: "1.png", Hash: 0x00},
+				{Path: "2.png", Hash: 0xf8},
+				{Path: "3.png", Hash: 0x78},
+				{Path: "10.png", Hash: 0x01},
+			},
+			want: [][]string{{"1.png", "10.png"}, {"2.png", "3.png"}},
+		},
+		{
+			name: "no similar images",
+			images: []usecases.SimilarImage{
+				{Path: "a.png", Hash: 0x00},
+				{Path: "b.png", Hash: 0xff},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got [][]string
+
+			for _, group := range usecases.GroupSimilarImages(tt.images, distance) {
+				var names []string
+
+				for _, img := range group {
+					require.LessOrEqual(t, group[0].Hash.Distance(img.Hash), distance)
+					require.Equal(t, group[0].Hash.Distance(img.Hash), img.Distance)
+
+					names = append(names, img.Path)
+				}
+
+				got = append(got, names)
+			}
+
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
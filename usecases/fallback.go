@@ -0,0 +1,146 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+
+	"github.com/bohdanch-w/go-tgupload/entities"
+	"github.com/bohdanch-w/go-tgupload/services"
+
+	wherr "github.com/bohdanch-w/wheel/errors"
+	whlogger "github.com/bohdanch-w/wheel/logger"
+)
+
+var (
+	_ services.CDN      = (*FallbackCDN)(nil)
+	_ services.AlbumCDN = (*FallbackCDN)(nil)
+	_ io.Closer         = (*FallbackCDN)(nil)
+)
+
+type NamedCDN struct {
+	Name string
+	CDN  services.CDN
+}
+
+// NewFallbackCDN creates CDN, which uploads to the first backend and switches to the next one
+// in order when it fails or doesn't respond within timeout. Switch is sticky: once backend failed,
+// it is skipped for the rest of uploads, so that every file doesn't wait for a broken CDN.
+// Zero timeout disables time limit.
+func NewFallbackCDN(logger whlogger.Logger, timeout time.Duration, backends ...NamedCDN) *FallbackCDN {
+	return &FallbackCDN{
+		logger:   logger,
+		timeout:  timeout,
+		backends: backends,
+	}
+}
+
+type FallbackCDN struct {
+	logger   whlogger.Logger
+	timeout  time.Duration
+	backends []NamedCDN
+	current  atomic.Int64
+}
+
+func (f *FallbackCDN) Upload(ctx context.Context, media entities.MediaFile) (entities.MediaFile, error) {
+	if len(f.backends) == 1 {
+		uploaded, err := f.upload(ctx, f.backends[0].CDN, media)
+		if err != nil {
+			return media, err
+		}
+
+		uploaded.CDN = f.backends[0].Name
+
+		return uploaded, nil
+	}
+
+	var mErr *multierror.Error
+
+	for idx := int(f.current.Load()); idx < len(f.backends); idx++ {
+		backend := f.backends[idx]
+
+		uploaded, err := f.upload(ctx, backend.CDN, media)
+		if err == nil {
+			uploaded.CDN = backend.Name
+
+			return uploaded, nil
+		}
+
+		if ctx.Err() != nil {
+			return media, fmt.Errorf("%s: %w", backend.Name, err)
+		}
+
+		mErr = multierror.Append(mErr, fmt.Errorf("%s: %w", backend.Name, err))
+
+		if idx+1 < len(f.backends) && f.current.CompareAndSwap(int64(idx), int64(idx+1)) {
+			f.logger.WithError(err).
+				With("from", backend.Name).
+				With("to", f.backends[idx+1].Name).
+				Warnf("cdn failed, switching to fallback")
+		}
+	}
+
+	if mErr == nil {
+		return media, wherr.Error("no cdn available")
+	}
+
+	return media, mErr
+}
+
+func (f *FallbackCDN) upload(
+	ctx context.Context,
+	cdn services.CDN,
+	media entities.MediaFile,
+) (entities.MediaFile, error) {
+	if f.timeout == 0 {
+		return cdn.Upload(ctx, media) // nolint: wrapcheck
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, f.timeout)
+	defer cancel()
+
+	uploaded, err := cdn.Upload(ctx, media)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return media, fmt.Errorf("timed out after %s: %w", f.timeout, err)
+	}
+
+	return uploaded, err // nolint: wrapcheck
+}
+
+// CreateAlbum creates album on every backend, so that fallback uploads are grouped as well.
+func (f *FallbackCDN) CreateAlbum(ctx context.Context, title string) error {
+	var mErr *multierror.Error
+
+	for _, backend := range f.backends {
+		if err := createAlbum(ctx, backend.CDN, title); err != nil {
+			mErr = multierror.Append(mErr, fmt.Errorf("%s: %w", backend.Name, err))
+		}
+	}
+
+	return mErr.ErrorOrNil()
+}
+
+// Close releases backends that hold resources.
+func (f *FallbackCDN) Close() error {
+	return closeBackends(f.backends)
+}
+
+// closeBackends releases backends, which hold resources, e.g. plugin processes.
+func closeBackends(backends []NamedCDN) error {
+	var mErr *multierror.Error
+
+	for _, backend := range backends {
+		if closer, ok := backend.CDN.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				mErr = multierror.Append(mErr, fmt.Errorf("%s: %w", backend.Name, err))
+			}
+		}
+	}
+
+	return mErr.ErrorOrNil()
+}
@@ -0,0 +1,102 @@
+package usecases_test
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bohdanch-w/go-tgupload/entities"
+	"github.com/bohdanch-w/go-tgupload/usecases"
+
+	whlogger "github.com/bohdanch-w/wheel/logger"
+)
+
+type fakeCDN struct {
+	prefix string
+	failAt int64
+	delay  time.Duration
+	calls  atomic.Int64
+}
+
+func (f *fakeCDN) Upload(ctx context.Context, media entities.MediaFile) (entities.MediaFile, error) {
+	if call := f.calls.Add(1); f.failAt != 0 && call >= f.failAt {
+		return media, entities.Error("service unavailable")
+	}
+
+	select {
+	case <-ctx.Done():
+		return media, ctx.Err()
+	case <-time.After(f.delay):
+	}
+
+	media.URL = f.prefix + media.Name
+
+	return media, nil
+}
+
+func TestFallbackCDNSwitchesBackend(t *testing.T) {
+	primary := &fakeCDN{prefix: "https://primary/", failAt: 3}
+	secondary := &fakeCDN{prefix: "https://secondary/"}
+
+	cdn := usecases.NewFallbackCDN(whlogger.NewNullLogger(), 0,
+		usecases.NamedCDN{Name: "primary", CDN: primary},
+		usecases.NamedCDN{Name: "secondary", CDN: secondary},
+	)
+
+	files := make([]entities.MediaFile, 0, 10)
+	for i := range 10 {
+		files = append(files, entities.MediaFile{Name: fmt.Sprintf("%02d.png", i), Path: fmt.Sprintf("%02d.png", i)})
+	}
+
+	uploaded, err := usecases.UploadFilesToCDN(context.Background(), whlogger.NewNullLogger(), cdn, 1, files)
+	require.NoError(t, err)
+	require.Len(t, uploaded, len(files))
+
+	for i, media := range uploaded {
+		if i < 2 {
+			require.Equal(t, "primary", media.CDN)
+			require.Equal(t, "https://primary/"+media.Name, media.URL)
+		} else {
+			require.Equal(t, "secondary", media.CDN)
+			require.Equal(t, "https://secondary/"+media.Name, media.URL)
+		}
+	}
+
+	require.EqualValues(t, 3, primary.calls.Load(), "failed backend must not be retried")
+}
+
+func TestFallbackCDNTimeout(t *testing.T) {
+	cdn := usecases.NewFallbackCDN(whlogger.NewNullLogger(), 10*time.Millisecond,
+		usecases.NamedCDN{Name: "slow", CDN: &fakeCDN{prefix: "https://slow/", delay: time.Second}},
+		usecases.NamedCDN{Name: "fast", CDN: &fakeCDN{prefix: "https://fast/"}},
+	)
+
+	media, err := cdn.Upload(context.Background(), entities.MediaFile{Name: "01.png"})
+	require.NoError(t, err)
+	require.Equal(t, "fast", media.CDN)
+	require.Equal(t, "https://fast/01.png", media.URL)
+}
+
+func TestFallbackCDNAllFailed(t *testing.T) {
+	cdn := usecases.NewFallbackCDN(whlogger.NewNullLogger(), 0,
+		usecases.NamedCDN{Name: "first", CDN: &fakeCDN{failAt: 1}},
+		usecases.NamedCDN{Name: "second", CDN: &fakeCDN{failAt: 1}},
+	)
+
+	_, err := cdn.Upload(context.Background(), entities.MediaFile{Name: "01.png"})
+	require.ErrorContains(t, err, "first: service unavailable")
+	require.ErrorContains(t, err, "second: service unavailable")
+}
+
+func TestFallbackCDNSingleBackendError(t *testing.T) {
+	cdn := usecases.NewFallbackCDN(whlogger.NewNullLogger(), 0,
+		usecases.NamedCDN{Name: "only", CDN: &fakeCDN{failAt: 1}},
+	)
+
+	_, err := cdn.Upload(context.Background(), entities.MediaFile{Name: "01.png"})
+	require.EqualError(t, err, "service unavailable")
+}
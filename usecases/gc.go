@@ -0,0 +1,217 @@
+package usecases
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+
+	"github.com/bohdanch-w/go-tgupload/config"
+	"github.com/bohdanch-w/go-tgupload/entities"
+	"github.com/bohdanch-w/go-tgupload/services"
+)
+
+const (
+	ErrListUnsupported = entities.Error("cdn does not support listing of stored objects")
+
+	pageListLimit = 200
+)
+
+// NewReferences creates empty set of media references.
+func NewReferences() *References {
+	return &References{
+		handles: make(map[string]bool),
+		paths:   make(map[string]bool),
+	}
+}
+
+// References is a set of media in use, known by URL or delete handle.
+type References struct {
+	handles map[string]bool
+	// paths are all trailing segments of referenced URL paths, so that object key
+	// matches URL regardless of host, bucket or public URL prefix.
+	paths map[string]bool
+}
+
+// AddURL marks media with the URL as referenced. Query, e.g. signature of presigned URL, is ignored.
+func (r *References) AddURL(rawURL string) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Path == "" {
+		return
+	}
+
+	segments := strings.Split(u.Path, "/")
+	for i := range segments {
+		if suffix := strings.Trim(strings.Join(segments[i:], "/"), "/"); suffix != "" {
+			r.paths[suffix] = true
+		}
+	}
+}
+
+// AddMedia marks media and its mirrors as referenced.
+func (r *References) AddMedia(media entities.MediaFile) {
+	r.addHandle(media.CDN, media.DeleteHandle)
+	r.AddURL(media.URL)
+
+	for _, mirror := range media.Mirrors {
+		r.addHandle(mirror.CDN, mirror.DeleteHandle)
+		r.AddURL(mirror.URL)
+	}
+}
+
+// AddPage marks all images and links of the page as referenced.
+func (r *References) AddPage(page entities.Page) {
+	for _, node := range page.Content {
+		r.addNode(node)
+	}
+}
+
+func (r *References) addNode(node entities.Node) {
+	for _, attr := range []string{"src", "href"} {
+		if v := node.Attrs[attr]; v != "" {
+			r.AddURL(v)
+		}
+	}
+
+	for _, c := range node.Children {
+		if child, ok := c.(entities.Node); ok {
+			r.addNode(child)
+		}
+	}
+}
+
+func (r *References) addHandle(cdn, handle string) {
+	if handle != "" {
+		r.handles[cdn+"\x00"+handle] = true
+	}
+}
+
+// Has reports whether object of the CDN is referenced.
+func (r *References) Has(cdn string, obj entities.StoredObject) bool {
+	if r.handles[cdn+"\x00"+obj.Handle] {
+		return true
+	}
+
+	if key := strings.Trim(obj.Handle, "/"); key != "" && r.paths[key] {
+		return true
+	}
+
+	if u, err := url.Parse(obj.URL); err == nil && u.Path != "" {
+		return r.paths[strings.Trim(u.Path, "/")]
+	}
+
+	return false
+}
+
+// AddAccountPages marks media used by all pages of Telegraph account as referenced.
+func (r *References) AddAccountPages(ctx context.Context, api services.TelegraphAPI) error {
+	for offset := 0; ; {
+		pages, total, err := api.PageList(ctx, offset, pageListLimit)
+		if err != nil {
+			return fmt.Errorf("list pages: %w", err)
+		}
+
+		for _, p := range pages {
+			page, err := api.Page(ctx, p.URL)
+			if err != nil {
+				return fmt.Errorf("%s: %w", p.URL, err)
+			}
+
+			r.AddPage(page)
+		}
+
+		offset += len(pages)
+
+		if len(pages) == 0 || offset >= total {
+			return nil
+		}
+	}
+}
+
+// GCOptions configures garbage collection.
+type GCOptions struct {
+	// MinAge protects recently stored objects, e.g. of posts being uploaded right now.
+	MinAge time.Duration
+	// DryRun only reports unreferenced objects.
+	DryRun bool
+}
+
+// GCReport describes collected objects.
+type GCReport struct {
+	Scanned int
+	// Garbage are unreferenced objects, older than minimal age. On real run only deleted ones.
+	Garbage []entities.StoredObject
+	Bytes   int64
+}
+
+// NewGarbageCollector creates collector of stored objects, which are not referenced anymore.
+// CDN backends are created on demand from the config.
+func NewGarbageCollector(cfg config.Config, opts CDNOptions) *GarbageCollector {
+	return &GarbageCollector{
+		cdnPool: newCDNPool(cfg, opts),
+	}
+}
+
+type GarbageCollector struct {
+	*cdnPool
+}
+
+// Collect deletes objects of the CDN, which are older than minimal age and not referenced.
+// Failed deletions are reported in error, but don't stop collection.
+func (gc *GarbageCollector) Collect(
+	ctx context.Context,
+	typ string,
+	refs *References,
+	opts GCOptions,
+) (GCReport, error) {
+	var report GCReport
+
+	cdn, err := gc.get(ctx, typ)
+	if err != nil {
+		return report, err
+	}
+
+	lister, ok := cdn.(services.CDNLister)
+	if !ok {
+		return report, fmt.Errorf("%w: %s", ErrListUnsupported, typ)
+	}
+
+	deleter, ok := cdn.(services.CDNDeleter)
+	if !ok && !opts.DryRun {
+		return report, fmt.Errorf("%w: %s", ErrDeleteUnsupported, typ)
+	}
+
+	objects, err := lister.List(ctx)
+	if err != nil {
+		return report, fmt.Errorf("%s: %w", typ, err)
+	}
+
+	var (
+		mErr      *multierror.Error
+		threshold = time.Now().Add(-opts.MinAge)
+	)
+
+	report.Scanned = len(objects)
+
+	for _, obj := range objects {
+		if refs.Has(typ, obj) || obj.ModifiedAt.After(threshold) {
+			continue
+		}
+
+		if !opts.DryRun {
+			if err := deleter.Delete(ctx, obj.Handle); err != nil {
+				mErr = multierror.Append(mErr, fmt.Errorf("%s: %w", obj.Handle, err))
+
+				continue
+			}
+		}
+
+		report.Garbage = append(report.Garbage, obj)
+		report.Bytes += obj.Size
+	}
+
+	return report, mErr.ErrorOrNil()
+}
@@ -0,0 +1,203 @@
+package usecases_test
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bohdanch-w/go-tgupload/config"
+	"github.com/bohdanch-w/go-tgupload/entities"
+	"github.com/bohdanch-w/go-tgupload/registry"
+	"github.com/bohdanch-w/go-tgupload/services"
+	"github.com/bohdanch-w/go-tgupload/usecases"
+)
+
+type listerCDN struct {
+	objects []entities.StoredObject
+	deleted []string
+}
+
+func (l *listerCDN) Upload(_ context.Context, media entities.MediaFile) (entities.MediaFile, error) {
+	return media, nil
+}
+
+func (l *listerCDN) List(context.Context) ([]entities.StoredObject, error) {
+	return l.objects, nil
+}
+
+func (l *listerCDN) Delete(_ context.Context, handle string) error {
+	l.deleted = append(l.deleted, handle)
+
+	return nil
+}
+
+type pagesAPI struct {
+	services.TelegraphAPI
+
+	pages []entities.Page
+}
+
+func (p *pagesAPI) PageList(_ context.Context, offset, limit int) ([]entities.Page, int, error) {
+	end := min(offset+limit, len(p.pages))
+
+	res := make([]entities.Page, 0, end-offset)
+	for _, page := range p.pages[offset:end] {
+		res = append(res, entities.Page{URL: page.URL, Title: page.Title})
+	}
+
+	return res, len(p.pages), nil
+}
+
+func (p *pagesAPI) Page(_ context.Context, pageURL string) (entities.Page, error) {
+	idx := slices.IndexFunc(p.pages, func(page entities.Page) bool { return page.URL == pageURL })
+	if idx < 0 {
+		return entities.Page{}, entities.Error("page not found")
+	}
+
+	return p.pages[idx], nil
+}
+
+func imagePage(url string, images ...string) entities.Page {
+	figure := entities.Node{Tag: "figure"}
+	for _, src := range images {
+		figure.Children = append(figure.Children, entities.Node{Tag: "img", Attrs: map[string]string{"src": src}})
+	}
+
+	return entities.Page{URL: url, Content: []entities.Node{figure}}
+}
+
+func TestReferences(t *testing.T) {
+	refs := usecases.NewReferences()
+
+	refs.AddURL("https://bucket.s3.eu-central-1.amazonaws.com/gallery/a.png?X-Amz-Signature=abc")
+	refs.AddPage(imagePage("https://telegra.ph/page", "https://cdn.example.com/gallery/b.png"))
+	refs.AddMedia(entities.MediaFile{
+		CDN:          "post-image",
+		URL:          "https://i.postimg.cc/xyz/c.png",
+		DeleteHandle: "https://postimg.cc/delete/xyz",
+		Mirrors:      []entities.Mirror{{CDN: "s3", URL: "https://other/d.png", DeleteHandle: "gallery/mirror.png"}},
+	})
+
+	require.True(t, refs.Has("s3", entities.StoredObject{Handle: "gallery/a.png"}))
+	require.True(t, refs.Has("s3", entities.StoredObject{Handle: "gallery/b.png"}))
+	require.True(t, refs.Has("s3", entities.StoredObject{Handle: "gallery/mirror.png"}))
+	require.True(t, refs.Has("post-image", entities.StoredObject{Handle: "https://postimg.cc/delete/xyz"}))
+	require.True(t, refs.Has("s3", entities.StoredObject{Handle: "/d.png"}))
+
+	require.False(t, refs.Has("s3", entities.StoredObject{Handle: "gallery/c.png"}))
+	require.False(t, refs.Has("s3", entities.StoredObject{Handle: "other/a.png"}))
+	require.False(t, refs.Has("s3", entities.StoredObject{Handle: "https://postimg.cc/delete/xyz"}))
+}
+
+func TestReferencesPageNodes(t *testing.T) {
+	node := func(tag, attr, value string, children ...any) entities.Node {
+		n := entities.Node{Tag: tag, Children: children}
+		if attr != "" {
+			n.Attrs = map[string]string{attr: value}
+		}
+
+		return n
+	}
+
+	tests := []struct {
+		name       string
+		content    []entities.Node
+		referenced []string
+	}{
+		{
+			name:       "images of figure",
+			content:    []entities.Node{node("figure", "", "", node("img", "src", "https://cdn/a.png"), "caption")},
+			referenced: []string{"a.png"},
+		},
+		{
+			name: "link around image",
+			content: []entities.Node{node("p", "", "",
+				node("a", "href", "https://cdn/full.png", node("img", "src", "https://cdn/thumb.png")),
+			)},
+			referenced: []string{"full.png", "thumb.png"},
+		},
+		{
+			name: "deeply nested",
+			content: []entities.Node{node("blockquote", "", "",
+				node("figure", "", "", node("iframe", "src", "https://cdn/embed.mp4"), node("figcaption", "", "", "text")),
+				node("ul", "", "", node("li", "", "", node("a", "href", "https://cdn/list.png"))),
+			)},
+			referenced: []string{"embed.mp4", "list.png"},
+		},
+		{
+			name:    "other attributes",
+			content: []entities.Node{node("img", "alt", "https://cdn/alt.png")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			refs := usecases.NewReferences()
+			refs.AddPage(entities.Page{URL: "https://telegra.ph/page", Content: tt.content})
+
+			for _, name := range []string{"a.png", "full.png", "thumb.png", "embed.mp4", "list.png", "alt.png"} {
+				require.Equal(t, slices.Contains(tt.referenced, name),
+					refs.Has("s3", entities.StoredObject{Handle: "gallery/" + name, URL: "https://cdn/" + name}), name)
+			}
+		})
+	}
+}
+
+func TestReferencesAccountPages(t *testing.T) {
+	api := &pagesAPI{}
+	for i := range 450 {
+		api.pages = append(api.pages, imagePage(
+			fmt.Sprintf("https://telegra.ph/page-%d", i),
+			fmt.Sprintf("https://cdn.example.com/gallery/%03d.png", i),
+		))
+	}
+
+	refs := usecases.NewReferences()
+	require.NoError(t, refs.AddAccountPages(context.Background(), api))
+
+	require.True(t, refs.Has("s3", entities.StoredObject{Handle: "gallery/000.png"}))
+	require.True(t, refs.Has("s3", entities.StoredObject{Handle: "gallery/449.png"}))
+}
+
+func TestGarbageCollector(t *testing.T) {
+	var (
+		now = time.Now()
+		cdn = &listerCDN{objects: []entities.StoredObject{
+			{Handle: "gallery/history.png", Size: 10, ModifiedAt: now.Add(-48 * time.Hour)},
+			{Handle: "gallery/page.png", Size: 20, ModifiedAt: now.Add(-48 * time.Hour)},
+			{Handle: "gallery/aborted.png", Size: 30, ModifiedAt: now.Add(-48 * time.Hour)},
+			{Handle: "gallery/orphan.png", Size: 40, ModifiedAt: now.Add(-72 * time.Hour)},
+			{Handle: "gallery/fresh.png", Size: 50, ModifiedAt: now.Add(-time.Hour)},
+		}}
+	)
+
+	registry.Register(registry.Backend{
+		Name: "test-gc",
+		New: func(context.Context, registry.Params) (services.CDN, error) {
+			return cdn, nil
+		},
+	})
+
+	refs := usecases.NewReferences()
+	refs.AddMedia(entities.MediaFile{CDN: "test-gc", URL: "https://cdn/history.png", DeleteHandle: "gallery/history.png"})
+	refs.AddPage(imagePage("https://telegra.ph/page", "https://cdn/gallery/page.png"))
+
+	gc := usecases.NewGarbageCollector(config.Config{}, usecases.CDNOptions{})
+	defer gc.Close()
+
+	report, err := gc.Collect(context.Background(), "test-gc", refs, usecases.GCOptions{MinAge: 24 * time.Hour, DryRun: true})
+	require.NoError(t, err)
+	require.Equal(t, 5, report.Scanned)
+	require.Len(t, report.Garbage, 2)
+	require.EqualValues(t, 70, report.Bytes)
+	require.Empty(t, cdn.deleted)
+
+	report, err = gc.Collect(context.Background(), "test-gc", refs, usecases.GCOptions{MinAge: 24 * time.Hour})
+	require.NoError(t, err)
+	require.EqualValues(t, 70, report.Bytes)
+	require.Equal(t, []string{"gallery/aborted.png", "gallery/orphan.png"}, cdn.deleted)
+}
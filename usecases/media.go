@@ -9,20 +9,20 @@ import (
 	"github.com/bohdanch-w/wheel/ds/hashset"
 )
 
+// LoadMedia describes media file at the path. Content isn't loaded, so that CDNs, which are able to,
+// stream it from disk. See entities.MediaFile.Content.
 func LoadMedia(path string) (entities.MediaFile, error) {
 	media := entities.MediaFile{
 		Name: filepath.Base(path),
 		Path: path,
 	}
 
-	data, err := os.ReadFile(path)
+	f, err := os.Open(path)
 	if err != nil {
 		return media, fmt.Errorf("read media %s: %w", path, err)
 	}
 
-	media.Data = data
-
-	return media, nil
+	return media, f.Close() // nolint: wrapcheck
 }
 
 func IsImage(path string) bool {
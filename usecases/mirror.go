@@ -0,0 +1,120 @@
+package usecases
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/hashicorp/go-multierror"
+
+	"github.com/bohdanch-w/go-tgupload/entities"
+	"github.com/bohdanch-w/go-tgupload/services"
+
+	whlogger "github.com/bohdanch-w/wheel/logger"
+)
+
+var (
+	_ services.CDN      = (*MirrorCDN)(nil)
+	_ services.AlbumCDN = (*MirrorCDN)(nil)
+	_ io.Closer         = (*MirrorCDN)(nil)
+)
+
+// NewMirrorCDN creates CDN, which uploads every file to primary and all mirrors concurrently.
+// Resulting URL is the one from primary, successful mirror URLs are attached to media.
+// Mirror failures are reported but don't fail the upload.
+func NewMirrorCDN(logger whlogger.Logger, primary services.CDN, mirrors ...NamedCDN) *MirrorCDN {
+	return &MirrorCDN{
+		logger:  logger,
+		primary: primary,
+		mirrors: mirrors,
+	}
+}
+
+type MirrorCDN struct {
+	logger  whlogger.Logger
+	primary services.CDN
+	mirrors []NamedCDN
+}
+
+func (m *MirrorCDN) Upload(ctx context.Context, media entities.MediaFile) (entities.MediaFile, error) {
+	var (
+		wg      sync.WaitGroup
+		mirrors = make([]*entities.Mirror, len(m.mirrors))
+	)
+
+	for i, mirror := range m.mirrors {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			uploaded, err := mirror.CDN.Upload(ctx, media)
+			if err != nil {
+				m.logger.WithError(err).
+					With("cdn", mirror.Name).
+					With("file", media.Name).
+					Warnf("mirror upload failed")
+
+				return
+			}
+
+			mirrors[i] = &entities.Mirror{
+				CDN:          mirror.Name,
+				URL:          uploaded.URL,
+				DeleteHandle: uploaded.DeleteHandle,
+				ExpiresAt:    uploaded.ExpiresAt,
+			}
+		}()
+	}
+
+	uploaded, err := m.primary.Upload(ctx, media)
+
+	wg.Wait()
+
+	if err != nil {
+		return media, err // nolint: wrapcheck
+	}
+
+	for _, mirror := range mirrors {
+		if mirror != nil {
+			uploaded.Mirrors = append(uploaded.Mirrors, *mirror)
+		}
+	}
+
+	return uploaded, nil
+}
+
+// CreateAlbum creates album on primary and all mirrors.
+func (m *MirrorCDN) CreateAlbum(ctx context.Context, title string) error {
+	var mErr *multierror.Error
+
+	if err := createAlbum(ctx, m.primary, title); err != nil {
+		mErr = multierror.Append(mErr, err)
+	}
+
+	for _, mirror := range m.mirrors {
+		if err := createAlbum(ctx, mirror.CDN, title); err != nil {
+			mErr = multierror.Append(mErr, fmt.Errorf("%s: %w", mirror.Name, err))
+		}
+	}
+
+	return mErr.ErrorOrNil()
+}
+
+// Close releases primary and mirror backends that hold resources.
+func (m *MirrorCDN) Close() error {
+	var mErr *multierror.Error
+
+	if closer, ok := m.primary.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			mErr = multierror.Append(mErr, err)
+		}
+	}
+
+	if err := closeBackends(m.mirrors); err != nil {
+		mErr = multierror.Append(mErr, err)
+	}
+
+	return mErr.ErrorOrNil()
+}
@@ -0,0 +1,43 @@
+package usecases_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bohdanch-w/go-tgupload/entities"
+	"github.com/bohdanch-w/go-tgupload/usecases"
+
+	whlogger "github.com/bohdanch-w/wheel/logger"
+)
+
+func TestMirrorCDN(t *testing.T) {
+	cdn := usecases.NewMirrorCDN(whlogger.NewNullLogger(),
+		usecases.NewFallbackCDN(whlogger.NewNullLogger(), 0,
+			usecases.NamedCDN{Name: "primary", CDN: &fakeCDN{prefix: "https://primary/"}},
+		),
+		usecases.NamedCDN{Name: "first", CDN: &fakeCDN{prefix: "https://first/"}},
+		usecases.NamedCDN{Name: "broken", CDN: &fakeCDN{failAt: 1}},
+		usecases.NamedCDN{Name: "second", CDN: &fakeCDN{prefix: "https://second/"}},
+	)
+
+	media, err := cdn.Upload(context.Background(), entities.MediaFile{Name: "01.png"})
+	require.NoError(t, err)
+	require.Equal(t, "https://primary/01.png", media.URL)
+	require.Equal(t, "primary", media.CDN)
+	require.Equal(t, []entities.Mirror{
+		{CDN: "first", URL: "https://first/01.png"},
+		{CDN: "second", URL: "https://second/01.png"},
+	}, media.Mirrors)
+}
+
+func TestMirrorCDNPrimaryFailed(t *testing.T) {
+	cdn := usecases.NewMirrorCDN(whlogger.NewNullLogger(),
+		&fakeCDN{failAt: 1},
+		usecases.NamedCDN{Name: "mirror", CDN: &fakeCDN{prefix: "https://mirror/"}},
+	)
+
+	_, err := cdn.Upload(context.Background(), entities.MediaFile{Name: "01.png"})
+	require.ErrorContains(t, err, "service unavailable")
+}
@@ -0,0 +1,101 @@
+package usecases
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+
+	"github.com/bohdanch-w/go-tgupload/config"
+	"github.com/bohdanch-w/go-tgupload/entities"
+	"github.com/bohdanch-w/go-tgupload/services"
+)
+
+const ErrRefreshUnsupported = entities.Error("cdn does not support link refresh")
+
+// NewLinkRefresher creates refresher, which renews expiring links of media uploaded before.
+// CDN backends are created on demand, as they were configured when media was uploaded.
+func NewLinkRefresher(cfg config.Config, opts CDNOptions) *LinkRefresher {
+	return &LinkRefresher{
+		cdnPool: newCDNPool(cfg, opts),
+	}
+}
+
+type LinkRefresher struct {
+	*cdnPool
+}
+
+// Refresh renews links of media and its mirrors, which expire before given time, with CDNs
+// configured as identities, keyed by CDN type, tell. It reports whether any link was changed.
+func (r *LinkRefresher) Refresh(
+	ctx context.Context,
+	media entities.MediaFile,
+	identities map[string]string,
+	before time.Time,
+) (entities.MediaFile, bool, error) {
+	var (
+		mErr    *multierror.Error
+		changed bool
+	)
+
+	if expires(media.ExpiresAt, before) {
+		refreshed, err := r.refresh(ctx, media, identities[media.CDN])
+		if err != nil {
+			mErr = multierror.Append(mErr, fmt.Errorf("%s: %w", media.Path, err))
+		} else {
+			media.URL, media.ExpiresAt, changed = refreshed.URL, refreshed.ExpiresAt, true
+		}
+	}
+
+	for i, mirror := range media.Mirrors {
+		if !expires(mirror.ExpiresAt, before) {
+			continue
+		}
+
+		refreshed, err := r.refresh(ctx, entities.MediaFile{
+			Name:         media.Name,
+			Path:         media.Path,
+			URL:          mirror.URL,
+			CDN:          mirror.CDN,
+			DeleteHandle: mirror.DeleteHandle,
+			ExpiresAt:    mirror.ExpiresAt,
+		}, identities[mirror.CDN])
+		if err != nil {
+			mErr = multierror.Append(mErr, fmt.Errorf("%s: %s: %w", media.Path, mirror.CDN, err))
+
+			continue
+		}
+
+		media.Mirrors[i].URL, media.Mirrors[i].ExpiresAt, changed = refreshed.URL, refreshed.ExpiresAt, true
+	}
+
+	return media, changed, mErr.ErrorOrNil()
+}
+
+func (r *LinkRefresher) refresh(
+	ctx context.Context,
+	media entities.MediaFile,
+	identity string,
+) (entities.MediaFile, error) {
+	cdn, err := r.getStored(ctx, media.CDN, identity)
+	if err != nil {
+		return media, err
+	}
+
+	refresher, ok := cdn.(services.CDNRefresher)
+	if !ok {
+		return media, fmt.Errorf("%w: %s", ErrRefreshUnsupported, media.CDN)
+	}
+
+	refreshed, err := refresher.Refresh(ctx, media)
+	if err != nil {
+		return media, fmt.Errorf("%s: %w", media.CDN, err)
+	}
+
+	return refreshed, nil
+}
+
+func expires(expiresAt, before time.Time) bool {
+	return !expiresAt.IsZero() && expiresAt.Before(before)
+}
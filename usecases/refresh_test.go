@@ -0,0 +1,87 @@
+package usecases_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bohdanch-w/go-tgupload/config"
+	"github.com/bohdanch-w/go-tgupload/entities"
+	"github.com/bohdanch-w/go-tgupload/registry"
+	"github.com/bohdanch-w/go-tgupload/services"
+	"github.com/bohdanch-w/go-tgupload/usecases"
+)
+
+const (
+	refreshCDN    = "test-refresh"
+	refreshBucket = "test-refresh-bucket"
+)
+
+// refresherCDN signs links of its bucket.
+type refresherCDN struct {
+	bucket string
+}
+
+func (r refresherCDN) Upload(_ context.Context, media entities.MediaFile) (entities.MediaFile, error) {
+	return media, nil
+}
+
+func (r refresherCDN) Refresh(_ context.Context, media entities.MediaFile) (entities.MediaFile, error) {
+	media.URL = "https://" + r.bucket + "/" + media.DeleteHandle + "?signed"
+	media.ExpiresAt = time.Now().Add(time.Hour)
+
+	return media, nil
+}
+
+var registerRefresh sync.Once // nolint: gochecknoglobals
+
+func TestLinkRefresherStoredIdentity(t *testing.T) {
+	registerRefresh.Do(func() {
+		registry.Register(registry.Backend{
+			Name:    refreshCDN,
+			Options: []registry.Option{{Key: refreshBucket, Identity: true}},
+			New: func(_ context.Context, params registry.Params) (services.CDN, error) {
+				return refresherCDN{bucket: params.Get(refreshBucket)}, nil
+			},
+		})
+	})
+
+	var opts usecases.CDNOptions
+
+	opts.Values = map[string]string{refreshBucket: "new"}
+
+	r := usecases.NewLinkRefresher(config.Config{}, opts)
+	defer r.Close()
+
+	var (
+		ctx     = context.Background()
+		expired = time.Now().Add(-time.Minute)
+		media   = entities.MediaFile{
+			Path:         "gallery/01.png",
+			URL:          "https://old/01.png?expired",
+			CDN:          refreshCDN,
+			DeleteHandle: "01.png",
+			ExpiresAt:    expired,
+		}
+	)
+
+	refreshed, changed, err := r.Refresh(ctx, media,
+		map[string]string{refreshCDN: refreshCDN + "{" + refreshBucket + "=old}"}, time.Now())
+	require.NoError(t, err)
+	require.True(t, changed)
+	require.Equal(t, "https://old/01.png?signed", refreshed.URL, "link is signed by backend it was uploaded to")
+
+	refreshed, changed, err = r.Refresh(ctx, media, nil, time.Now())
+	require.NoError(t, err)
+	require.True(t, changed)
+	require.Equal(t, "https://new/01.png?signed", refreshed.URL, "unknown identity uses current config")
+
+	media.ExpiresAt = time.Now().Add(48 * time.Hour)
+
+	_, changed, err = r.Refresh(ctx, media, nil, time.Now().Add(24*time.Hour))
+	require.NoError(t, err)
+	require.False(t, changed)
+}
@@ -3,6 +3,7 @@ package usecases
 import (
 	"context"
 	"fmt"
+	"slices"
 	"sync"
 
 	"github.com/hashicorp/go-multierror"
@@ -37,6 +38,14 @@ func (u *CDNUploader) Upload(ctx context.Context, mediaFiles ...entities.MediaFi
 		return nil, nil
 	}
 
+	mediaFiles = slices.Clone(mediaFiles)
+
+	for i := range mediaFiles {
+		if mediaFiles[i].Index == 0 {
+			mediaFiles[i].Index = i + 1
+		}
+	}
+
 	if len(mediaFiles) == 1 {
 		file, err := UploadFileToCDN(ctx, u.logger, u.cdn, mediaFiles[0])
 		if err != nil {
@@ -128,17 +137,29 @@ func UploadFileToCDN(
 	logger.Debugf("Start %s uploading", mediaFile.Name)
 	defer logger.Debugf("uploading %s ended", mediaFile.Name)
 
-	url, err := cdn.Upload(ctx, mediaFile)
+	uploaded, err := cdn.Upload(ctx, mediaFile)
 	if err != nil {
 		return mediaFile, fmt.Errorf("post image %s: %w", mediaFile.Name, err)
 	}
 
-	mediaFile.URL = url
-
-	return mediaFile, nil
+	return uploaded, nil
 }
 
 type uploadResult struct {
 	media entities.MediaFile
 	err   error
 }
+
+// CreateAlbum groups following uploads into album with the title, if CDN supports it.
+func (u *CDNUploader) CreateAlbum(ctx context.Context, title string) error {
+	return createAlbum(ctx, u.cdn, title)
+}
+
+func createAlbum(ctx context.Context, cdn services.CDN, title string) error {
+	album, ok := cdn.(services.AlbumCDN)
+	if !ok {
+		return nil
+	}
+
+	return album.CreateAlbum(ctx, title) // nolint: wrapcheck
+}
@@ -0,0 +1,166 @@
+package usecases
+
+import (
+	"context"
+	"crypto/md5" // nolint: gosec
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bohdanch-w/go-tgupload/entities"
+	"github.com/bohdanch-w/go-tgupload/pkg/utils"
+	"github.com/bohdanch-w/go-tgupload/services"
+
+	whlogger "github.com/bohdanch-w/wheel/logger"
+)
+
+const (
+	ErrVerificationFailed = entities.Error("uploaded file verification failed")
+
+	defaultVerifyAttempts = 5
+	defaultVerifyDelay    = time.Second
+	verifyRequestTimeout  = 30 * time.Second
+)
+
+var (
+	_ services.CDN      = (*VerifiedCDN)(nil)
+	_ services.AlbumCDN = (*VerifiedCDN)(nil)
+	_ io.Closer         = (*VerifiedCDN)(nil)
+)
+
+// NewVerifiedCDN creates CDN, which downloads every uploaded file back and checks that its URL
+// serves the same content. Verification is retried with exponential delay, since some CDNs
+// need time before the link becomes available.
+func NewVerifiedCDN(
+	logger whlogger.Logger,
+	cdn services.CDN,
+	client *http.Client,
+	attempts int,
+	delay time.Duration,
+) *VerifiedCDN {
+	if client == nil {
+		client = &http.Client{Timeout: verifyRequestTimeout}
+	}
+
+	return &VerifiedCDN{
+		logger:   logger,
+		cdn:      cdn,
+		client:   client,
+		attempts: max(attempts, 1),
+		delay:    delay,
+	}
+}
+
+type VerifiedCDN struct {
+	logger   whlogger.Logger
+	cdn      services.CDN
+	client   *http.Client
+	attempts int
+	delay    time.Duration
+}
+
+func (v *VerifiedCDN) Upload(ctx context.Context, media entities.MediaFile) (entities.MediaFile, error) {
+	uploaded, err := v.cdn.Upload(ctx, media)
+	if err != nil {
+		return uploaded, err // nolint: wrapcheck
+	}
+
+	delay := v.delay
+
+	for attempt := 1; ; attempt++ {
+		err = v.verify(ctx, uploaded)
+		if err == nil {
+			return uploaded, nil
+		}
+
+		if attempt >= v.attempts {
+			return media, fmt.Errorf("%w: %s: %w", ErrVerificationFailed, uploaded.URL, err)
+		}
+
+		v.logger.WithError(err).With("url", uploaded.URL).Debugf("verification failed, retrying in %s", delay)
+
+		select {
+		case <-ctx.Done():
+			return media, fmt.Errorf("%w: %s: %w", ErrVerificationFailed, uploaded.URL, ctx.Err())
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+	}
+}
+
+func (v *VerifiedCDN) verify(ctx context.Context, media entities.MediaFile) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, media.URL, http.NoBody)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("get: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status: %s", resp.Status) // nolint: err113
+	}
+
+	data, err := media.Content()
+	if err != nil {
+		return err // nolint: wrapcheck
+	}
+
+	if err := checkContentType(resp.Header.Get("Content-Type"), utils.ContentType(media.Name, data)); err != nil {
+		return err
+	}
+
+	if len(data) == 0 {
+		return nil
+	}
+
+	if resp.ContentLength >= 0 && resp.ContentLength != int64(len(data)) {
+		return fmt.Errorf("content length %d, expected %d", resp.ContentLength, len(data)) // nolint: err113
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, int64(len(data))+1))
+	if err != nil {
+		return fmt.Errorf("read body: %w", err)
+	}
+
+	if md5.Sum(body) != md5.Sum(data) { // nolint: gosec
+		return fmt.Errorf("content hash mismatch") // nolint: err113
+	}
+
+	return nil
+}
+
+func checkContentType(got, expected string) error {
+	gotType, _, err := mime.ParseMediaType(got)
+	if err != nil {
+		return fmt.Errorf("parse content type %q: %w", got, err)
+	}
+
+	expectedType, _, _ := mime.ParseMediaType(expected)
+
+	// CDNs may report different subtype for the same format, e.g. image/jpg, so only major type must match.
+	if gotMajor, _, _ := strings.Cut(gotType, "/"); !strings.HasPrefix(expectedType, gotMajor+"/") {
+		return fmt.Errorf("content type %q, expected %q", gotType, expectedType) // nolint: err113
+	}
+
+	return nil
+}
+
+func (v *VerifiedCDN) CreateAlbum(ctx context.Context, title string) error {
+	return createAlbum(ctx, v.cdn, title)
+}
+
+func (v *VerifiedCDN) Close() error {
+	if closer, ok := v.cdn.(io.Closer); ok {
+		return closer.Close() // nolint: wrapcheck
+	}
+
+	return nil
+}
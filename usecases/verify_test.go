@@ -0,0 +1,57 @@
+package usecases_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bohdanch-w/go-tgupload/entities"
+	"github.com/bohdanch-w/go-tgupload/usecases"
+
+	whlogger "github.com/bohdanch-w/wheel/logger"
+)
+
+func TestVerifiedCDN(t *testing.T) {
+	var requests atomic.Int64
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 { // link is not available right after upload
+			w.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		switch r.URL.Path {
+		case "/01.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("image data"))
+		case "/02.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("other data"))
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("image data"))
+		}
+	}))
+	defer srv.Close()
+
+	cdn := usecases.NewVerifiedCDN(whlogger.NewNullLogger(), &fakeCDN{prefix: srv.URL + "/"}, srv.Client(), 3, time.Millisecond)
+
+	media, err := cdn.Upload(context.Background(), entities.MediaFile{Name: "01.png", Data: []byte("image data")})
+	require.NoError(t, err)
+	require.Equal(t, srv.URL+"/01.png", media.URL)
+	require.EqualValues(t, 2, requests.Load())
+
+	_, err = cdn.Upload(context.Background(), entities.MediaFile{Name: "02.png", Data: []byte("image data")})
+	require.ErrorIs(t, err, usecases.ErrVerificationFailed)
+	require.ErrorContains(t, err, "content hash mismatch")
+
+	_, err = cdn.Upload(context.Background(), entities.MediaFile{Name: "03.png", Data: []byte("image data")})
+	require.ErrorIs(t, err, usecases.ErrVerificationFailed)
+	require.ErrorContains(t, err, "content type")
+}